@@ -24,20 +24,124 @@ type DexClientSpec struct {
 	// Redirect URIs
 	RedirectURIs []string `json:"redirectURIs,omitempty"`
 	// +optional
+	// Go templates expanded for every ManagedCluster selected by RedirectURISource, the results are added to
+	// RedirectURIs. The templates can use .Name, .Labels, .Annotations and .ClusterClaims,
+	// for example https://oauth-openshift.apps.{{ .Name }}.example.com/oauth2callback/dex
+	RedirectURITemplates []string `json:"redirectURITemplates,omitempty"`
+	// +optional
+	// The ManagedClusters the redirect URI templates are expanded for. Defaults to all OCM ManagedClusters.
+	RedirectURISource *RedirectURISource `json:"redirectURISource,omitempty"`
+	// +optional
 	// Trusted Peers
 	TrustedPeers []string `json:"trustedPeers,omitempty"`
 	// +optional
+	// Trusted peers given as references to other DexClients. They are resolved to the client IDs of the DexClients
+	// and added to TrustedPeers.
+	TrustedPeerRefs []DexClientReference `json:"trustedPeerRefs,omitempty"`
+	// +optional
 	// LogoURL
 	LogoURL string `json:"logoURL,omitempty"`
+	// +optional
+	// IDs of the connectors of the DexServer users of this client may log in with. dex cannot restrict a client to
+	// connectors, so the operator only applies the client while the DexServer defines no other connector, and deletes
+	// the oauth2client from dex otherwise. The ConnectorsRestricted condition reports the outcome.
+	AllowedConnectors []string `json:"allowedConnectors,omitempty"`
+	// +optional
+	// What to do when dex already holds an oauth2client with the same client ID that was not created for this DexClient.
+	// Defaults to Fail. The annotation auth.identitatem.io/adoption-policy takes precedence when set.
+	AdoptionPolicy AdoptionPolicy `json:"adoptionPolicy,omitempty"`
+	// +optional
+	// How changes to fields that dex cannot update in place, such as public, are applied. Defaults to Automatic.
+	// Changes to the client secret are always applied by recreating the oauth2client.
+	RecreatePolicy RecreatePolicy `json:"recreatePolicy,omitempty"`
+}
+
+// DexClientReference references a DexClient
+type DexClientReference struct {
+	// +kubebuilder:validation:Required
+	// Name of the DexClient
+	Name string `json:"name"`
+	// +optional
+	// Namespace of the DexClient, defaults to the namespace of the referencing DexClient
+	Namespace string `json:"namespace,omitempty"`
 }
 
+// RedirectURISource selects the ManagedClusters redirect URI templates are expanded for. Other kinds are not
+// supported, the templates would expose their content to the users of the DexClient through its status.
+type RedirectURISource struct {
+	// +optional
+	// Selects the ManagedClusters by label, all ManagedClusters when empty
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+}
+
+// +kubebuilder:validation:Enum=Adopt;Fail;Overwrite
+type AdoptionPolicy string
+
 const (
-	DexClientConditionTypeApplied             string = "Applied"
-	DexClientConditionTypeOAuth2ClientCreated string = "OAuth2ClientCreated"
+	// AdoptionPolicyAdopt takes over the existing oauth2client and applies the DexClient to it. When the client secret
+	// held by dex differs from the one referenced by clientSecretRef, the oauth2client is recreated with the latter.
+	AdoptionPolicyAdopt AdoptionPolicy = "Adopt"
+
+	// AdoptionPolicyFail leaves the existing oauth2client untouched and reports the conflict in the Applied condition
+	AdoptionPolicyFail AdoptionPolicy = "Fail"
+
+	// AdoptionPolicyOverwrite deletes the existing oauth2client and creates it again from the DexClient
+	AdoptionPolicyOverwrite AdoptionPolicy = "Overwrite"
+)
+
+// +kubebuilder:validation:Enum=Automatic;Manual
+type RecreatePolicy string
+
+const (
+	// RecreatePolicyAutomatic deletes the oauth2client and creates it again with the new values
+	RecreatePolicyAutomatic RecreatePolicy = "Automatic"
+
+	// RecreatePolicyManual keeps the oauth2client, updating what can be updated in place, and lists the fields
+	// waiting for a recreate in the RecreateRequired condition. The Applied condition stays False until then.
+	RecreatePolicyManual RecreatePolicy = "Manual"
+)
+
+const (
+	DexClientConditionTypeApplied              string = "Applied"
+	DexClientConditionTypeOAuth2ClientCreated  string = "OAuth2ClientCreated"
+	DexClientConditionTypeDrifted              string = "Drifted"
+	DexClientConditionTypeRecreateRequired     string = "RecreateRequired"
+	DexClientConditionTypeTrustedPeersResolved string = "TrustedPeersResolved"
+	DexClientConditionTypeConnectorsRestricted string = "ConnectorsRestricted"
 )
 
 // DexClientStatus defines the observed state of DexClient
 type DexClientStatus struct {
+	// The generation of the DexClient last applied to dex
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// The client ID of the oauth2client in dex
+	// +optional
+	ClientID string `json:"clientID,omitempty"`
+	// The issuer of the dex server holding the oauth2client
+	// +optional
+	IssuerURL string `json:"issuerURL,omitempty"`
+	// The DexServer holding the oauth2client
+	// +optional
+	DexServerRef *RelatedObjectReference `json:"dexServerRef,omitempty"`
+	// The version reported by the dex server
+	// +optional
+	DexVersion string `json:"dexVersion,omitempty"`
+	// The last time the oauth2client was successfully synced with dex
+	// +optional
+	LastSyncedTime *metav1.Time `json:"lastSyncedTime,omitempty"`
+	// The hash of the client secret last applied to dex
+	// +optional
+	SecretHash string `json:"secretHash,omitempty"`
+	// Adopted is true when the oauth2client already existed in dex and was taken over by this DexClient
+	// +optional
+	Adopted bool `json:"adopted,omitempty"`
+	// The redirect URIs expanded from the redirect URI templates
+	// +optional
+	GeneratedRedirectURIs []string `json:"generatedRedirectURIs,omitempty"`
+	// The client IDs the trusted peer references resolved to
+	// +optional
+	ResolvedTrustedPeers []string `json:"resolvedTrustedPeers,omitempty"`
 	// +optional
 	RelatedObjects []RelatedObjectReference `json:"relatedObjects,omitempty"`
 	// Conditions contains the different condition statuses for this DexClient.
@@ -47,6 +151,9 @@ type DexClientStatus struct {
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Applied")].status`
+//+kubebuilder:printcolumn:name="Issuer",type=string,JSONPath=`.status.issuerURL`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // DexClient is the Schema for the dexclients API
 type DexClient struct {
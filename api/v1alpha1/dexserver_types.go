@@ -4,6 +4,7 @@ package v1alpha1
 
 import (
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -204,13 +205,291 @@ type DexServerSpec struct {
 	Connectors []ConnectorSpec `json:"connectors,omitempty"`
 	// Optional bring-your-own-certificate. Otherwise, the default certificate is used for dex server Ingress.
 	IngressCertificateRef corev1.LocalObjectReference `json:"ingressCertificateRef,omitempty"`
+	// +optional
+	// How connectors are applied to dex. Defaults to Config.
+	ConnectorManagement ConnectorManagement `json:"connectorManagement,omitempty"`
+	// +optional
+	// Certificates securing the dex gRPC API
+	MTLS *MTLSSpec `json:"mtls,omitempty"`
+	// +optional
+	// Who issues the gRPC mTLS certificates and the certificate of the dex web endpoint. Defaults to SelfSigned.
+	CertificateIssuer *CertificateIssuerSpec `json:"certificateIssuer,omitempty"`
+	// +optional
+	// How the dex web endpoint is exposed outside the cluster. Defaults to Ingress.
+	Exposure ExposureType `json:"exposure,omitempty"`
+	// +optional
+	// +listType=map
+	// +listMapKey=host
+	// Hosts dex is reachable on besides the host of the issuer, such as the vanity domains of business units. Each is
+	// routed by the Ingress, by a Route of its own, or by the HTTPRoute. The tokens are still issued under spec.issuer.
+	AdditionalHosts []AdditionalHostSpec `json:"additionalHosts,omitempty"`
+	// +optional
+	// The Ingress exposing the dex web endpoint, in Ingress exposure
+	Ingress *IngressSpec `json:"ingress,omitempty"`
+	// +optional
+	// The OpenShift Route exposing the dex web endpoint, in Route exposure
+	Route *RouteSpec `json:"route,omitempty"`
+	// +optional
+	// The Gateway API Gateway exposing the dex web endpoint, required in GatewayAPI exposure
+	Gateway *GatewaySpec `json:"gateway,omitempty"`
+}
+
+// +kubebuilder:validation:Enum=Ingress;Route;GatewayAPI;None
+type ExposureType string
+
+const (
+	// ExposureTypeIngress exposes dex through a networking.k8s.io/v1 Ingress, which OpenShift turns into a reencrypt
+	// Route
+	ExposureTypeIngress ExposureType = "Ingress"
+
+	// ExposureTypeRoute exposes dex through an OpenShift Route, only on OpenShift
+	ExposureTypeRoute ExposureType = "Route"
+
+	// ExposureTypeGatewayAPI exposes dex through a Gateway API HTTPRoute attached to spec.gateway, with a
+	// BackendTLSPolicy for the TLS connection from the Gateway to dex
+	ExposureTypeGatewayAPI ExposureType = "GatewayAPI"
+
+	// ExposureTypeNone does not expose dex, the issuer is reached through objects managed outside the operator
+	ExposureTypeNone ExposureType = "None"
+)
+
+// AdditionalHostSpec declares a host dex is reachable on besides the host of the issuer
+type AdditionalHostSpec struct {
+	// The host name
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`
+	// +kubebuilder:validation:MaxLength=253
+	Host string `json:"host"`
+	// +optional
+	// Secret holding the certificate of the host in its tls.crt and tls.key, presented by the Ingress or the Route.
+	// Defaults to the default TLS of the Ingress, or to the certificate of the router. Not used in GatewayAPI exposure,
+	// where the Gateway listeners hold the certificates.
+	CertificateRef corev1.LocalObjectReference `json:"certificateRef,omitempty"`
+}
+
+// IngressSpec configures the Ingress exposing the dex web endpoint
+type IngressSpec struct {
+	// +optional
+	// Class of the Ingress. Defaults to the default IngressClass of the cluster.
+	IngressClassName *string `json:"ingressClassName,omitempty"`
+	// +optional
+	// Annotations of the Ingress, such as the rate limiting, WAF or timeout settings of the ingress controller. They
+	// override the route.openshift.io/termination annotation set by the operator. Annotations removed from the list
+	// are removed from the Ingress.
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// +optional
+	// TLS of the Ingress. Defaults to the secret of spec.ingressCertificateRef for the host of the issuer and the
+	// additional hosts without a certificateRef, when it is set.
+	TLS []networkingv1.IngressTLS `json:"tls,omitempty"`
+	// +optional
+	// Deprecated: declare the hosts in spec.additionalHosts instead. The extra hosts are merged into the additional
+	// hosts, without a certificateRef.
+	ExtraHosts []string `json:"extraHosts,omitempty"`
+	// +optional
+	// Path prefix routed to dex. Defaults to the path of the issuer, which dex serves its endpoints under.
+	// +kubebuilder:validation:Pattern=`^/`
+	PathPrefix string `json:"pathPrefix,omitempty"`
+}
+
+// RouteSpec configures the OpenShift Route exposing the dex web endpoint
+type RouteSpec struct {
+	// +optional
+	// TLS termination of the Route. Defaults to Reencrypt.
+	Termination RouteTermination `json:"termination,omitempty"`
+}
+
+// GatewaySpec references the parent Gateway of the HTTPRoute exposing the dex web endpoint
+type GatewaySpec struct {
+	// Name of the Gateway
+	Name string `json:"name"`
+	// +optional
+	// Namespace of the Gateway. Defaults to the namespace of the DexServer.
+	Namespace string `json:"namespace,omitempty"`
+	// +optional
+	// Name of the Gateway listener the HTTPRoute attaches to. Defaults to every listener accepting it.
+	SectionName string `json:"sectionName,omitempty"`
+	// +optional
+	// Port of the Gateway listeners the HTTPRoute attaches to. Defaults to every listener accepting it.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	Port *int32 `json:"port,omitempty"`
+}
+
+// +kubebuilder:validation:Enum=Reencrypt;Passthrough
+type RouteTermination string
+
+const (
+	// RouteTerminationReencrypt: the router presents the certificate of spec.ingressCertificateRef, or its default
+	// certificate, and reencrypts the traffic to dex with the certificate of the dex web endpoint
+	RouteTerminationReencrypt RouteTermination = "Reencrypt"
+
+	// RouteTerminationPassthrough: the router passes the TLS connections through to dex, which presents the
+	// certificate of its web endpoint. The certificate must be issued by cert-manager, the one of the OpenShift
+	// service CA does not cover the issuer host.
+	RouteTerminationPassthrough RouteTermination = "Passthrough"
+)
+
+// CertificateIssuerSpec selects who issues the certificates of dex
+type CertificateIssuerSpec struct {
+	// +optional
+	// Defaults to SelfSigned
+	Mode CertificateIssuerMode `json:"mode,omitempty"`
+	// +optional
+	// The cert-manager issuer, required in CertManager mode
+	IssuerRef *CertManagerIssuerReference `json:"issuerRef,omitempty"`
+}
+
+// +kubebuilder:validation:Enum=SelfSigned;CertManager
+type CertificateIssuerMode string
+
+const (
+	// CertificateIssuerModeSelfSigned: the operator issues the gRPC mTLS certificates from its own CA, and the
+	// certificate of the dex web endpoint comes from the OpenShift service CA, or from another CA of the operator on
+	// other clusters
+	CertificateIssuerModeSelfSigned CertificateIssuerMode = "SelfSigned"
+
+	// CertificateIssuerModeCertManager: the operator requests the certificates from a cert-manager issuer through
+	// Certificate objects, and rolls dex out when they are renewed
+	CertificateIssuerModeCertManager CertificateIssuerMode = "CertManager"
+)
+
+// CertManagerIssuerReference references a cert-manager Issuer or ClusterIssuer
+type CertManagerIssuerReference struct {
+	// Name of the issuer
+	Name string `json:"name"`
+	// +optional
+	// Kind of the issuer, Issuer or ClusterIssuer. Defaults to Issuer.
+	Kind string `json:"kind,omitempty"`
+	// +optional
+	// Group of the issuer. Defaults to cert-manager.io.
+	Group string `json:"group,omitempty"`
+}
+
+// +kubebuilder:validation:Enum=Config;Live
+type ConnectorManagement string
+
+const (
+	// ConnectorManagementConfig writes the connectors to the dex configuration, every change restarts dex
+	ConnectorManagementConfig ConnectorManagement = "Config"
+
+	// ConnectorManagementLive applies the connectors through the dex gRPC API, dex picks up changes without a restart.
+	// Connectors needing files mounted in the dex deployment, LDAP connectors with a rootCARef, stay in the dex
+	// configuration, and so does the first connector when no other connector does, since dex does not start without
+	// one. The credentials of live connectors are passed to dex through its API rather than in environment variables
+	// of the dex deployment.
+	ConnectorManagementLive ConnectorManagement = "Live"
+)
+
+// MTLSSpec defines the lifetime and keys of the certificates securing the dex gRPC API. The CA outlives the server and
+// client certificates it signs, so that renewing them does not change the CA trusted by dex and its clients.
+type MTLSSpec struct {
+	// +optional
+	// Lifetime of the CA. Defaults to 87600h (10 years).
+	CADuration *metav1.Duration `json:"caDuration,omitempty"`
+	// +optional
+	// Lifetime of the server and client certificates. Defaults to 720h (30 days). Each renewal restarts dex to load
+	// the renewed certificates.
+	CertDuration *metav1.Duration `json:"certDuration,omitempty"`
+	// +optional
+	// How long before they expire the certificates are renewed. Defaults to 2h.
+	RenewBefore *metav1.Duration `json:"renewBefore,omitempty"`
+	// +optional
+	// Algorithm of the generated keys. Defaults to RSA2048. Changing it renews the CA.
+	KeyAlgorithm KeyAlgorithm `json:"keyAlgorithm,omitempty"`
+	// +optional
+	// Secret in the namespace of the DexServer holding the CA signing the server and client certificates in its
+	// tls.crt and tls.key, instead of a generated CA. Only the CA itself is trusted, not the CAs it chains up to.
+	// Changing it rotates the CA in stages. Only in SelfSigned mode.
+	CASecretRef *corev1.LocalObjectReference `json:"caSecretRef,omitempty"`
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	// The external consumers of the dex gRPC API, each is issued its own client certificate. Removing a consumer
+	// revokes its certificate, which dex keeps accepting until the CA is replaced when it is provided through
+	// caSecretRef. Only in SelfSigned mode, in CertManager mode consumers request their certificates from
+	// the issuer.
+	GRPCClients []GRPCClientSpec `json:"grpcClients,omitempty"`
+}
+
+// GRPCClientSpec declares an external consumer of the dex gRPC API
+type GRPCClientSpec struct {
+	// Name of the consumer, the common name of its client certificate. The certificate, its key and the trusted CAs
+	// are written to the grpc-client-<name> secret.
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	// +kubebuilder:validation:MaxLength=50
+	Name string `json:"name"`
+}
+
+// +kubebuilder:validation:Enum=RSA2048;RSA4096;ECDSAP256;ECDSAP384;Ed25519
+type KeyAlgorithm string
+
+const (
+	KeyAlgorithmRSA2048   KeyAlgorithm = "RSA2048"
+	KeyAlgorithmRSA4096   KeyAlgorithm = "RSA4096"
+	KeyAlgorithmECDSAP256 KeyAlgorithm = "ECDSAP256"
+	KeyAlgorithmECDSAP384 KeyAlgorithm = "ECDSAP384"
+	KeyAlgorithmEd25519   KeyAlgorithm = "Ed25519"
+)
+
+// MTLSRotationPhase is the step of the gRPC CA rotation in progress
+type MTLSRotationPhase string
+
+const (
+	// MTLSRotationPhaseStable: a single CA is trusted and signs the server and client certificates
+	MTLSRotationPhaseStable MTLSRotationPhase = "Stable"
+
+	// MTLSRotationPhaseTrustingNewCA: the new CA is added to the trusted CAs, the certificates are still signed by the
+	// previous CA until dex is rolled out with both
+	MTLSRotationPhaseTrustingNewCA MTLSRotationPhase = "TrustingNewCA"
+
+	// MTLSRotationPhaseReissuingCerts: the certificates are signed by the new CA, the previous CA is trusted until dex
+	// is rolled out with them
+	MTLSRotationPhaseReissuingCerts MTLSRotationPhase = "ReissuingCerts"
+)
+
+// MTLSStatus defines the observed state of the certificates securing the dex gRPC API
+type MTLSStatus struct {
+	// +optional
+	RotationPhase MTLSRotationPhase `json:"rotationPhase,omitempty"`
+	// Expiry of the CA signing the server and client certificates
+	// +optional
+	CAExpiry *metav1.Time `json:"caExpiry,omitempty"`
+	// Expiry of the server and client certificates
+	// +optional
+	CertExpiry *metav1.Time `json:"certExpiry,omitempty"`
 }
 
 const (
 	DexServerConditionTypeApplied string = "Applied"
 	DexServerDeploymentAvailable  string = "Available"
+	// DexServerConditionTypeMTLSCAExpiring is true when the CA referenced by spec.mtls.caSecretRef nears its expiry
+	DexServerConditionTypeMTLSCAExpiring string = "MTLSCAExpiring"
+	// DexServerConditionTypeGRPCClientsRevoked is false while dex still accepts the certificates of consumers removed
+	// from spec.mtls.grpcClients, signed by the CA referenced by spec.mtls.caSecretRef
+	DexServerConditionTypeGRPCClientsRevoked string = "GRPCClientsRevoked"
+	// DexServerConditionTypeRouteAccepted is true when the OpenShift router admits the Route, or the parent Gateway
+	// accepts the HTTPRoute and its BackendTLSPolicy, exposing the dex web endpoint
+	DexServerConditionTypeRouteAccepted string = "RouteAccepted"
 )
 
+// ExposureStatus defines the observed state of the exposure of the dex web endpoint
+type ExposureStatus struct {
+	// How the dex web endpoint is exposed
+	// +optional
+	Type ExposureType `json:"type,omitempty"`
+	// The host admitted by the OpenShift router, or accepted by the parent Gateway. Empty until the Route or the
+	// HTTPRoute is accepted.
+	// +optional
+	Host string `json:"host,omitempty"`
+	// The issuer of the tokens, the same whichever host dex is reached on
+	// +optional
+	Issuer string `json:"issuer,omitempty"`
+	// The hosts dex is reachable on besides the host of the issuer
+	// +optional
+	AdditionalHosts []string `json:"additionalHosts,omitempty"`
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
 // DexServerStatus defines the observed state of DexServer
 type DexServerStatus struct {
 	// +optional
@@ -219,6 +498,15 @@ type DexServerStatus struct {
 	Message string `json:"message,omitempty"`
 	// +optional
 	RelatedObjects []RelatedObjectReference `json:"relatedObjects,omitempty"`
+	// The IDs of the connectors applied through the dex API
+	// +optional
+	LiveConnectors []string `json:"liveConnectors,omitempty"`
+	// The certificates securing the dex gRPC API
+	// +optional
+	MTLS *MTLSStatus `json:"mtls,omitempty"`
+	// The exposure of the dex web endpoint
+	// +optional
+	Exposure *ExposureStatus `json:"exposure,omitempty"`
 	// Conditions contains the different condition statuses for this DexServer.
 	// +optional
 	Conditions []metav1.Condition `json:"conditions,omitempty"`
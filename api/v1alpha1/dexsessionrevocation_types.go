@@ -0,0 +1,97 @@
+// Copyright Red Hat
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DexSessionRevocationSpec defines the desired state of DexSessionRevocation
+type DexSessionRevocationSpec struct {
+	// +kubebuilder:validation:Required
+	// The DexServer holding the sessions of the user, in the namespace of the DexSessionRevocation
+	DexServerRef DexServerReference `json:"dexServerRef"`
+	// +optional
+	// The user ID dex issues in the sub claim of its ID tokens, which combines the ID of the user in the connector
+	// and the connector ID. Either userID, or email and connectorID, must be set.
+	UserID string `json:"userID,omitempty"`
+	// +optional
+	// The email of the user. The sessions are looked up in the refresh tokens held by the dex storage.
+	Email string `json:"email,omitempty"`
+	// +optional
+	// The ID of the connector the user logged in with, required with email
+	ConnectorID string `json:"connectorID,omitempty"`
+}
+
+// DexServerReference references a DexServer in the namespace of the referencing resource
+type DexServerReference struct {
+	// +kubebuilder:validation:Required
+	// Name of the DexServer
+	Name string `json:"name"`
+}
+
+// RevokedRefreshToken is a refresh token revoked in dex
+type RevokedRefreshToken struct {
+	// The user ID the refresh token was issued to
+	UserID string `json:"userID"`
+	// The client ID the refresh token was issued for
+	ClientID string `json:"clientID"`
+	// The ID of the refresh token
+	// +optional
+	ID string `json:"id,omitempty"`
+	// When the refresh token was created
+	// +optional
+	CreatedAt *metav1.Time `json:"createdAt,omitempty"`
+	// When the refresh token was last used
+	// +optional
+	LastUsed *metav1.Time `json:"lastUsed,omitempty"`
+}
+
+const (
+	DexSessionRevocationConditionTypeComplete string = "Complete"
+)
+
+// DexSessionRevocationStatus defines the observed state of DexSessionRevocation
+type DexSessionRevocationStatus struct {
+	// The user IDs the sessions were revoked for
+	// +optional
+	UserIDs []string `json:"userIDs,omitempty"`
+	// The refresh tokens revoked in dex
+	// +optional
+	RevokedRefreshTokens []RevokedRefreshToken `json:"revokedRefreshTokens,omitempty"`
+	// When the revocation completed
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// Conditions contains the different condition statuses for this DexSessionRevocation.
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Complete",type=string,JSONPath=`.status.conditions[?(@.type=="Complete")].status`
+//+kubebuilder:printcolumn:name="DexServer",type=string,JSONPath=`.spec.dexServerRef.name`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// DexSessionRevocation is the Schema for the dexsessionrevocations API. It revokes once all the refresh tokens dex
+// holds for a user.
+type DexSessionRevocation struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   DexSessionRevocationSpec   `json:"spec,omitempty"`
+	Status DexSessionRevocationStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// DexSessionRevocationList contains a list of DexSessionRevocation
+type DexSessionRevocationList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []DexSessionRevocation `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&DexSessionRevocation{}, &DexSessionRevocationList{})
+}
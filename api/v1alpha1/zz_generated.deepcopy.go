@@ -22,10 +22,63 @@ limitations under the License.
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AdditionalHostSpec) DeepCopyInto(out *AdditionalHostSpec) {
+	*out = *in
+	out.CertificateRef = in.CertificateRef
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AdditionalHostSpec.
+func (in *AdditionalHostSpec) DeepCopy() *AdditionalHostSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(AdditionalHostSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CertManagerIssuerReference) DeepCopyInto(out *CertManagerIssuerReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CertManagerIssuerReference.
+func (in *CertManagerIssuerReference) DeepCopy() *CertManagerIssuerReference {
+	if in == nil {
+		return nil
+	}
+	out := new(CertManagerIssuerReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CertificateIssuerSpec) DeepCopyInto(out *CertificateIssuerSpec) {
+	*out = *in
+	if in.IssuerRef != nil {
+		in, out := &in.IssuerRef, &out.IssuerRef
+		*out = new(CertManagerIssuerReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CertificateIssuerSpec.
+func (in *CertificateIssuerSpec) DeepCopy() *CertificateIssuerSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(CertificateIssuerSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClaimMappingSpec) DeepCopyInto(out *ClaimMappingSpec) {
 	*out = *in
@@ -119,6 +172,21 @@ func (in *DexClientList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DexClientReference) DeepCopyInto(out *DexClientReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DexClientReference.
+func (in *DexClientReference) DeepCopy() *DexClientReference {
+	if in == nil {
+		return nil
+	}
+	out := new(DexClientReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DexClientSpec) DeepCopyInto(out *DexClientSpec) {
 	*out = *in
@@ -128,11 +196,31 @@ func (in *DexClientSpec) DeepCopyInto(out *DexClientSpec) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.RedirectURITemplates != nil {
+		in, out := &in.RedirectURITemplates, &out.RedirectURITemplates
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.RedirectURISource != nil {
+		in, out := &in.RedirectURISource, &out.RedirectURISource
+		*out = new(RedirectURISource)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.TrustedPeers != nil {
 		in, out := &in.TrustedPeers, &out.TrustedPeers
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.TrustedPeerRefs != nil {
+		in, out := &in.TrustedPeerRefs, &out.TrustedPeerRefs
+		*out = make([]DexClientReference, len(*in))
+		copy(*out, *in)
+	}
+	if in.AllowedConnectors != nil {
+		in, out := &in.AllowedConnectors, &out.AllowedConnectors
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DexClientSpec.
@@ -148,6 +236,25 @@ func (in *DexClientSpec) DeepCopy() *DexClientSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DexClientStatus) DeepCopyInto(out *DexClientStatus) {
 	*out = *in
+	if in.DexServerRef != nil {
+		in, out := &in.DexServerRef, &out.DexServerRef
+		*out = new(RelatedObjectReference)
+		**out = **in
+	}
+	if in.LastSyncedTime != nil {
+		in, out := &in.LastSyncedTime, &out.LastSyncedTime
+		*out = (*in).DeepCopy()
+	}
+	if in.GeneratedRedirectURIs != nil {
+		in, out := &in.GeneratedRedirectURIs, &out.GeneratedRedirectURIs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ResolvedTrustedPeers != nil {
+		in, out := &in.ResolvedTrustedPeers, &out.ResolvedTrustedPeers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	if in.RelatedObjects != nil {
 		in, out := &in.RelatedObjects, &out.RelatedObjects
 		*out = make([]RelatedObjectReference, len(*in))
@@ -231,6 +338,21 @@ func (in *DexServerList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DexServerReference) DeepCopyInto(out *DexServerReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DexServerReference.
+func (in *DexServerReference) DeepCopy() *DexServerReference {
+	if in == nil {
+		return nil
+	}
+	out := new(DexServerReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DexServerSpec) DeepCopyInto(out *DexServerSpec) {
 	*out = *in
@@ -242,6 +364,36 @@ func (in *DexServerSpec) DeepCopyInto(out *DexServerSpec) {
 		}
 	}
 	out.IngressCertificateRef = in.IngressCertificateRef
+	if in.MTLS != nil {
+		in, out := &in.MTLS, &out.MTLS
+		*out = new(MTLSSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.CertificateIssuer != nil {
+		in, out := &in.CertificateIssuer, &out.CertificateIssuer
+		*out = new(CertificateIssuerSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.AdditionalHosts != nil {
+		in, out := &in.AdditionalHosts, &out.AdditionalHosts
+		*out = make([]AdditionalHostSpec, len(*in))
+		copy(*out, *in)
+	}
+	if in.Ingress != nil {
+		in, out := &in.Ingress, &out.Ingress
+		*out = new(IngressSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Route != nil {
+		in, out := &in.Route, &out.Route
+		*out = new(RouteSpec)
+		**out = **in
+	}
+	if in.Gateway != nil {
+		in, out := &in.Gateway, &out.Gateway
+		*out = new(GatewaySpec)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DexServerSpec.
@@ -262,6 +414,21 @@ func (in *DexServerStatus) DeepCopyInto(out *DexServerStatus) {
 		*out = make([]RelatedObjectReference, len(*in))
 		copy(*out, *in)
 	}
+	if in.LiveConnectors != nil {
+		in, out := &in.LiveConnectors, &out.LiveConnectors
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.MTLS != nil {
+		in, out := &in.MTLS, &out.MTLS
+		*out = new(MTLSStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Exposure != nil {
+		in, out := &in.Exposure, &out.Exposure
+		*out = new(ExposureStatus)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.Conditions != nil {
 		in, out := &in.Conditions, &out.Conditions
 		*out = make([]v1.Condition, len(*in))
@@ -281,6 +448,174 @@ func (in *DexServerStatus) DeepCopy() *DexServerStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DexSessionRevocation) DeepCopyInto(out *DexSessionRevocation) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DexSessionRevocation.
+func (in *DexSessionRevocation) DeepCopy() *DexSessionRevocation {
+	if in == nil {
+		return nil
+	}
+	out := new(DexSessionRevocation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *DexSessionRevocation) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DexSessionRevocationList) DeepCopyInto(out *DexSessionRevocationList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]DexSessionRevocation, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DexSessionRevocationList.
+func (in *DexSessionRevocationList) DeepCopy() *DexSessionRevocationList {
+	if in == nil {
+		return nil
+	}
+	out := new(DexSessionRevocationList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *DexSessionRevocationList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DexSessionRevocationSpec) DeepCopyInto(out *DexSessionRevocationSpec) {
+	*out = *in
+	out.DexServerRef = in.DexServerRef
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DexSessionRevocationSpec.
+func (in *DexSessionRevocationSpec) DeepCopy() *DexSessionRevocationSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(DexSessionRevocationSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DexSessionRevocationStatus) DeepCopyInto(out *DexSessionRevocationStatus) {
+	*out = *in
+	if in.UserIDs != nil {
+		in, out := &in.UserIDs, &out.UserIDs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.RevokedRefreshTokens != nil {
+		in, out := &in.RevokedRefreshTokens, &out.RevokedRefreshTokens
+		*out = make([]RevokedRefreshToken, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DexSessionRevocationStatus.
+func (in *DexSessionRevocationStatus) DeepCopy() *DexSessionRevocationStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(DexSessionRevocationStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExposureStatus) DeepCopyInto(out *ExposureStatus) {
+	*out = *in
+	if in.AdditionalHosts != nil {
+		in, out := &in.AdditionalHosts, &out.AdditionalHosts
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExposureStatus.
+func (in *ExposureStatus) DeepCopy() *ExposureStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ExposureStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GRPCClientSpec) DeepCopyInto(out *GRPCClientSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GRPCClientSpec.
+func (in *GRPCClientSpec) DeepCopy() *GRPCClientSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(GRPCClientSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GatewaySpec) DeepCopyInto(out *GatewaySpec) {
+	*out = *in
+	if in.Port != nil {
+		in, out := &in.Port, &out.Port
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GatewaySpec.
+func (in *GatewaySpec) DeepCopy() *GatewaySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(GatewaySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *GitHubConfigSpec) DeepCopyInto(out *GitHubConfigSpec) {
 	*out = *in
@@ -324,6 +659,45 @@ func (in *GroupSearchSpec) DeepCopy() *GroupSearchSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IngressSpec) DeepCopyInto(out *IngressSpec) {
+	*out = *in
+	if in.IngressClassName != nil {
+		in, out := &in.IngressClassName, &out.IngressClassName
+		*out = new(string)
+		**out = **in
+	}
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.TLS != nil {
+		in, out := &in.TLS, &out.TLS
+		*out = make([]networkingv1.IngressTLS, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ExtraHosts != nil {
+		in, out := &in.ExtraHosts, &out.ExtraHosts
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IngressSpec.
+func (in *IngressSpec) DeepCopy() *IngressSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(IngressSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *LDAPConfigSpec) DeepCopyInto(out *LDAPConfigSpec) {
 	*out = *in
@@ -348,6 +722,69 @@ func (in *LDAPConfigSpec) DeepCopy() *LDAPConfigSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MTLSSpec) DeepCopyInto(out *MTLSSpec) {
+	*out = *in
+	if in.CADuration != nil {
+		in, out := &in.CADuration, &out.CADuration
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.CertDuration != nil {
+		in, out := &in.CertDuration, &out.CertDuration
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.RenewBefore != nil {
+		in, out := &in.RenewBefore, &out.RenewBefore
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.CASecretRef != nil {
+		in, out := &in.CASecretRef, &out.CASecretRef
+		*out = new(corev1.LocalObjectReference)
+		**out = **in
+	}
+	if in.GRPCClients != nil {
+		in, out := &in.GRPCClients, &out.GRPCClients
+		*out = make([]GRPCClientSpec, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MTLSSpec.
+func (in *MTLSSpec) DeepCopy() *MTLSSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(MTLSSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MTLSStatus) DeepCopyInto(out *MTLSStatus) {
+	*out = *in
+	if in.CAExpiry != nil {
+		in, out := &in.CAExpiry, &out.CAExpiry
+		*out = (*in).DeepCopy()
+	}
+	if in.CertExpiry != nil {
+		in, out := &in.CertExpiry, &out.CertExpiry
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MTLSStatus.
+func (in *MTLSStatus) DeepCopy() *MTLSStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(MTLSStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MicrosoftConfigSpec) DeepCopyInto(out *MicrosoftConfigSpec) {
 	*out = *in
@@ -406,6 +843,26 @@ func (in *Org) DeepCopy() *Org {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RedirectURISource) DeepCopyInto(out *RedirectURISource) {
+	*out = *in
+	if in.Selector != nil {
+		in, out := &in.Selector, &out.Selector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RedirectURISource.
+func (in *RedirectURISource) DeepCopy() *RedirectURISource {
+	if in == nil {
+		return nil
+	}
+	out := new(RedirectURISource)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RelatedObjectReference) DeepCopyInto(out *RelatedObjectReference) {
 	*out = *in
@@ -421,6 +878,44 @@ func (in *RelatedObjectReference) DeepCopy() *RelatedObjectReference {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RevokedRefreshToken) DeepCopyInto(out *RevokedRefreshToken) {
+	*out = *in
+	if in.CreatedAt != nil {
+		in, out := &in.CreatedAt, &out.CreatedAt
+		*out = (*in).DeepCopy()
+	}
+	if in.LastUsed != nil {
+		in, out := &in.LastUsed, &out.LastUsed
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RevokedRefreshToken.
+func (in *RevokedRefreshToken) DeepCopy() *RevokedRefreshToken {
+	if in == nil {
+		return nil
+	}
+	out := new(RevokedRefreshToken)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RouteSpec) DeepCopyInto(out *RouteSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RouteSpec.
+func (in *RouteSpec) DeepCopy() *RouteSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(RouteSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *UserMatcher) DeepCopyInto(out *UserMatcher) {
 	*out = *in
@@ -0,0 +1,86 @@
+// Copyright Red Hat
+
+// dexclient-import creates DexClients for the oauth2clients already held by a dex server, so that they are managed
+// by the dex operator from then on.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
+	_ "k8s.io/client-go/plugin/pkg/client/auth"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+	"github.com/identitatem/dex-operator/controllers"
+	dexapi "github.com/identitatem/dex-operator/controllers/dex"
+)
+
+var (
+	scheme = runtime.NewScheme()
+	log    = ctrl.Log.WithName("dexclient-import")
+)
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(authv1alpha1.AddToScheme(scheme))
+}
+
+func main() {
+	var namespace string
+	var dryRun bool
+	var dexAddress string
+	flag.StringVar(&namespace, "namespace", "", "The namespace of the DexServer whose oauth2clients are imported.")
+	flag.StringVar(&dexAddress, "dex-address", "", "The address of the dex gRPC API, e.g. localhost:5557 through a port-forward. "+
+		"Defaults to the gRPC service of the DexServer.")
+	flag.BoolVar(&dryRun, "dry-run", false, "List the DexClients which would be created without creating them.")
+	opts := zap.Options{
+		Development: true,
+	}
+	opts.BindFlags(flag.CommandLine)
+	flag.Parse()
+
+	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
+
+	if namespace == "" {
+		log.Error(fmt.Errorf("--namespace is required"), "invalid arguments")
+		os.Exit(1)
+	}
+
+	c, err := client.New(ctrl.GetConfigOrDie(), client.Options{Scheme: scheme})
+	if err != nil {
+		log.Error(err, "unable to create client")
+		os.Exit(1)
+	}
+
+	ctx := ctrl.LoggerInto(context.Background(), log)
+	dexOpts, err := controllers.ImportDexAPIOptions(ctx, c, namespace, dexAddress)
+	if err != nil {
+		log.Error(err, "unable to read the dex gRPC credentials")
+		os.Exit(1)
+	}
+	dexAPI, err := dexapi.NewDexAPI(ctx, dexOpts)
+	if err != nil {
+		log.Error(err, "unable to connect to dex")
+		os.Exit(1)
+	}
+
+	imported, err := controllers.ImportOAuth2Clients(ctx, c, dexAPI, namespace, dryRun)
+	_ = dexAPI.CloseConnection()
+	for _, dexClient := range imported {
+		fmt.Printf("%s/%s\t%s\n", dexClient.Namespace, dexClient.Name, dexClient.Spec.ClientID)
+	}
+	if err != nil {
+		log.Error(err, "import failed")
+		os.Exit(1)
+	}
+}
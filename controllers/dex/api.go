@@ -0,0 +1,265 @@
+// Copyright Red Hat
+
+package dex
+
+import (
+	"context"
+	"fmt"
+
+	api "github.com/dexidp/dex/api/v2"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+)
+
+// DexAPI is the dex API the controllers depend on. APIClient implements it on top of the dex gRPC API, see rpc.go for
+// the calls dex added after the API module in use.
+type DexAPI interface {
+	GetServerInfo(ctx context.Context) (string, error)
+	GetDiscovery(ctx context.Context) (*DiscoveryResp, error)
+
+	CreateClient(ctx context.Context, redirectUris []string, trustedPeers []string,
+		public bool, name string, id string, logoURL string, secret string) (*api.Client, error)
+	UpdateClient(ctx context.Context, clientID string, redirectUris []string,
+		trustedPeers []string, name string, logoURL string) error
+	DeleteClient(ctx context.Context, id string) error
+	GetClient(ctx context.Context, id string) (*api.Client, error)
+	ListClients(ctx context.Context) ([]*ClientInfo, error)
+
+	CreatePassword(ctx context.Context, password *api.Password) error
+	UpdatePassword(ctx context.Context, email string, newHash []byte, newUsername string) error
+	DeletePassword(ctx context.Context, email string) error
+	ListPasswords(ctx context.Context) ([]*api.Password, error)
+	VerifyPassword(ctx context.Context, email string, password string) (bool, error)
+
+	ListRefresh(ctx context.Context, userID string) ([]*api.RefreshTokenRef, error)
+	RevokeRefresh(ctx context.Context, userID string, clientID string) error
+
+	CreateConnector(ctx context.Context, connector *Connector) error
+	UpdateConnector(ctx context.Context, connector *Connector) error
+	DeleteConnector(ctx context.Context, id string) error
+	ListConnectors(ctx context.Context) ([]*Connector, error)
+
+	CloseConnection() error
+}
+
+var _ DexAPI = &APIClient{}
+
+// NewDexAPI opens a connection to a dex server, see NewClientPEMContext
+func NewDexAPI(ctx context.Context, opts *Options) (DexAPI, error) {
+	c, err := NewClientPEMContext(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// CreatePassword adds a static password to dex. The error reports AlreadyExists when dex already holds a password
+// for the email.
+func (c *APIClient) CreatePassword(ctx context.Context, password *api.Password) error {
+	op := "failed to create the password"
+	res, err := c.Dex.CreatePassword(ctx, &api.CreatePasswordReq{Password: password})
+	if err != nil {
+		return newError(op, err)
+	}
+	if res.AlreadyExists {
+		return &Error{Op: op, Code: codes.AlreadyExists, Err: errors.Errorf("password for %q already exists", password.Email)}
+	}
+	return nil
+}
+
+// UpdatePassword updates the hash and username of the static password of email
+func (c *APIClient) UpdatePassword(ctx context.Context, email string, newHash []byte, newUsername string) error {
+	op := "failed to update the password"
+	req := &api.UpdatePasswordReq{Email: email, NewHash: newHash, NewUsername: newUsername}
+	var res *api.UpdatePasswordResp
+	err := c.retryPolicy().do(ctx, func(ctx context.Context) (err error) {
+		res, err = c.Dex.UpdatePassword(ctx, req)
+		return err
+	})
+	if err != nil {
+		return newError(op, err)
+	}
+	if res.NotFound {
+		return &Error{Op: op, Code: codes.NotFound, Err: errors.Errorf("password for %q not found", email)}
+	}
+	return nil
+}
+
+// DeletePassword deletes the static password of email
+func (c *APIClient) DeletePassword(ctx context.Context, email string) error {
+	op := "failed to delete the password"
+	req := &api.DeletePasswordReq{Email: email}
+	var res *api.DeletePasswordResp
+	err := c.retryPolicy().do(ctx, func(ctx context.Context) (err error) {
+		res, err = c.Dex.DeletePassword(ctx, req)
+		return err
+	})
+	if err != nil {
+		return newError(op, err)
+	}
+	if res.NotFound {
+		return &Error{Op: op, Code: codes.NotFound, Err: errors.Errorf("password for %q not found", email)}
+	}
+	return nil
+}
+
+// ListPasswords lists the static passwords of dex
+func (c *APIClient) ListPasswords(ctx context.Context) ([]*api.Password, error) {
+	var res *api.ListPasswordResp
+	err := c.retryPolicy().do(ctx, func(ctx context.Context) (err error) {
+		res, err = c.Dex.ListPasswords(ctx, &api.ListPasswordReq{})
+		return err
+	})
+	if err != nil {
+		return nil, newError("failed to list the passwords", err)
+	}
+	return res.GetPasswords(), nil
+}
+
+// VerifyPassword checks password against the static password of email
+func (c *APIClient) VerifyPassword(ctx context.Context, email string, password string) (bool, error) {
+	op := "failed to verify the password"
+	req := &api.VerifyPasswordReq{Email: email, Password: password}
+	var res *api.VerifyPasswordResp
+	err := c.retryPolicy().do(ctx, func(ctx context.Context) (err error) {
+		res, err = c.Dex.VerifyPassword(ctx, req)
+		return err
+	})
+	if err != nil {
+		return false, newError(op, err)
+	}
+	if res.NotFound {
+		return false, &Error{Op: op, Code: codes.NotFound, Err: errors.Errorf("password for %q not found", email)}
+	}
+	return res.Verified, nil
+}
+
+// ListRefresh lists the refresh tokens dex holds for the user
+func (c *APIClient) ListRefresh(ctx context.Context, userID string) ([]*api.RefreshTokenRef, error) {
+	req := &api.ListRefreshReq{UserId: userID}
+	var res *api.ListRefreshResp
+	err := c.retryPolicy().do(ctx, func(ctx context.Context) (err error) {
+		res, err = c.Dex.ListRefresh(ctx, req)
+		return err
+	})
+	if err != nil {
+		return nil, newError("failed to list the refresh tokens", err)
+	}
+	return res.GetRefreshTokens(), nil
+}
+
+// RevokeRefresh revokes the refresh token of the user for the client
+func (c *APIClient) RevokeRefresh(ctx context.Context, userID string, clientID string) error {
+	op := "failed to revoke the refresh token"
+	req := &api.RevokeRefreshReq{UserId: userID, ClientId: clientID}
+	var res *api.RevokeRefreshResp
+	err := c.retryPolicy().do(ctx, func(ctx context.Context) (err error) {
+		res, err = c.Dex.RevokeRefresh(ctx, req)
+		return err
+	})
+	if err != nil {
+		return newError(op, err)
+	}
+	if res.NotFound {
+		return &Error{Op: op, Code: codes.NotFound, Err: errors.Errorf("no refresh token of client %q for user %q", clientID, userID)}
+	}
+	return nil
+}
+
+// CreateConnector adds a connector to dex. The error reports AlreadyExists when dex already holds a connector with the
+// id.
+func (c *APIClient) CreateConnector(ctx context.Context, connector *Connector) error {
+	op := "failed to create the connector"
+	res := &CreateConnectorResp{}
+	if err := c.invoke(ctx, createConnectorMethod, &CreateConnectorReq{Connector: connector}, res); err != nil {
+		return newError(op, err)
+	}
+	if res.AlreadyExists {
+		return &Error{Op: op, Code: codes.AlreadyExists, Err: errors.Errorf("connector %q already exists", connector.Id)}
+	}
+	return nil
+}
+
+// UpdateConnector replaces the type, name and configuration of the connector with the same id
+func (c *APIClient) UpdateConnector(ctx context.Context, connector *Connector) error {
+	op := "failed to update the connector"
+	req := &UpdateConnectorReq{Id: connector.Id, NewType: connector.Type, NewName: connector.Name, NewConfig: connector.Config}
+	res := &UpdateConnectorResp{}
+	err := c.retryPolicy().do(ctx, func(ctx context.Context) error {
+		return c.invoke(ctx, updateConnectorMethod, req, res)
+	})
+	if err != nil {
+		return newError(op, err)
+	}
+	if res.NotFound {
+		return &Error{Op: op, Code: codes.NotFound, Err: errors.Errorf("connector %q not found", connector.Id)}
+	}
+	return nil
+}
+
+// DeleteConnector deletes the connector with the given id
+func (c *APIClient) DeleteConnector(ctx context.Context, id string) error {
+	op := "failed to delete the connector"
+	req := &DeleteConnectorReq{Id: id}
+	res := &DeleteConnectorResp{}
+	err := c.retryPolicy().do(ctx, func(ctx context.Context) error {
+		return c.invoke(ctx, deleteConnectorMethod, req, res)
+	})
+	if err != nil {
+		return newError(op, err)
+	}
+	if res.NotFound {
+		return &Error{Op: op, Code: codes.NotFound, Err: errors.Errorf("connector %q not found", id)}
+	}
+	return nil
+}
+
+// ListConnectors lists the connectors of dex, the ones of its configuration file included
+func (c *APIClient) ListConnectors(ctx context.Context) ([]*Connector, error) {
+	res := &ListConnectorResp{}
+	err := c.retryPolicy().do(ctx, func(ctx context.Context) error {
+		return c.invoke(ctx, listConnectorsMethod, &ListConnectorReq{}, res)
+	})
+	if err != nil {
+		return nil, newError("failed to list the connectors", err)
+	}
+	return res.Connectors, nil
+}
+
+// GetClient reads the client with the given id, its secret included
+func (c *APIClient) GetClient(ctx context.Context, id string) (*api.Client, error) {
+	op := fmt.Sprintf("failed to get the client with id %q", id)
+	req := &GetClientReq{Id: id}
+	res := &GetClientResp{}
+	err := c.retryPolicy().do(ctx, func(ctx context.Context) error {
+		return c.invoke(ctx, getClientMethod, req, res)
+	})
+	if err != nil {
+		return nil, newError(op, err)
+	}
+	return res.Client, nil
+}
+
+// ListClients lists the clients of dex, without their secrets
+func (c *APIClient) ListClients(ctx context.Context) ([]*ClientInfo, error) {
+	res := &ListClientResp{}
+	err := c.retryPolicy().do(ctx, func(ctx context.Context) error {
+		return c.invoke(ctx, listClientsMethod, &ListClientReq{}, res)
+	})
+	if err != nil {
+		return nil, newError("failed to list the clients", err)
+	}
+	return res.Clients, nil
+}
+
+// GetDiscovery returns the OpenID Connect discovery document dex serves
+func (c *APIClient) GetDiscovery(ctx context.Context) (*DiscoveryResp, error) {
+	res := &DiscoveryResp{}
+	err := c.retryPolicy().do(ctx, func(ctx context.Context) error {
+		return c.invoke(ctx, getDiscoveryMethod, &DiscoveryReq{}, res)
+	})
+	if err != nil {
+		return nil, newError("failed to get the discovery document", err)
+	}
+	return res, nil
+}
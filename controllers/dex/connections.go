@@ -0,0 +1,236 @@
+// Copyright Red Hat
+
+package dex
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/connectivity"
+)
+
+// ConnectionManager caches one DexAPI per dex server, so that reconciles share a long-lived gRPC connection
+// instead of dialing and closing one each time. Connections are keyed by endpoint and by the fingerprint of the mTLS
+// certificates: when the certificates are rotated, the next Get opens a new connection and the old one is closed once
+// the callers still using it have released it.
+type ConnectionManager struct {
+	// NewClient opens a connection to a dex server, giving up when ctx is done
+	NewClient func(ctx context.Context, opts *Options) (DexAPI, error)
+	// IdleTimeout is how long an unused connection is kept open
+	IdleTimeout time.Duration
+	// DialTimeout bounds how long opening a connection may take
+	DialTimeout time.Duration
+	// RetryPolicy is given to the connections whose Options set none, DefaultRetryPolicy applies when nil
+	RetryPolicy *RetryPolicy
+
+	mu      sync.Mutex
+	clients map[string]*managedClient
+	// The connections being opened, keyed by endpoint and fingerprint. Callers asking for the same connection wait for
+	// the one being opened rather than opening their own.
+	dialing map[string]*dialCall
+}
+
+type managedClient struct {
+	client      DexAPI
+	fingerprint string
+	lastUsed    time.Time
+	// users counts the callers which have not released the client yet
+	users int
+	// retired is set once the client is replaced, it is closed when the last user releases it
+	retired bool
+	closed  bool
+}
+
+type dialCall struct {
+	done    chan struct{}
+	managed *managedClient
+	err     error
+}
+
+// NewConnectionManager returns a ConnectionManager opening connections with newClient
+func NewConnectionManager(newClient func(ctx context.Context, opts *Options) (DexAPI, error)) *ConnectionManager {
+	return &ConnectionManager{
+		NewClient:   newClient,
+		IdleTimeout: 30 * time.Minute,
+		DialTimeout: DialTimeout,
+		clients:     map[string]*managedClient{},
+		dialing:     map[string]*dialCall{},
+	}
+}
+
+// Get returns the DexAPI of the dex server at opts.HostAndPort. A new connection is opened when there is none yet,
+// when the certificates in opts differ from the ones of the cached connection, or when the cached connection is
+// no longer healthy. Connections are opened without holding the lock, so that an unreachable dex server only delays
+// the callers asking for it, and Get returns the error of ctx as soon as it is done. The connection being opened is
+// left to DialTimeout then, so that the other callers waiting for it are not failed. The returned client must not be
+// closed by the caller, which calls the returned release function instead once it is done with the client.
+func (m *ConnectionManager) Get(ctx context.Context, opts *Options) (DexAPI, func(), error) {
+	if opts.RetryPolicy == nil && m.RetryPolicy != nil {
+		withRetryPolicy := *opts
+		withRetryPolicy.RetryPolicy = m.RetryPolicy
+		opts = &withRetryPolicy
+	}
+	fingerprint := Fingerprint(opts)
+
+	for {
+		m.mu.Lock()
+		now := time.Now()
+		m.closeIdle(now)
+
+		if cached, ok := m.clients[opts.HostAndPort]; ok {
+			if cached.fingerprint == fingerprint && isHealthy(cached.client) {
+				return m.lease(cached, now)
+			}
+			// The certificates were rotated or the connection failed, replace it
+			m.retire(opts.HostAndPort, cached)
+		}
+
+		key := opts.HostAndPort + "/" + fingerprint
+		call, dialing := m.dialing[key]
+		if !dialing {
+			call = &dialCall{done: make(chan struct{})}
+			m.dialing[key] = call
+		}
+		m.mu.Unlock()
+
+		if !dialing {
+			go m.dial(key, fingerprint, opts, call)
+		}
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+
+		if call.err != nil {
+			return nil, nil, call.err
+		}
+		m.mu.Lock()
+		if !call.managed.closed {
+			return m.lease(call.managed, time.Now())
+		}
+		// The connection was replaced and closed before this caller got it, look again
+		m.mu.Unlock()
+	}
+}
+
+// Open a connection and cache it, then wake up the callers waiting for it
+func (m *ConnectionManager) dial(key string, fingerprint string, opts *Options, call *dialCall) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.DialTimeout)
+	defer cancel()
+	client, err := m.NewClient(ctx, opts)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.dialing, key)
+	if err != nil {
+		call.err = err
+	} else {
+		if current, ok := m.clients[opts.HostAndPort]; ok {
+			m.retire(opts.HostAndPort, current)
+		}
+		// Counted as used now, so that it is not closed as idle before a caller gets it
+		call.managed = &managedClient{client: client, fingerprint: fingerprint, lastUsed: time.Now()}
+		m.clients[opts.HostAndPort] = call.managed
+	}
+	close(call.done)
+}
+
+// Hand out a client to a caller, m.mu is held and released
+func (m *ConnectionManager) lease(managed *managedClient, now time.Time) (DexAPI, func(), error) {
+	defer m.mu.Unlock()
+	managed.lastUsed = now
+	managed.users++
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			managed.users--
+			if managed.retired && managed.users == 0 {
+				managed.close()
+			}
+		})
+	}
+	return managed.client, release, nil
+}
+
+// Remove a client from the cache, it is closed at once when no caller uses it. m.mu is held.
+func (m *ConnectionManager) retire(hostAndPort string, managed *managedClient) {
+	if m.clients[hostAndPort] == managed {
+		delete(m.clients, hostAndPort)
+	}
+	if managed.retired {
+		return
+	}
+	managed.retired = true
+	if managed.users == 0 {
+		managed.close()
+	}
+}
+
+func (managed *managedClient) close() {
+	if !managed.closed {
+		managed.closed = true
+		_ = managed.client.CloseConnection()
+	}
+}
+
+// Invalidate closes the connection to the dex server at hostAndPort, the next Get opens a new one
+func (m *ConnectionManager) Invalidate(hostAndPort string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if cached, ok := m.clients[hostAndPort]; ok {
+		m.retire(hostAndPort, cached)
+	}
+}
+
+// Close closes all connections, including the ones still in use
+func (m *ConnectionManager) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for hostAndPort, cached := range m.clients {
+		cached.retired = true
+		cached.close()
+		delete(m.clients, hostAndPort)
+	}
+}
+
+func (m *ConnectionManager) closeIdle(now time.Time) {
+	if m.IdleTimeout <= 0 {
+		return
+	}
+	for hostAndPort, cached := range m.clients {
+		if cached.users == 0 && now.Sub(cached.lastUsed) > m.IdleTimeout {
+			m.retire(hostAndPort, cached)
+		}
+	}
+}
+
+// A connection is healthy unless it is shut down or failing to connect. Idle and connecting connections recover on
+// the next call.
+func isHealthy(dexAPI DexAPI) bool {
+	c, ok := dexAPI.(*APIClient)
+	if !ok || c.Cc == nil {
+		return true
+	}
+	switch c.Cc.GetState() {
+	case connectivity.Shutdown, connectivity.TransientFailure:
+		return false
+	}
+	return true
+}
+
+// Fingerprint returns the SHA-256 fingerprint of the certificates and key in opts
+func Fingerprint(opts *Options) string {
+	h := sha256.New()
+	for _, buf := range [][]byte{bufferBytes(opts.CABuffer), bufferBytes(opts.CrtBuffer), bufferBytes(opts.KeyBuffer)} {
+		h.Write(buf)
+		// Separate the buffers so that moving bytes between them changes the fingerprint
+		h.Write([]byte{0})
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
@@ -8,13 +8,26 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
+	"time"
 
 	api "github.com/dexidp/dex/api/v2"
 	"github.com/pkg/errors"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
 )
 
+// DialTimeout bounds how long opening a connection to a dex server may block
+var DialTimeout = 10 * time.Second
+
+// Dex does not configure a keepalive enforcement policy, so the gRPC server defaults apply: pings must be at least
+// 5 minutes apart and are only allowed while calls are in flight.
+var keepaliveParams = keepalive.ClientParameters{
+	Time:    5 * time.Minute,
+	Timeout: 20 * time.Second,
+}
+
 // Options keeps some configuration options for Dex client
 type Options struct {
 	// HostAndPort host name and port of gRPC server
@@ -25,15 +38,28 @@ type Options struct {
 	KeyBuffer *bytes.Buffer
 	// ClientCA self signed CA certificate for gRPC TLS connection
 	CABuffer *bytes.Buffer
+	// ServerName the certificate of the gRPC server is verified against, the host of HostAndPort when empty
+	ServerName string
+	// RetryPolicy of the idempotent calls, DefaultRetryPolicy when nil
+	RetryPolicy *RetryPolicy
 }
 
 // APIClient represent a client wrapper for Dex
 type APIClient struct {
 	Dex api.DexClient
 	Cc  *grpc.ClientConn
+	// RetryPolicy of the idempotent calls, DefaultRetryPolicy when nil
+	RetryPolicy *RetryPolicy
 }
 
+// NewClientPEM opens a connection to a dex server, waiting at most DialTimeout
 func NewClientPEM(opts *Options) (*APIClient, error) {
+	return NewClientPEMContext(context.Background(), opts)
+}
+
+// NewClientPEMContext opens a connection to a dex server with the PEM encoded certificates of opts. It blocks until
+// the connection is up or ctx is done, DialTimeout applies when ctx has no deadline.
+func NewClientPEMContext(ctx context.Context, opts *Options) (*APIClient, error) {
 	certPool := x509.NewCertPool()
 	appended := certPool.AppendCertsFromPEM(opts.CABuffer.Bytes())
 	if !appended {
@@ -49,41 +75,54 @@ func NewClientPEM(opts *Options) (*APIClient, error) {
 	clientTLSConfig := &tls.Config{
 		RootCAs:      certPool,
 		Certificates: []tls.Certificate{clientCert},
+		ServerName:   opts.ServerName,
 	}
 	creds := credentials.NewTLS(clientTLSConfig)
 
-	conn, err := grpc.Dial(opts.HostAndPort, grpc.WithTransportCredentials(creds), grpc.WithBlock(), grpc.FailOnNonTempDialError(true))
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DialTimeout)
+		defer cancel()
+	}
+	conn, err := grpc.DialContext(ctx, opts.HostAndPort,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithBlock(),
+		grpc.FailOnNonTempDialError(true),
+		grpc.WithKeepaliveParams(keepaliveParams))
 	if err != nil {
 		return nil, errors.Wrapf(err, "opening the gRPC connection with server %q", opts.HostAndPort)
 	}
 	return &APIClient{
-		Dex: api.NewDexClient(conn),
-		Cc:  conn,
+		Dex:         api.NewDexClient(conn),
+		Cc:          conn,
+		RetryPolicy: opts.RetryPolicy,
 	}, nil
 }
 
+func (c *APIClient) retryPolicy() *RetryPolicy {
+	if c.RetryPolicy != nil {
+		return c.RetryPolicy
+	}
+	return &DefaultRetryPolicy
+}
+
 // GetServerInfo returns server info
 func (c *APIClient) GetServerInfo(ctx context.Context) (string, error) {
 	req := &api.VersionReq{}
-	res, err := c.Dex.GetVersion(ctx, req)
+	var res *api.VersionResp
+	err := c.retryPolicy().do(ctx, func(ctx context.Context) (err error) {
+		res, err = c.Dex.GetVersion(ctx, req)
+		return err
+	})
 	if err != nil {
-		return "", errors.Wrap(err, "failed to to get DEX version")
+		return "", newError("failed to get the dex version", err)
 	}
-	return res.Server, nil
+	return res.GetServer(), nil
 }
 
-type CreateClientError struct {
-	ApiError      error
-	AlreadyExists bool
-}
-type DeleteClientError struct {
-	ApiError error
-	NotFound bool
-}
-
-// CreateClient a new OIDC client in Dex
+// CreateClient a new OIDC client in Dex. The error reports AlreadyExists when dex already holds a client with the id.
 func (c *APIClient) CreateClient(ctx context.Context, redirectUris []string, trustedPeers []string,
-	public bool, name string, id string, logoURL string, secret string) (*api.Client, *CreateClientError) {
+	public bool, name string, id string, logoURL string, secret string) (*api.Client, error) {
 	req := &api.CreateClientReq{
 		Client: &api.Client{
 			RedirectUris: redirectUris,
@@ -98,19 +137,20 @@ func (c *APIClient) CreateClient(ctx context.Context, redirectUris []string, tru
 
 	res, err := c.Dex.CreateClient(ctx, req)
 	if err != nil {
-		return nil, &CreateClientError{errors.Wrap(err, "failed to create the OIDC client"), false}
+		return nil, newError("failed to create the OIDC client", err)
 	}
 
 	if res.AlreadyExists {
-		return nil, &CreateClientError{errors.Errorf("client %q already exists", id), true}
+		return nil, &Error{Op: "failed to create the OIDC client", Code: codes.AlreadyExists, Err: fmt.Errorf("client %q already exists", id)}
 	}
 
 	return res.Client, nil
 }
 
-// UpdateClient updates an already registered OIDC client
+// UpdateClient updates an already registered OIDC client. Only the redirect URIs, trusted peers, name and logo can be
+// updated in place, see FieldsRequiringRecreate.
 func (c *APIClient) UpdateClient(ctx context.Context, clientID string, redirectUris []string,
-	trustedPeers []string, public bool, name string, logoURL string) error {
+	trustedPeers []string, name string, logoURL string) error {
 	req := &api.UpdateClientReq{
 		Id:           clientID,
 		RedirectUris: redirectUris,
@@ -118,35 +158,67 @@ func (c *APIClient) UpdateClient(ctx context.Context, clientID string, redirectU
 		Name:         name,
 		LogoUrl:      logoURL,
 	}
-	res, err := c.Dex.UpdateClient(ctx, req)
+	op := fmt.Sprintf("failed to update the client with id %q", clientID)
+	var res *api.UpdateClientResp
+	err := c.retryPolicy().do(ctx, func(ctx context.Context) (err error) {
+		res, err = c.Dex.UpdateClient(ctx, req)
+		return err
+	})
 	if err != nil {
-		return errors.Wrapf(err, "failed to update the client with id %q", clientID)
+		return newError(op, err)
 	}
 
 	if res.NotFound {
-		return fmt.Errorf("update did not find the client with id %q", clientID)
+		return &Error{Op: op, Code: codes.NotFound, Err: errors.New("client not found")}
 	}
 	return nil
 }
 
-// DeleteClient deletes the client with given Id from Dex
-func (c *APIClient) DeleteClient(ctx context.Context, id string) *DeleteClientError {
+// FieldsRequiringRecreate returns the fields of the desired client which differ from the current one and cannot be
+// changed with UpdateClient, because UpdateClientReq of the dex API does not carry them. A client has to be deleted
+// and created again for such changes to take effect. The secret is not compared, dex does not return it through the
+// API and the controllers track changes to it themselves.
+func FieldsRequiringRecreate(current *api.Client, desired *api.Client) []string {
+	fields := []string{}
+	if current.Public != desired.Public {
+		fields = append(fields, "public")
+	}
+	return fields
+}
+
+// DeleteClient deletes the client with given Id from Dex. The error reports NotFound when dex holds no such client.
+func (c *APIClient) DeleteClient(ctx context.Context, id string) error {
 	req := &api.DeleteClientReq{
 		Id: id,
 	}
-	res, err := c.Dex.DeleteClient(ctx, req)
+	op := fmt.Sprintf("failed to delete the client with id %q", id)
+	var res *api.DeleteClientResp
+	err := c.retryPolicy().do(ctx, func(ctx context.Context) (err error) {
+		res, err = c.Dex.DeleteClient(ctx, req)
+		return err
+	})
 	if err != nil {
-		return &DeleteClientError{errors.Wrapf(err, "failed to delete the client with id %q", id), false}
+		return newError(op, err)
 	}
 	if res.NotFound {
-		return &DeleteClientError{fmt.Errorf("delete did not find the client with id %q", id), true}
+		return &Error{Op: op, Code: codes.NotFound, Err: errors.New("client not found")}
 	}
 
 	return nil
 }
 
+func bufferBytes(buf *bytes.Buffer) []byte {
+	if buf == nil {
+		return nil
+	}
+	return buf.Bytes()
+}
+
 // CloseConnection calls Close on the ClientConn
 func (c *APIClient) CloseConnection() error {
+	if c.Cc == nil {
+		return nil
+	}
 	err := c.Cc.Close()
 	if err != nil {
 		return errors.Wrapf(err, "error occurred closing the connection")
@@ -0,0 +1,63 @@
+// Copyright Red Hat
+
+package dex
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Error is returned by the calls of APIClient. Code is the gRPC status code of the failed call, or the code matching
+// the outcome dex reported in its response, such as AlreadyExists or NotFound.
+type Error struct {
+	// Op describes the failed operation
+	Op   string
+	Code codes.Code
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Op, e.Err.Error())
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// GRPCStatus lets status.Code and status.FromError read the code of the error
+func (e *Error) GRPCStatus() *status.Status {
+	return status.New(e.Code, e.Error())
+}
+
+// Wrap the error of a gRPC call
+func newError(op string, err error) *Error {
+	return &Error{Op: op, Code: status.Code(err), Err: err}
+}
+
+// Code returns the gRPC status code of err, codes.OK when err is nil and codes.Unknown when err carries no code
+func Code(err error) codes.Code {
+	var dexErr *Error
+	if errors.As(err, &dexErr) {
+		return dexErr.Code
+	}
+	return status.Code(err)
+}
+
+// IsAlreadyExists returns true if err reports that the object already exists in dex
+func IsAlreadyExists(err error) bool {
+	return Code(err) == codes.AlreadyExists
+}
+
+// IsNotFound returns true if err reports that the object does not exist in dex
+func IsNotFound(err error) bool {
+	return Code(err) == codes.NotFound
+}
+
+// IsUnimplemented returns true if err reports that the dex server does not serve the call, as older dex versions do
+// for the calls added to the API after them
+func IsUnimplemented(err error) bool {
+	return Code(err) == codes.Unimplemented
+}
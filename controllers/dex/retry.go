@@ -0,0 +1,72 @@
+// Copyright Red Hat
+
+package dex
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RetryPolicy configures how the idempotent calls of APIClient (GetVersion, UpdateClient and DeleteClient) are
+// retried. Calls which are not idempotent, like CreateClient, are never retried.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts of a call, including the first one
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry, it doubles with each retry up to MaxBackoff
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// AttemptTimeout bounds each attempt, on top of the deadline of the context of the call
+	AttemptTimeout time.Duration
+	// RetryableCodes are the gRPC status codes of the failures worth retrying
+	RetryableCodes []codes.Code
+}
+
+// DefaultRetryPolicy is used when neither Options nor APIClient set a RetryPolicy
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 200 * time.Millisecond,
+	MaxBackoff:     2 * time.Second,
+	AttemptTimeout: 10 * time.Second,
+	RetryableCodes: []codes.Code{codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted},
+}
+
+func (p *RetryPolicy) isRetryable(code codes.Code) bool {
+	for _, retryable := range p.RetryableCodes {
+		if code == retryable {
+			return true
+		}
+	}
+	return false
+}
+
+// Run call until it succeeds, fails with a code that is not retryable, runs out of attempts or ctx is done
+func (p *RetryPolicy) do(ctx context.Context, call func(ctx context.Context) error) error {
+	backoff := p.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		err := p.attempt(ctx, call)
+		if err == nil || attempt >= p.MaxAttempts || !p.isRetryable(status.Code(err)) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+			backoff = p.MaxBackoff
+		}
+	}
+}
+
+func (p *RetryPolicy) attempt(ctx context.Context, call func(ctx context.Context) error) error {
+	if p.AttemptTimeout <= 0 {
+		return call(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, p.AttemptTimeout)
+	defer cancel()
+	return call(ctx)
+}
@@ -0,0 +1,193 @@
+// Copyright Red Hat
+
+package dex
+
+import (
+	"context"
+
+	api "github.com/dexidp/dex/api/v2"
+	"github.com/golang/protobuf/proto"
+)
+
+// The dex API module in use (v2.0.0) predates some calls of the dex gRPC API. Their messages are declared here the
+// way protoc-gen-go declared messages before the protobuf APIv2, so that the gRPC codec encodes them like the
+// generated ones. A dex server older than the call answers it with Unimplemented, see IsUnimplemented.
+
+// GetClientReq is a request to retrieve client details
+type GetClientReq struct {
+	Id string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+}
+
+func (m *GetClientReq) Reset()         { *m = GetClientReq{} }
+func (m *GetClientReq) String() string { return proto.CompactTextString(m) }
+func (*GetClientReq) ProtoMessage()    {}
+
+// GetClientResp returns the client details
+type GetClientResp struct {
+	Client *api.Client `protobuf:"bytes,1,opt,name=client,proto3" json:"client,omitempty"`
+}
+
+func (m *GetClientResp) Reset()         { *m = GetClientResp{} }
+func (m *GetClientResp) String() string { return proto.CompactTextString(m) }
+func (*GetClientResp) ProtoMessage()    {}
+
+// ClientInfo is a client of dex as listed by ListClients, without its secret
+type ClientInfo struct {
+	Id           string   `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	RedirectUris []string `protobuf:"bytes,2,rep,name=redirect_uris,json=redirectUris,proto3" json:"redirect_uris,omitempty"`
+	TrustedPeers []string `protobuf:"bytes,3,rep,name=trusted_peers,json=trustedPeers,proto3" json:"trusted_peers,omitempty"`
+	Public       bool     `protobuf:"varint,4,opt,name=public,proto3" json:"public,omitempty"`
+	Name         string   `protobuf:"bytes,5,opt,name=name,proto3" json:"name,omitempty"`
+	LogoUrl      string   `protobuf:"bytes,6,opt,name=logo_url,json=logoUrl,proto3" json:"logo_url,omitempty"`
+}
+
+func (m *ClientInfo) Reset()         { *m = ClientInfo{} }
+func (m *ClientInfo) String() string { return proto.CompactTextString(m) }
+func (*ClientInfo) ProtoMessage()    {}
+
+// ListClientReq is a request to enumerate clients
+type ListClientReq struct{}
+
+func (m *ListClientReq) Reset()         { *m = ListClientReq{} }
+func (m *ListClientReq) String() string { return proto.CompactTextString(m) }
+func (*ListClientReq) ProtoMessage()    {}
+
+// ListClientResp returns a list of clients
+type ListClientResp struct {
+	Clients []*ClientInfo `protobuf:"bytes,1,rep,name=clients,proto3" json:"clients,omitempty"`
+}
+
+func (m *ListClientResp) Reset()         { *m = ListClientResp{} }
+func (m *ListClientResp) String() string { return proto.CompactTextString(m) }
+func (*ListClientResp) ProtoMessage()    {}
+
+// DiscoveryReq is a request to get the OpenID Connect discovery document of dex
+type DiscoveryReq struct{}
+
+func (m *DiscoveryReq) Reset()         { *m = DiscoveryReq{} }
+func (m *DiscoveryReq) String() string { return proto.CompactTextString(m) }
+func (*DiscoveryReq) ProtoMessage()    {}
+
+// DiscoveryResp holds the OpenID Connect discovery document of dex
+type DiscoveryResp struct {
+	Issuer                            string   `protobuf:"bytes,1,opt,name=issuer,proto3" json:"issuer,omitempty"`
+	AuthorizationEndpoint             string   `protobuf:"bytes,2,opt,name=authorization_endpoint,json=authorizationEndpoint,proto3" json:"authorization_endpoint,omitempty"`
+	TokenEndpoint                     string   `protobuf:"bytes,3,opt,name=token_endpoint,json=tokenEndpoint,proto3" json:"token_endpoint,omitempty"`
+	JwksUri                           string   `protobuf:"bytes,4,opt,name=jwks_uri,json=jwksUri,proto3" json:"jwks_uri,omitempty"`
+	UserinfoEndpoint                  string   `protobuf:"bytes,5,opt,name=userinfo_endpoint,json=userinfoEndpoint,proto3" json:"userinfo_endpoint,omitempty"`
+	DeviceAuthorizationEndpoint       string   `protobuf:"bytes,6,opt,name=device_authorization_endpoint,json=deviceAuthorizationEndpoint,proto3" json:"device_authorization_endpoint,omitempty"`
+	IntrospectionEndpoint             string   `protobuf:"bytes,7,opt,name=introspection_endpoint,json=introspectionEndpoint,proto3" json:"introspection_endpoint,omitempty"`
+	GrantTypesSupported               []string `protobuf:"bytes,8,rep,name=grant_types_supported,json=grantTypesSupported,proto3" json:"grant_types_supported,omitempty"`
+	ResponseTypesSupported            []string `protobuf:"bytes,9,rep,name=response_types_supported,json=responseTypesSupported,proto3" json:"response_types_supported,omitempty"`
+	SubjectTypesSupported             []string `protobuf:"bytes,10,rep,name=subject_types_supported,json=subjectTypesSupported,proto3" json:"subject_types_supported,omitempty"`
+	IdTokenSigningAlgValuesSupported  []string `protobuf:"bytes,11,rep,name=id_token_signing_alg_values_supported,json=idTokenSigningAlgValuesSupported,proto3" json:"id_token_signing_alg_values_supported,omitempty"`
+	CodeChallengeMethodsSupported     []string `protobuf:"bytes,12,rep,name=code_challenge_methods_supported,json=codeChallengeMethodsSupported,proto3" json:"code_challenge_methods_supported,omitempty"`
+	ScopesSupported                   []string `protobuf:"bytes,13,rep,name=scopes_supported,json=scopesSupported,proto3" json:"scopes_supported,omitempty"`
+	TokenEndpointAuthMethodsSupported []string `protobuf:"bytes,14,rep,name=token_endpoint_auth_methods_supported,json=tokenEndpointAuthMethodsSupported,proto3" json:"token_endpoint_auth_methods_supported,omitempty"`
+	ClaimsSupported                   []string `protobuf:"bytes,15,rep,name=claims_supported,json=claimsSupported,proto3" json:"claims_supported,omitempty"`
+}
+
+func (m *DiscoveryResp) Reset()         { *m = DiscoveryResp{} }
+func (m *DiscoveryResp) String() string { return proto.CompactTextString(m) }
+func (*DiscoveryResp) ProtoMessage()    {}
+
+// Connector is a connector of dex. Config is the JSON configuration of the connector.
+type Connector struct {
+	Id     string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Type   string `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`
+	Name   string `protobuf:"bytes,3,opt,name=name,proto3" json:"name,omitempty"`
+	Config []byte `protobuf:"bytes,4,opt,name=config,proto3" json:"config,omitempty"`
+}
+
+func (m *Connector) Reset()         { *m = Connector{} }
+func (m *Connector) String() string { return proto.CompactTextString(m) }
+func (*Connector) ProtoMessage()    {}
+
+// CreateConnectorReq is a request to create a connector
+type CreateConnectorReq struct {
+	Connector *Connector `protobuf:"bytes,1,opt,name=connector,proto3" json:"connector,omitempty"`
+}
+
+func (m *CreateConnectorReq) Reset()         { *m = CreateConnectorReq{} }
+func (m *CreateConnectorReq) String() string { return proto.CompactTextString(m) }
+func (*CreateConnectorReq) ProtoMessage()    {}
+
+// CreateConnectorResp returns the response from creating a connector
+type CreateConnectorResp struct {
+	AlreadyExists bool `protobuf:"varint,1,opt,name=already_exists,json=alreadyExists,proto3" json:"already_exists,omitempty"`
+}
+
+func (m *CreateConnectorResp) Reset()         { *m = CreateConnectorResp{} }
+func (m *CreateConnectorResp) String() string { return proto.CompactTextString(m) }
+func (*CreateConnectorResp) ProtoMessage()    {}
+
+// UpdateConnectorReq is a request to modify an existing connector
+type UpdateConnectorReq struct {
+	Id        string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	NewType   string `protobuf:"bytes,2,opt,name=new_type,json=newType,proto3" json:"new_type,omitempty"`
+	NewName   string `protobuf:"bytes,3,opt,name=new_name,json=newName,proto3" json:"new_name,omitempty"`
+	NewConfig []byte `protobuf:"bytes,4,opt,name=new_config,json=newConfig,proto3" json:"new_config,omitempty"`
+}
+
+func (m *UpdateConnectorReq) Reset()         { *m = UpdateConnectorReq{} }
+func (m *UpdateConnectorReq) String() string { return proto.CompactTextString(m) }
+func (*UpdateConnectorReq) ProtoMessage()    {}
+
+// UpdateConnectorResp returns the response from modifying an existing connector
+type UpdateConnectorResp struct {
+	NotFound bool `protobuf:"varint,1,opt,name=not_found,json=notFound,proto3" json:"not_found,omitempty"`
+}
+
+func (m *UpdateConnectorResp) Reset()         { *m = UpdateConnectorResp{} }
+func (m *UpdateConnectorResp) String() string { return proto.CompactTextString(m) }
+func (*UpdateConnectorResp) ProtoMessage()    {}
+
+// DeleteConnectorReq is a request to delete a connector
+type DeleteConnectorReq struct {
+	Id string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+}
+
+func (m *DeleteConnectorReq) Reset()         { *m = DeleteConnectorReq{} }
+func (m *DeleteConnectorReq) String() string { return proto.CompactTextString(m) }
+func (*DeleteConnectorReq) ProtoMessage()    {}
+
+// DeleteConnectorResp returns the response from deleting a connector
+type DeleteConnectorResp struct {
+	NotFound bool `protobuf:"varint,1,opt,name=not_found,json=notFound,proto3" json:"not_found,omitempty"`
+}
+
+func (m *DeleteConnectorResp) Reset()         { *m = DeleteConnectorResp{} }
+func (m *DeleteConnectorResp) String() string { return proto.CompactTextString(m) }
+func (*DeleteConnectorResp) ProtoMessage()    {}
+
+// ListConnectorReq is a request to enumerate connectors
+type ListConnectorReq struct{}
+
+func (m *ListConnectorReq) Reset()         { *m = ListConnectorReq{} }
+func (m *ListConnectorReq) String() string { return proto.CompactTextString(m) }
+func (*ListConnectorReq) ProtoMessage()    {}
+
+// ListConnectorResp returns a list of connectors
+type ListConnectorResp struct {
+	Connectors []*Connector `protobuf:"bytes,1,rep,name=connectors,proto3" json:"connectors,omitempty"`
+}
+
+func (m *ListConnectorResp) Reset()         { *m = ListConnectorResp{} }
+func (m *ListConnectorResp) String() string { return proto.CompactTextString(m) }
+func (*ListConnectorResp) ProtoMessage()    {}
+
+// Full names of the calls declared here
+const (
+	getClientMethod       = "/api.Dex/GetClient"
+	listClientsMethod     = "/api.Dex/ListClients"
+	getDiscoveryMethod    = "/api.Dex/GetDiscovery"
+	createConnectorMethod = "/api.Dex/CreateConnector"
+	updateConnectorMethod = "/api.Dex/UpdateConnector"
+	deleteConnectorMethod = "/api.Dex/DeleteConnector"
+	listConnectorsMethod  = "/api.Dex/ListConnectors"
+)
+
+// invoke makes a call the dex API module does not declare
+func (c *APIClient) invoke(ctx context.Context, method string, req interface{}, res interface{}) error {
+	return c.Cc.Invoke(ctx, method, req, res)
+}
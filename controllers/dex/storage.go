@@ -0,0 +1,115 @@
+// Copyright Red Hat
+
+package dex
+
+import (
+	"context"
+	"encoding/base32"
+	"encoding/json"
+	"hash/fnv"
+	"strings"
+
+	api "github.com/dexidp/dex/api/v2"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// The dex servers managed by this operator use the kubernetes storage backend, which persists every
+// object as a custom resource in the dex server namespace. The dex gRPC API has no call to read an
+// OAuth2 client back in older dex releases, so these resources are the source of truth for what dex is actually
+// serving.
+
+// OAuth2ClientGVK is the kind dex uses to store OAuth2 clients
+var OAuth2ClientGVK = schema.GroupVersionKind{Group: "dex.coreos.com", Version: "v1", Kind: "OAuth2Client"}
+
+// RefreshTokenGVK is the kind dex uses to store refresh tokens
+var RefreshTokenGVK = schema.GroupVersionKind{Group: "dex.coreos.com", Version: "v1", Kind: "RefreshToken"}
+
+// dex derives resource names from object IDs with a lowercase base32 alphabet
+var storageNameEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567")
+
+// storedClient mirrors the OAuth2Client resource written by the dex kubernetes storage
+type storedClient struct {
+	ID           string   `json:"id,omitempty"`
+	Secret       string   `json:"secret,omitempty"`
+	RedirectURIs []string `json:"redirectURIs,omitempty"`
+	TrustedPeers []string `json:"trustedPeers,omitempty"`
+	Public       bool     `json:"public"`
+	Name         string   `json:"name,omitempty"`
+	LogoURL      string   `json:"logoURL,omitempty"`
+}
+
+// RefreshToken is a refresh token held by the dex storage, the token itself is left out
+type RefreshToken struct {
+	ClientID    string             `json:"clientID,omitempty"`
+	ConnectorID string             `json:"connectorID,omitempty"`
+	Claims      RefreshTokenClaims `json:"claims,omitempty"`
+}
+
+// RefreshTokenClaims are the claims of the user a refresh token was issued to
+type RefreshTokenClaims struct {
+	UserID   string `json:"userID,omitempty"`
+	Username string `json:"username,omitempty"`
+	Email    string `json:"email,omitempty"`
+}
+
+// StorageObjectName returns the name of the resource dex stores for an object with the given ID.
+// This matches dex's own (quirky) derivation, which appends the FNV-64 hash of an empty input to the ID.
+func StorageObjectName(id string) string {
+	return strings.TrimRight(storageNameEncoding.EncodeToString(fnv.New64().Sum([]byte(id))), "=")
+}
+
+// GetStoredClient reads the OAuth2 client with the given ID from the dex storage in namespace
+func GetStoredClient(ctx context.Context, c client.Reader, namespace string, id string) (*api.Client, error) {
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(OAuth2ClientGVK)
+	if err := c.Get(ctx, types.NamespacedName{Name: StorageObjectName(id), Namespace: namespace}, u); err != nil {
+		return nil, err
+	}
+	return toAPIClient(u)
+}
+
+func toAPIClient(u *unstructured.Unstructured) (*api.Client, error) {
+	data, err := json.Marshal(u.Object)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to marshal stored client %q", u.GetName())
+	}
+	stored := &storedClient{}
+	if err := json.Unmarshal(data, stored); err != nil {
+		return nil, errors.Wrapf(err, "failed to unmarshal stored client %q", u.GetName())
+	}
+	return &api.Client{
+		Id:           stored.ID,
+		Secret:       stored.Secret,
+		RedirectUris: stored.RedirectURIs,
+		TrustedPeers: stored.TrustedPeers,
+		Public:       stored.Public,
+		Name:         stored.Name,
+		LogoUrl:      stored.LogoURL,
+	}, nil
+}
+
+// ListStoredRefreshTokens lists the refresh tokens held by the dex storage in namespace
+func ListStoredRefreshTokens(ctx context.Context, c client.Reader, namespace string) ([]*RefreshToken, error) {
+	ul := &unstructured.UnstructuredList{}
+	ul.SetGroupVersionKind(RefreshTokenGVK.GroupVersion().WithKind(RefreshTokenGVK.Kind + "List"))
+	if err := c.List(ctx, ul, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+	refreshTokens := []*RefreshToken{}
+	for i := range ul.Items {
+		data, err := json.Marshal(ul.Items[i].Object)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to marshal stored refresh token %q", ul.Items[i].GetName())
+		}
+		refreshToken := &RefreshToken{}
+		if err := json.Unmarshal(data, refreshToken); err != nil {
+			return nil, errors.Wrapf(err, "failed to unmarshal stored refresh token %q", ul.Items[i].GetName())
+		}
+		refreshTokens = append(refreshTokens, refreshToken)
+	}
+	return refreshTokens, nil
+}
@@ -0,0 +1,59 @@
+// Copyright Red Hat
+
+package dex
+
+import (
+	"encoding/base64"
+
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The user ID dex puts in the sub claim of its ID tokens, and expects in the refresh token calls of its gRPC API, is
+// the unpadded base64url encoding of an IDTokenSubject protobuf message holding the ID of the user in the connector
+// (field 1) and the connector ID (field 2).
+
+// EncodeSubject returns the dex user ID of the user with the given ID in the connector
+func EncodeSubject(userID string, connectorID string) string {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendString(b, userID)
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	b = protowire.AppendString(b, connectorID)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeSubject returns the ID of the user in the connector and the connector ID held by a dex user ID
+func DecodeSubject(subject string) (userID string, connectorID string, err error) {
+	b, err := base64.RawURLEncoding.DecodeString(subject)
+	if err != nil {
+		return "", "", errors.Wrap(err, "failed to decode the subject")
+	}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return "", "", errors.Wrap(protowire.ParseError(n), "failed to parse the subject")
+		}
+		b = b[n:]
+		if typ != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return "", "", errors.Wrap(protowire.ParseError(n), "failed to parse the subject")
+			}
+			b = b[n:]
+			continue
+		}
+		v, n := protowire.ConsumeString(b)
+		if n < 0 {
+			return "", "", errors.Wrap(protowire.ParseError(n), "failed to parse the subject")
+		}
+		b = b[n:]
+		switch num {
+		case 1:
+			userID = v
+		case 2:
+			connectorID = v
+		}
+	}
+	return userID, connectorID, nil
+}
@@ -0,0 +1,86 @@
+// Copyright Red Hat
+
+package controllers
+
+import (
+	"context"
+
+	api "github.com/dexidp/dex/api/v2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc/codes"
+
+	dexapi "github.com/identitatem/dex-operator/controllers/dex"
+)
+
+var _ = Describe("Call the dex API through the DexAPI interface", func() {
+	var fake *fakeDexAPIServer
+	var dexAPI dexapi.DexAPI
+	var stop func()
+
+	BeforeEach(func() {
+		var newClient func(opts *dexapi.Options) (*dexapi.APIClient, error)
+		fake, newClient, stop = startFakeDexAPIServer()
+		dexApiClient, err := newClient(nil)
+		Expect(err).To(BeNil())
+		dexAPI = dexApiClient
+	})
+
+	AfterEach(func() {
+		Expect(dexAPI.CloseConnection()).To(Succeed())
+		stop()
+	})
+
+	It("should manage static passwords", func() {
+		password := &api.Password{Email: "admin@example.com", Hash: []byte("password"), Username: "admin", UserId: "1"}
+		Expect(dexAPI.CreatePassword(context.TODO(), password)).To(Succeed())
+		Expect(dexapi.IsAlreadyExists(dexAPI.CreatePassword(context.TODO(), password))).To(BeTrue())
+		passwords, err := dexAPI.ListPasswords(context.TODO())
+		Expect(err).To(BeNil())
+		Expect(passwords).To(HaveLen(1))
+		Expect(dexAPI.VerifyPassword(context.TODO(), "admin@example.com", "password")).To(BeTrue())
+		_, err = dexAPI.VerifyPassword(context.TODO(), "nobody@example.com", "password")
+		Expect(dexapi.IsNotFound(err)).To(BeTrue())
+	})
+	It("should manage connectors", func() {
+		connector := &dexapi.Connector{Id: "github", Type: "github", Name: "GitHub", Config: []byte(`{"clientID":"id"}`)}
+		Expect(dexAPI.CreateConnector(context.TODO(), connector)).To(Succeed())
+		Expect(dexapi.IsAlreadyExists(dexAPI.CreateConnector(context.TODO(), connector))).To(BeTrue())
+		connector.Config = []byte(`{"clientID":"other-id"}`)
+		Expect(dexAPI.UpdateConnector(context.TODO(), connector)).To(Succeed())
+		connectors, err := dexAPI.ListConnectors(context.TODO())
+		Expect(err).To(BeNil())
+		Expect(connectors).To(HaveLen(1))
+		Expect(connectors[0].Config).To(Equal(connector.Config))
+		Expect(dexAPI.DeleteConnector(context.TODO(), "github")).To(Succeed())
+		Expect(dexapi.IsNotFound(dexAPI.DeleteConnector(context.TODO(), "github"))).To(BeTrue())
+		Expect(dexapi.IsNotFound(dexAPI.UpdateConnector(context.TODO(), connector))).To(BeTrue())
+	})
+	It("should read clients back", func() {
+		_, err := dexAPI.CreateClient(context.TODO(), []string{"https://app.example.com/callback"}, nil, false, "app", "app-id", "", "app-secret")
+		Expect(err).To(BeNil())
+		client, err := dexAPI.GetClient(context.TODO(), "app-id")
+		Expect(err).To(BeNil())
+		Expect(client.Secret).To(Equal("app-secret"))
+		Expect(client.RedirectUris).To(Equal([]string{"https://app.example.com/callback"}))
+		_, err = dexAPI.GetClient(context.TODO(), "other-id")
+		Expect(dexapi.IsNotFound(err)).To(BeTrue())
+		clients, err := dexAPI.ListClients(context.TODO())
+		Expect(err).To(BeNil())
+		Expect(clients).To(HaveLen(1))
+		Expect(clients[0].Id).To(Equal("app-id"))
+		Expect(clients[0].Name).To(Equal("app"))
+	})
+	It("should get the discovery document", func() {
+		discovery, err := dexAPI.GetDiscovery(context.TODO())
+		Expect(err).To(BeNil())
+		Expect(discovery.Issuer).To(Equal("https://dex.example.com"))
+		Expect(discovery.ScopesSupported).To(ContainElement("openid"))
+	})
+	It("should report the calls an older dex does not serve as unimplemented", func() {
+		fake.setFailure("GetDiscovery", codes.Unimplemented)
+		_, err := dexAPI.GetDiscovery(context.TODO())
+		Expect(dexapi.IsUnimplemented(err)).To(BeTrue())
+		Expect(fake.callCount("GetDiscovery")).To(Equal(1))
+	})
+})
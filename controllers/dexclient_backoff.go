@@ -0,0 +1,62 @@
+// Copyright Red Hat
+
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+)
+
+// Failures of dex to apply a DexClient are retried with an exponential backoff kept per DexClient and failure reason,
+// so that a client failing for one reason does not inherit the delay built up by another.
+var dexClientFailureBackoff workqueue.RateLimiter = workqueue.NewItemExponentialFailureRateLimiter(time.Second, 5*time.Minute)
+
+// The reasons of the failures retried with a backoff
+var dexClientFailureReasons = []string{
+	"GRPCConnectionFailed",
+	"DexClientSecretFailed",
+	"DexClientCreateFailed",
+	"DexClientUpdateFailed",
+	"DexClientDeleteFailed",
+}
+
+// dexClientFailure is an error applying a DexClient to dex, the reason matches the one of the Applied condition
+type dexClientFailure struct {
+	reason string
+	err    error
+}
+
+func (f *dexClientFailure) Error() string {
+	return fmt.Sprintf("%s: %s", f.reason, f.err.Error())
+}
+
+func (f *dexClientFailure) Unwrap() error {
+	return f.err
+}
+
+func dexClientBackoffKey(dexv1Client *authv1alpha1.DexClient, reason string) string {
+	return fmt.Sprintf("%s/%s/%s", dexv1Client.Namespace, dexv1Client.Name, reason)
+}
+
+// Turn the error of a reconcile step into a result. Failures of dex are requeued after the backoff of their reason,
+// other errors are returned to the controller.
+func dexClientFailureResult(dexv1Client *authv1alpha1.DexClient, err error) (ctrl.Result, error) {
+	var failure *dexClientFailure
+	if errors.As(err, &failure) {
+		return ctrl.Result{RequeueAfter: dexClientFailureBackoff.When(dexClientBackoffKey(dexv1Client, failure.reason))}, nil
+	}
+	return ctrl.Result{}, err
+}
+
+// Reset the backoff of every failure reason once a DexClient has been applied
+func forgetDexClientFailures(dexv1Client *authv1alpha1.DexClient) {
+	for _, reason := range dexClientFailureReasons {
+		dexClientFailureBackoff.Forget(dexClientBackoffKey(dexv1Client, reason))
+	}
+}
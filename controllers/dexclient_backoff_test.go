@@ -0,0 +1,322 @@
+// Copyright Red Hat
+
+package controllers
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	api "github.com/dexidp/dex/api/v2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+	dexapi "github.com/identitatem/dex-operator/controllers/dex"
+)
+
+// fakeDexServer is an in-process dex gRPC server holding clients in memory, calls can be made to fail with a gRPC code
+type fakeDexServer struct {
+	api.UnimplementedDexServer
+	mu       sync.Mutex
+	clients  map[string]*api.Client
+	failures map[string]codes.Code
+	calls    map[string]int
+}
+
+func (s *fakeDexServer) setFailure(method string, code codes.Code) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if code == codes.OK {
+		delete(s.failures, method)
+		return
+	}
+	s.failures[method] = code
+}
+
+func (s *fakeDexServer) callCount(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[method]
+}
+
+func (s *fakeDexServer) failure(method string) error {
+	s.calls[method]++
+	if code, ok := s.failures[method]; ok {
+		return status.Errorf(code, "%s failed", method)
+	}
+	return nil
+}
+
+func (s *fakeDexServer) getClient(id string) *api.Client {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.clients[id]
+}
+
+func (s *fakeDexServer) GetVersion(ctx context.Context, req *api.VersionReq) (*api.VersionResp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("GetVersion"); err != nil {
+		return nil, err
+	}
+	return &api.VersionResp{Server: "v2.30.0", Api: 2}, nil
+}
+
+func (s *fakeDexServer) CreateClient(ctx context.Context, req *api.CreateClientReq) (*api.CreateClientResp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("CreateClient"); err != nil {
+		return nil, err
+	}
+	if _, ok := s.clients[req.Client.Id]; ok {
+		return &api.CreateClientResp{AlreadyExists: true}, nil
+	}
+	s.clients[req.Client.Id] = req.Client
+	return &api.CreateClientResp{Client: req.Client}, nil
+}
+
+func (s *fakeDexServer) UpdateClient(ctx context.Context, req *api.UpdateClientReq) (*api.UpdateClientResp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("UpdateClient"); err != nil {
+		return nil, err
+	}
+	c, ok := s.clients[req.Id]
+	if !ok {
+		return &api.UpdateClientResp{NotFound: true}, nil
+	}
+	c.RedirectUris = req.RedirectUris
+	c.TrustedPeers = req.TrustedPeers
+	c.Name = req.Name
+	c.LogoUrl = req.LogoUrl
+	return &api.UpdateClientResp{}, nil
+}
+
+func (s *fakeDexServer) DeleteClient(ctx context.Context, req *api.DeleteClientReq) (*api.DeleteClientResp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("DeleteClient"); err != nil {
+		return nil, err
+	}
+	if _, ok := s.clients[req.Id]; !ok {
+		return &api.DeleteClientResp{NotFound: true}, nil
+	}
+	delete(s.clients, req.Id)
+	return &api.DeleteClientResp{}, nil
+}
+
+// Start a fake dex server, returns a function connecting to it
+func startFakeDexServer() (*fakeDexServer, func(opts *dexapi.Options) (*dexapi.APIClient, error), func()) {
+	fake := newFakeDexServer()
+	newClient, stop := serveFakeDex(func(server *grpc.Server) {
+		api.RegisterDexServer(server, fake)
+	})
+	return fake, newClient, stop
+}
+
+func newFakeDexServer() *fakeDexServer {
+	return &fakeDexServer{
+		clients:  map[string]*api.Client{},
+		failures: map[string]codes.Code{},
+		calls:    map[string]int{},
+	}
+}
+
+// Serve the fake dex services register adds to an in-process gRPC server, returns a function connecting to it
+func serveFakeDex(register func(server *grpc.Server), opts ...grpc.ServerOption) (func(opts *dexapi.Options) (*dexapi.APIClient, error), func()) {
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(opts...)
+	register(server)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	newClient := func(opts *dexapi.Options) (*dexapi.APIClient, error) {
+		conn, err := grpc.Dial("bufnet",
+			grpc.WithInsecure(),
+			grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+				return listener.Dial()
+			}))
+		if err != nil {
+			return nil, err
+		}
+		return &dexapi.APIClient{Dex: api.NewDexClient(conn), Cc: conn}, nil
+	}
+	return newClient, server.Stop
+}
+
+var _ = Describe("Back off DexClient failures through a fake dex server", func() {
+	DexClientName := "dex-client-backoff"
+	DexClientNamespace := "dex-client-backoff-ns"
+	DexClientID := "dex-client-backoff-id"
+	var fake *fakeDexServer
+	var stop func()
+	var r *DexClientReconciler
+
+	BeforeEach(func() {
+		var newClient func(opts *dexapi.Options) (*dexapi.APIClient, error)
+		fake, newClient, stop = startFakeDexServer()
+		r = newTestDexClientReconciler(func(ctx context.Context, opts *dexapi.Options) (dexapi.DexAPI, error) {
+			dexApiClient, err := newClient(opts)
+			if err != nil {
+				return nil, err
+			}
+			return dexApiClient, nil
+		})
+	})
+
+	AfterEach(func() {
+		stop()
+	})
+
+	appliedReason := func(dexClient *authv1alpha1.DexClient) string {
+		cond := meta.FindStatusCondition(dexClient.Status.Conditions, authv1alpha1.DexClientConditionTypeApplied)
+		if cond == nil {
+			return ""
+		}
+		return cond.Reason
+	}
+
+	// The manager reconciles the DexClient too, so a reconcile may hit a conflict and is retried until one of the
+	// expected reasons shows up
+	reconcileUntil := func(reasons ...string) ctrl.Result {
+		var result ctrl.Result
+		Eventually(func() string {
+			req := ctrl.Request{}
+			req.Name = DexClientName
+			req.Namespace = DexClientNamespace
+			var err error
+			result, err = r.Reconcile(context.TODO(), req)
+			if err != nil {
+				return err.Error()
+			}
+			dexClient := &authv1alpha1.DexClient{}
+			Expect(k8sClient.Get(context.TODO(), client.ObjectKey{Name: DexClientName, Namespace: DexClientNamespace}, dexClient)).To(Succeed())
+			return appliedReason(dexClient)
+		}, 30, 1).Should(BeElementOf(reasons))
+		return result
+	}
+
+	numRequeues := func(reason string) int {
+		dexClient := &authv1alpha1.DexClient{ObjectMeta: metav1.ObjectMeta{Name: DexClientName, Namespace: DexClientNamespace}}
+		return dexClientFailureBackoff.NumRequeues(dexClientBackoffKey(dexClient, reason))
+	}
+
+	It("should requeue gRPC failures with a backoff per failure reason", func() {
+		By("creating the DexClient and its secrets", func() {
+			Expect(k8sClient.Create(context.TODO(), &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{Name: DexClientNamespace},
+			})).To(Succeed())
+			Expect(k8sClient.Create(context.TODO(), &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: SECRET_MTLS_NAME, Namespace: DexClientNamespace},
+				Data: map[string][]byte{
+					"ca.crt":     []byte("ca.crt"),
+					"client.crt": []byte("client.crt"),
+					"client.key": []byte("client.key"),
+				},
+			})).To(Succeed())
+			Expect(k8sClient.Create(context.TODO(), &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: DexClientName + "-secret", Namespace: DexClientNamespace},
+				StringData: map[string]string{"clientSecret": "backoff-secret"},
+			})).To(Succeed())
+			Expect(k8sClient.Create(context.TODO(), &authv1alpha1.DexClient{
+				ObjectMeta: metav1.ObjectMeta{Name: DexClientName, Namespace: DexClientNamespace},
+				Spec: authv1alpha1.DexClientSpec{
+					ClientID: DexClientID,
+					ClientSecretRef: corev1.SecretReference{
+						Name:      DexClientName + "-secret",
+						Namespace: DexClientNamespace,
+					},
+					RedirectURIs: []string{"https://backoff.example.com/callback"},
+				},
+			})).To(Succeed())
+		})
+		By("failing to create the oauth2client", func() {
+			fake.setFailure("CreateClient", codes.Unavailable)
+			result := reconcileUntil("DexClientCreateFailed")
+			Expect(result.RequeueAfter).To(BeNumerically(">", 0))
+			Expect(numRequeues("DexClientCreateFailed")).To(BeNumerically(">", 0))
+		})
+		By("creating the oauth2client once dex recovers", func() {
+			fake.setFailure("CreateClient", codes.OK)
+			result := reconcileUntil("Created", "Updated")
+			Expect(result.RequeueAfter).To(Equal(dexClientResyncPeriod))
+			Expect(fake.getClient(DexClientID)).ToNot(BeNil())
+			Expect(numRequeues("DexClientCreateFailed")).To(Equal(0))
+		})
+		By("backing off update failures separately", func() {
+			fake.setFailure("UpdateClient", codes.Unavailable)
+			result := reconcileUntil("DexClientUpdateFailed")
+			Expect(result.RequeueAfter).To(BeNumerically(">", 0))
+			Expect(numRequeues("DexClientUpdateFailed")).To(BeNumerically(">", 0))
+			Expect(numRequeues("DexClientCreateFailed")).To(Equal(0))
+		})
+		By("updating the oauth2client once dex recovers", func() {
+			fake.setFailure("UpdateClient", codes.OK)
+			result := reconcileUntil("Updated")
+			Expect(result.RequeueAfter).To(Equal(dexClientResyncPeriod))
+			Expect(numRequeues("DexClientUpdateFailed")).To(Equal(0))
+		})
+	})
+})
+
+var _ = Describe("Retry idempotent dex API calls", func() {
+	var fake *fakeDexServer
+	var dexApiClient *dexapi.APIClient
+	var stop func()
+
+	BeforeEach(func() {
+		var newClient func(opts *dexapi.Options) (*dexapi.APIClient, error)
+		fake, newClient, stop = startFakeDexServer()
+		var err error
+		dexApiClient, err = newClient(nil)
+		Expect(err).To(BeNil())
+		dexApiClient.RetryPolicy = &dexapi.RetryPolicy{
+			MaxAttempts:    3,
+			InitialBackoff: time.Millisecond,
+			RetryableCodes: []codes.Code{codes.Unavailable},
+		}
+	})
+
+	AfterEach(func() {
+		Expect(dexApiClient.CloseConnection()).To(Succeed())
+		stop()
+	})
+
+	It("should retry idempotent calls failing with a retryable code", func() {
+		fake.setFailure("UpdateClient", codes.Unavailable)
+		err := dexApiClient.UpdateClient(context.TODO(), "retry-id", nil, nil, "retry", "")
+		Expect(dexapi.Code(err)).To(Equal(codes.Unavailable))
+		Expect(fake.callCount("UpdateClient")).To(Equal(3))
+	})
+	It("should not retry failures with other codes", func() {
+		fake.setFailure("DeleteClient", codes.PermissionDenied)
+		err := dexApiClient.DeleteClient(context.TODO(), "retry-id")
+		Expect(dexapi.Code(err)).To(Equal(codes.PermissionDenied))
+		Expect(fake.callCount("DeleteClient")).To(Equal(1))
+	})
+	It("should never retry CreateClient", func() {
+		fake.setFailure("CreateClient", codes.Unavailable)
+		_, err := dexApiClient.CreateClient(context.TODO(), nil, nil, false, "retry", "retry-id", "", "secret")
+		Expect(dexapi.Code(err)).To(Equal(codes.Unavailable))
+		Expect(fake.callCount("CreateClient")).To(Equal(1))
+	})
+	It("should report the outcome of dex responses as typed errors", func() {
+		_, err := dexApiClient.CreateClient(context.TODO(), nil, nil, false, "retry", "retry-id", "", "secret")
+		Expect(err).To(BeNil())
+		_, err = dexApiClient.CreateClient(context.TODO(), nil, nil, false, "retry", "retry-id", "", "secret")
+		Expect(dexapi.IsAlreadyExists(err)).To(BeTrue())
+		Expect(dexApiClient.DeleteClient(context.TODO(), "retry-id")).To(Succeed())
+		Expect(dexapi.IsNotFound(dexApiClient.DeleteClient(context.TODO(), "retry-id"))).To(BeTrue())
+	})
+})
@@ -0,0 +1,135 @@
+// Copyright Red Hat
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+	dexapi "github.com/identitatem/dex-operator/controllers/dex"
+)
+
+// Check the allowed connectors of a DexClient and record the result in the ConnectorsRestricted condition. Returns
+// false when the DexClient must not be applied.
+//
+// The Client message of the dex gRPC API has no field restricting the connectors of a client, so the operator
+// enforces the restriction itself: a DexClient naming connectors is only applied while the DexServer defines no other
+// connector, users of the client then cannot log in with any other one. When the DexServer defines another
+// connector, the oauth2client is deleted from dex until the DexClient or the DexServer is changed.
+func (r *DexClientReconciler) checkAllowedConnectors(dexApiClient dexapi.DexAPI, dexv1Client *authv1alpha1.DexClient, ctx context.Context) (bool, error) {
+	log := ctrllog.FromContext(ctx)
+
+	if len(dexv1Client.Spec.AllowedConnectors) == 0 {
+		if meta.FindStatusCondition(dexv1Client.Status.Conditions, authv1alpha1.DexClientConditionTypeConnectorsRestricted) == nil {
+			return true, nil
+		}
+		meta.RemoveStatusCondition(&dexv1Client.Status.Conditions, authv1alpha1.DexClientConditionTypeConnectorsRestricted)
+		return true, r.Client.Status().Update(ctx, dexv1Client)
+	}
+
+	dexServerList := &authv1alpha1.DexServerList{}
+	if err := r.List(ctx, dexServerList, client.InNamespace(dexv1Client.Namespace)); err != nil {
+		return false, err
+	}
+	unknown := unknownConnectors(dexv1Client.Spec.AllowedConnectors, dexServerList.Items)
+	disallowed := disallowedConnectors(dexv1Client.Spec.AllowedConnectors, dexServerList.Items)
+
+	conditions := []metav1.Condition{}
+	if len(disallowed) > 0 && isOAuth2ClientCreated(dexv1Client.Status.Conditions) {
+		log.Info("Deleting dex client, the DexServer defines connectors it does not allow", "name", dexv1Client.Name,
+			"connectors", disallowed)
+		if result, err := r.DeleteOAuth2Client(dexApiClient, dexv1Client, ctx); err != nil {
+			return false, err
+		} else if result.Requeue || result.RequeueAfter > 0 {
+			return false, nil
+		}
+		r.Recorder.Eventf(dexv1Client, corev1.EventTypeWarning, "ConnectorsNotRestricted",
+			"oauth2client is deleted, the DexServer defines connectors it does not allow: %s", strings.Join(disallowed, ", "))
+		conditions = append(conditions, metav1.Condition{
+			Type:    authv1alpha1.DexClientConditionTypeOAuth2ClientCreated,
+			Status:  metav1.ConditionFalse,
+			Reason:  "ConnectorsNotRestricted",
+			Message: "oauth2client is deleted until it can be restricted to the allowed connectors",
+		})
+	}
+
+	var reason, message string
+	switch {
+	case len(unknown) > 0:
+		reason = "UnknownConnectors"
+		message = fmt.Sprintf("connectors not defined by the DexServer: %s", strings.Join(unknown, ", "))
+	case len(disallowed) > 0:
+		reason = "ConnectorsNotRestricted"
+		message = fmt.Sprintf("the dex API cannot restrict a client to connectors, and the DexServer defines connectors the client does not allow: %s",
+			strings.Join(disallowed, ", "))
+	default:
+		condRestricted := metav1.Condition{
+			Type:               authv1alpha1.DexClientConditionTypeConnectorsRestricted,
+			Status:             metav1.ConditionTrue,
+			Reason:             "OnlyAllowedConnectors",
+			Message:            "the DexServer defines no other connector than the allowed ones",
+			ObservedGeneration: dexv1Client.Generation,
+		}
+		if conditionsEqual(dexv1Client.Status.Conditions, mergeStatusConditions(dexv1Client.Status.Conditions, condRestricted)) {
+			return true, nil
+		}
+		return true, r.updateDexClientStatusConditions(dexv1Client, ctx, condRestricted)
+	}
+
+	conditions = append(conditions, metav1.Condition{
+		Type:               authv1alpha1.DexClientConditionTypeConnectorsRestricted,
+		Status:             metav1.ConditionFalse,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: dexv1Client.Generation,
+	}, metav1.Condition{
+		Type:    authv1alpha1.DexClientConditionTypeApplied,
+		Status:  metav1.ConditionFalse,
+		Reason:  reason,
+		Message: message,
+	})
+	if conditionsEqual(dexv1Client.Status.Conditions, mergeStatusConditions(dexv1Client.Status.Conditions, conditions...)) {
+		return false, nil
+	}
+	return false, r.updateDexClientStatusConditions(dexv1Client, ctx, conditions...)
+}
+
+// List the allowed connectors none of the DexServers define
+func unknownConnectors(allowedConnectors []string, dexServers []authv1alpha1.DexServer) []string {
+	defined := sets.NewString()
+	for _, dexServer := range dexServers {
+		for _, connector := range dexServer.Spec.Connectors {
+			defined.Insert(connector.Id)
+		}
+	}
+	unknown := []string{}
+	for _, id := range allowedConnectors {
+		if !defined.Has(id) {
+			unknown = append(unknown, id)
+		}
+	}
+	return unknown
+}
+
+// List the connectors of the DexServers the allowed connectors leave out
+func disallowedConnectors(allowedConnectors []string, dexServers []authv1alpha1.DexServer) []string {
+	allowed := sets.NewString(allowedConnectors...)
+	disallowed := []string{}
+	for _, dexServer := range dexServers {
+		for _, connector := range dexServer.Spec.Connectors {
+			if !allowed.Has(connector.Id) {
+				disallowed = append(disallowed, connector.Id)
+			}
+		}
+	}
+	return disallowed
+}
@@ -8,15 +8,22 @@ import (
 	"crypto/sha256"
 	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
+	api "github.com/dexidp/dex/api/v2"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -35,16 +42,22 @@ import (
 const (
 	DEX_CLIENT_SECRET_LABEL           = "auth.identitatem.io/dex-client-secret"
 	DEX_CLIENT_SECRET_HASH_ANNOTATION = "auth.identitatem.io/dex-client-secret-hash"
+	DEX_CLIENT_ADOPTION_ANNOTATION    = "auth.identitatem.io/adoption-policy"
+	DEX_CLIENT_PUBLIC_ANNOTATION      = "auth.identitatem.io/dex-client-public"
 	DEXCLIENT_FINALIZER               = "auth.identitatem.io/cleanup"
 )
 
 // DexClientReconciler reconciles a DexClient object
 type DexClientReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	// DexConnections are the connections to the dex servers, shared by all reconciles
+	DexConnections *dexapi.ConnectionManager
 }
 
-var DexapiNewClientPEM = dexapi.NewClientPEM
+// How often an applied DexClient is compared against the oauth2client held by dex, to detect and repair drift
+var dexClientResyncPeriod = 10 * time.Minute
 
 //+kubebuilder:rbac:groups=auth.identitatem.io,resources=dexclients,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=auth.identitatem.io,resources=dexclients/status,verbs=get;update;patch
@@ -52,6 +65,9 @@ var DexapiNewClientPEM = dexapi.NewClientPEM
 //+kubebuilder:rbac:groups="rbac.authorization.k8s.io",resources={clusterroles},verbs=get;list;watch;create;update;patch;delete;escalate;bind
 //+kubebuilder:rbac:groups="apiextensions.k8s.io",resources={customresourcedefinitions},verbs=get;list;create;update;patch;delete
 //+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;patch;delete;update
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups=dex.coreos.com,resources=oauth2clients,verbs=get;list
+//+kubebuilder:rbac:groups=cluster.open-cluster-management.io,resources=managedclusters,verbs=get;list;watch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -133,13 +149,7 @@ func (r *DexClientReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 	}
 
 	// Fetch the mTLS client cert and create the grpc client
-	dexApiOptions := &dexapi.Options{
-		HostAndPort: fmt.Sprintf("%s.%s.%s%s", GRPC_SERVICE_NAME, dexv1Client.Namespace, "svc.cluster.local", ":5557"),
-		CABuffer:    bytes.NewBuffer(mTLSSecret.Data["ca.crt"]),
-		CrtBuffer:   bytes.NewBuffer(mTLSSecret.Data["client.crt"]),
-		KeyBuffer:   bytes.NewBuffer(mTLSSecret.Data["client.key"]),
-	}
-	dexApiClient, err := DexapiNewClientPEM(dexApiOptions)
+	dexApiClient, release, err := r.DexConnections.Get(ctx, newDexAPIOptions(dexv1Client.Namespace, mTLSSecret))
 	if err != nil {
 		log.Error(err, "Failed to create api client connection to gRPC server", "client", dexv1Client.Name)
 		cond := metav1.Condition{
@@ -151,15 +161,14 @@ func (r *DexClientReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		if err := r.updateDexClientStatusConditions(dexv1Client, ctx, cond); err != nil {
 			return ctrl.Result{}, err
 		}
-		return ctrl.Result{}, err
+		return dexClientFailureResult(dexv1Client, &dexClientFailure{reason: "GRPCConnectionFailed", err: err})
 	}
-
-	defer dexApiClient.CloseConnection()
+	defer release()
 
 	// If a deletionTimestamp exists this means the dex client is being deleted. Delete the oauth2client and remove the finalizer.
 	if dexv1Client.DeletionTimestamp != nil {
 		if _, err := r.DeleteOAuth2Client(dexApiClient, dexv1Client, ctx); err != nil {
-			return reconcile.Result{}, err
+			return dexClientFailureResult(dexv1Client, err)
 		}
 		controllerutil.RemoveFinalizer(dexv1Client, DEXCLIENT_FINALIZER)
 		if err := r.Client.Update(context.TODO(), dexv1Client); err != nil {
@@ -169,27 +178,276 @@ func (r *DexClientReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		return reconcile.Result{}, nil
 	}
 
+	if err := r.syncGeneratedRedirectURIs(dexv1Client, ctx); err != nil {
+		log.Error(err, "Failed to expand the redirect URI templates", "client", dexv1Client.Name)
+		cond := metav1.Condition{
+			Type:    authv1alpha1.DexClientConditionTypeApplied,
+			Status:  metav1.ConditionFalse,
+			Reason:  "RedirectURITemplateFailed",
+			Message: fmt.Sprintf("failed expanding redirect URI templates. error: %s", err.Error()),
+		}
+		if err := r.updateDexClientStatusConditions(dexv1Client, ctx, cond); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, err
+	}
+
+	if err := r.syncResolvedTrustedPeers(dexv1Client, ctx); err != nil {
+		log.Error(err, "Failed to resolve the trusted peers", "client", dexv1Client.Name)
+		return ctrl.Result{}, err
+	}
+
+	if valid, err := r.checkAllowedConnectors(dexApiClient, dexv1Client, ctx); err != nil {
+		log.Error(err, "Failed to check the allowed connectors", "client", dexv1Client.Name)
+		return ctrl.Result{}, err
+	} else if !valid {
+		// Wait for the DexClient or the DexServer to be fixed
+		return ctrl.Result{}, nil
+	}
+
 	hasClientSecretBeenUpdated, err := r.hasClientSecretBeenUpdated(dexv1Client, ctx)
+	if err != nil {
+		log.Error(err, "failed to check the client secret", "client", dexv1Client.Name)
+		return ctrl.Result{}, err
+	}
+
+	result, err := r.applyOAuth2Client(dexApiClient, dexv1Client, hasClientSecretBeenUpdated, ctx)
+	if err != nil {
+		return dexClientFailureResult(dexv1Client, err)
+	}
+	forgetDexClientFailures(dexv1Client)
+	if result.Requeue || result.RequeueAfter > 0 {
+		return result, nil
+	}
 
+	if err := r.updateDexClientSyncStatus(dexApiClient, dexv1Client, ctx); err != nil {
+		log.Error(err, "failed to update DexClient status")
+		return ctrl.Result{}, err
+	}
+	// Resync periodically so that changes made to the oauth2client directly in dex are detected and repaired
+	return ctrl.Result{RequeueAfter: dexClientResyncPeriod}, nil
+}
+
+// Create, update or recreate the oauth2client of a DexClient
+func (r *DexClientReconciler) applyOAuth2Client(dexApiClient dexapi.DexAPI, dexv1Client *authv1alpha1.DexClient, hasClientSecretBeenUpdated bool, ctx context.Context) (ctrl.Result, error) {
 	if !isOAuth2ClientCreated(dexv1Client.Status.Conditions) {
 		// Create a new OAuth2Client
-		r.CreateOAuth2Client(dexApiClient, dexv1Client, ctx)
-	} else {
-		if hasClientSecretBeenUpdated { // If the client secret has been updated, we will need to delete and recreate the OAuth2Client (since the dex API for UpdateClient does not accept the secret for updating)
-			// Delete OAuth2Client
-			r.DeleteOAuth2Client(dexApiClient, dexv1Client, ctx)
+		return r.CreateOAuth2Client(dexApiClient, dexv1Client, ctx)
+	}
+	if hasClientSecretBeenUpdated {
+		// If the client secret has been updated, we will need to delete and recreate the OAuth2Client (since the dex API for UpdateClient does not accept the secret for updating)
+		return r.recreateOAuth2Client(dexApiClient, dexv1Client, ctx)
+	}
+	if fields := r.getFieldsRequiringRecreate(dexv1Client, ctx); len(fields) > 0 {
+		if recreated, result, err := r.applyRecreatePolicy(dexApiClient, dexv1Client, fields, ctx); recreated || err != nil {
+			return result, err
+		}
+		// The recreate policy is Manual, apply what can be updated in place. The DexClient stays not applied until the
+		// oauth2client is recreated.
+		return r.updateOAuth2Client(dexApiClient, dexv1Client, nil, ctx)
+	}
+	if r.checkOAuth2ClientDrift(dexv1Client, ctx) {
+		// The oauth2client is missing from dex or cannot be repaired in place, recreate it
+		return r.recreateOAuth2Client(dexApiClient, dexv1Client, ctx)
+	}
+	// Update Oauth2Client
+	return r.UpdateOAuth2Client(dexApiClient, dexv1Client, ctx)
+}
 
-			// Recreate a OAuth2Client
-			r.CreateOAuth2Client(dexApiClient, dexv1Client, ctx)
-		} else {
-			// Update Oauth2Client
-			r.UpdateOAuth2Client(dexApiClient, dexv1Client, ctx)
+// Apply the fields which cannot be updated in place according to the recreate policy of the DexClient: the
+// oauth2client is recreated, or the fields are listed in the RecreateRequired condition and the DexClient is marked
+// as not applied. Returns true when the oauth2client was recreated.
+func (r *DexClientReconciler) applyRecreatePolicy(dexApiClient dexapi.DexAPI, dexv1Client *authv1alpha1.DexClient, fields []string, ctx context.Context) (bool, ctrl.Result, error) {
+	log := ctrllog.FromContext(ctx)
+
+	if getRecreatePolicy(dexv1Client) == authv1alpha1.RecreatePolicyAutomatic {
+		// UpdateClient cannot change these fields, recreate the OAuth2Client to apply them
+		log.Info("Recreating dex client", "name", dexv1Client.Name, "fields", fields)
+		r.Recorder.Eventf(dexv1Client, corev1.EventTypeNormal, "Recreating",
+			"oauth2client is recreated to apply %s", strings.Join(fields, ", "))
+		result, err := r.recreateOAuth2Client(dexApiClient, dexv1Client, ctx)
+		return true, result, err
+	}
+	message := fmt.Sprintf("oauth2client must be recreated to apply %s", strings.Join(fields, ", "))
+	recreateRequired := metav1.Condition{
+		Type:               authv1alpha1.DexClientConditionTypeRecreateRequired,
+		Status:             metav1.ConditionTrue,
+		Reason:             "ImmutableFieldChanged",
+		Message:            message,
+		ObservedGeneration: dexv1Client.Generation,
+	}
+	applied := metav1.Condition{
+		Type:               authv1alpha1.DexClientConditionTypeApplied,
+		Status:             metav1.ConditionFalse,
+		Reason:             "RecreateRequired",
+		Message:            message,
+		ObservedGeneration: dexv1Client.Generation,
+	}
+	return false, ctrl.Result{}, r.updateDexClientStatusConditions(dexv1Client, ctx, recreateRequired, applied)
+}
+
+// Delete the oauth2client and create it again
+func (r *DexClientReconciler) recreateOAuth2Client(dexApiClient dexapi.DexAPI, dexv1Client *authv1alpha1.DexClient, ctx context.Context) (ctrl.Result, error) {
+	if result, err := r.DeleteOAuth2Client(dexApiClient, dexv1Client, ctx); err != nil {
+		return result, err
+	}
+	return r.CreateOAuth2Client(dexApiClient, dexv1Client, ctx)
+}
+
+// The oauth2client that dex should hold for a DexClient
+func desiredOAuth2Client(dexv1Client *authv1alpha1.DexClient) *api.Client {
+	return &api.Client{
+		Id:           dexv1Client.Spec.ClientID,
+		RedirectUris: getRedirectURIs(dexv1Client),
+		TrustedPeers: getTrustedPeers(dexv1Client),
+		Public:       dexv1Client.Spec.Public,
+		Name:         dexv1Client.Name,
+		LogoUrl:      dexv1Client.Spec.LogoURL,
+	}
+}
+
+// List the fields of the DexClient which changed since the oauth2client was created and cannot be applied with
+// UpdateClient. The public flag of the oauth2client is recorded in an annotation when it is created. For adopted
+// clients, and clients created before the annotation existed, it is read from the dex storage.
+func (r *DexClientReconciler) getFieldsRequiringRecreate(dexv1Client *authv1alpha1.DexClient, ctx context.Context) []string {
+	log := ctrllog.FromContext(ctx)
+	fields := []string{}
+	public, ok := dexv1Client.Annotations[DEX_CLIENT_PUBLIC_ANNOTATION]
+	if !ok {
+		storedClient, err := dexapi.GetStoredClient(ctx, r.Client, dexv1Client.Namespace, dexv1Client.Spec.ClientID)
+		if err != nil {
+			// Nothing to compare against until the dex storage can be read
+			log.V(1).Info("unable to read oauth2client from dex storage, skipping the public flag check", "error", err.Error())
+			return fields
 		}
+		if err := r.recordAppliedPublicFlag(dexv1Client, storedClient.Public, ctx); err != nil {
+			log.Error(err, "failed to record the public flag of the DexClient")
+		}
+		public = strconv.FormatBool(storedClient.Public)
 	}
-	return ctrl.Result{}, nil
+	applied := &api.Client{Public: public == strconv.FormatBool(true)}
+	desired := &api.Client{Public: dexv1Client.Spec.Public}
+	fields = dexapi.FieldsRequiringRecreate(applied, desired)
+	if len(fields) == 0 && meta.IsStatusConditionTrue(dexv1Client.Status.Conditions, authv1alpha1.DexClientConditionTypeRecreateRequired) {
+		cond := metav1.Condition{
+			Type:               authv1alpha1.DexClientConditionTypeRecreateRequired,
+			Status:             metav1.ConditionFalse,
+			Reason:             "UpToDate",
+			Message:            "oauth2client matches the immutable fields of the DexClient",
+			ObservedGeneration: dexv1Client.Generation,
+		}
+		if err := r.updateDexClientStatusConditions(dexv1Client, ctx, cond); err != nil {
+			log.Error(err, "failed to update DexClient status")
+		}
+	}
+	return fields
+}
+
+// Record the public flag of the oauth2client held by dex
+func (r *DexClientReconciler) recordAppliedPublicFlag(dexv1Client *authv1alpha1.DexClient, applied bool, ctx context.Context) error {
+	if dexv1Client.Annotations == nil {
+		dexv1Client.Annotations = map[string]string{}
+	}
+	public := strconv.FormatBool(applied)
+	if dexv1Client.Annotations[DEX_CLIENT_PUBLIC_ANNOTATION] == public {
+		return nil
+	}
+	dexv1Client.Annotations[DEX_CLIENT_PUBLIC_ANNOTATION] = public
+	return r.Update(ctx, dexv1Client)
+}
+
+// The recreate policy of a DexClient, defaults to Automatic
+func getRecreatePolicy(dexv1Client *authv1alpha1.DexClient) authv1alpha1.RecreatePolicy {
+	if dexv1Client.Spec.RecreatePolicy == authv1alpha1.RecreatePolicyManual {
+		return authv1alpha1.RecreatePolicyManual
+	}
+	return authv1alpha1.RecreatePolicyAutomatic
+}
+
+// Compare the oauth2client held in dex storage with the DexClient. Differences found while the current spec has
+// already been applied are drift: they are recorded in the Drifted condition and an Event, and repaired by the caller.
+// Returns true if the oauth2client has to be recreated because it is missing or cannot be repaired in place.
+func (r *DexClientReconciler) checkOAuth2ClientDrift(dexv1Client *authv1alpha1.DexClient, ctx context.Context) bool {
+	log := ctrllog.FromContext(ctx)
+
+	var reason, message string
+	recreate := false
+	storedClient, err := dexapi.GetStoredClient(ctx, r.Client, dexv1Client.Namespace, dexv1Client.Spec.ClientID)
+	switch {
+	case err == nil:
+		if !isDexClientSpecApplied(dexv1Client) {
+			// The spec has changed since it was last applied, differences are expected and not drift
+			return false
+		}
+		driftedFields := oauth2ClientDriftedFields(desiredOAuth2Client(dexv1Client), storedClient)
+		if len(driftedFields) == 0 {
+			cond := metav1.Condition{
+				Type:    authv1alpha1.DexClientConditionTypeDrifted,
+				Status:  metav1.ConditionFalse,
+				Reason:  "InSync",
+				Message: "oauth2client matches the DexClient",
+			}
+			if err := r.updateDexClientStatusConditions(dexv1Client, ctx, cond); err != nil {
+				log.Error(err, "failed to update DexClient status")
+			}
+			return false
+		}
+		// The public flag cannot be changed through UpdateClient
+		recreate = sets.NewString(driftedFields...).Has("public")
+		reason = "Modified"
+		message = fmt.Sprintf("oauth2client was modified in dex (%s)", strings.Join(driftedFields, ", "))
+	case kubeerrors.IsNotFound(err):
+		recreate = true
+		reason = "Missing"
+		message = "oauth2client is missing from dex"
+	default:
+		// The dex storage may not be readable yet (for example before dex has registered its resources)
+		log.V(1).Info("unable to read oauth2client from dex storage, skipping drift check", "error", err.Error())
+		return false
+	}
+
+	log.Info("Client drift detected", "name", dexv1Client.Name, "reason", reason, "message", message)
+	r.Recorder.Event(dexv1Client, corev1.EventTypeWarning, "Drifted", message+", repairing")
+	cond := metav1.Condition{
+		Type:    authv1alpha1.DexClientConditionTypeDrifted,
+		Status:  metav1.ConditionTrue,
+		Reason:  reason,
+		Message: message,
+	}
+	if err := r.updateDexClientStatusConditions(dexv1Client, ctx, cond); err != nil {
+		log.Error(err, "failed to update DexClient status")
+	}
+	return recreate
 }
 
-func (r *DexClientReconciler) CreateOAuth2Client(dexApiClient *dexapi.APIClient, dexv1Client *authv1alpha1.DexClient, ctx context.Context) (ctrl.Result, error) {
+// List the fields of the actual oauth2client which differ from the desired one
+func oauth2ClientDriftedFields(desired *api.Client, actual *api.Client) []string {
+	driftedFields := []string{}
+	if !sets.NewString(desired.RedirectUris...).Equal(sets.NewString(actual.RedirectUris...)) {
+		driftedFields = append(driftedFields, "redirectURIs")
+	}
+	if !sets.NewString(desired.TrustedPeers...).Equal(sets.NewString(actual.TrustedPeers...)) {
+		driftedFields = append(driftedFields, "trustedPeers")
+	}
+	if desired.Name != actual.Name {
+		driftedFields = append(driftedFields, "name")
+	}
+	if desired.LogoUrl != actual.LogoUrl {
+		driftedFields = append(driftedFields, "logoURL")
+	}
+	if desired.Public != actual.Public {
+		driftedFields = append(driftedFields, "public")
+	}
+	return driftedFields
+}
+
+// The current spec has been applied when the Applied condition is true for the current generation
+func isDexClientSpecApplied(dexv1Client *authv1alpha1.DexClient) bool {
+	cond := meta.FindStatusCondition(dexv1Client.Status.Conditions, authv1alpha1.DexClientConditionTypeApplied)
+	return cond != nil && cond.Status == metav1.ConditionTrue && cond.ObservedGeneration == dexv1Client.Generation
+}
+
+func (r *DexClientReconciler) CreateOAuth2Client(dexApiClient dexapi.DexAPI, dexv1Client *authv1alpha1.DexClient, ctx context.Context) (ctrl.Result, error) {
 	log := ctrllog.FromContext(ctx)
 
 	log.Info("Creating dex client", "name", dexv1Client.Name,
@@ -214,22 +472,26 @@ func (r *DexClientReconciler) CreateOAuth2Client(dexApiClient *dexapi.APIClient,
 		if err := r.updateDexClientStatusConditions(dexv1Client, ctx, cond); err != nil {
 			return ctrl.Result{}, err
 		}
-		return ctrl.Result{}, err
+		return ctrl.Result{}, &dexClientFailure{reason: "DexClientSecretFailed", err: err}
 	}
 
 	// Implement dex auth client creation here
+	desired := desiredOAuth2Client(dexv1Client)
 	res, createClientError := dexApiClient.CreateClient(
 		ctx,
-		dexv1Client.Spec.RedirectURIs,
-		dexv1Client.Spec.TrustedPeers,
-		dexv1Client.Spec.Public,
-		dexv1Client.Name,
-		dexv1Client.Spec.ClientID,
-		dexv1Client.Spec.LogoURL,
+		desired.RedirectUris,
+		desired.TrustedPeers,
+		desired.Public,
+		desired.Name,
+		desired.Id,
+		desired.LogoUrl,
 		dexclientclientSecret,
 	)
 	if createClientError != nil {
-		if createClientError.AlreadyExists {
+		if dexapi.IsAlreadyExists(createClientError) && !isOAuth2ClientCreated(dexv1Client.Status.Conditions) {
+			// The oauth2client was not created for this DexClient, the adoption policy decides who owns it
+			return r.adoptOAuth2Client(dexApiClient, dexv1Client, ctx)
+		} else if dexapi.IsAlreadyExists(createClientError) {
 			// We didn't expect an oauth2client, but it's there... requeue to call UpdateClient instead
 			cond := metav1.Condition{
 				Type:    authv1alpha1.DexClientConditionTypeOAuth2ClientCreated,
@@ -242,25 +504,26 @@ func (r *DexClientReconciler) CreateOAuth2Client(dexApiClient *dexapi.APIClient,
 			}
 			return ctrl.Result{Requeue: true}, nil
 		} else {
-			log.Error(createClientError.ApiError, "Client create failed", "client", dexv1Client.Name)
+			log.Error(createClientError, "Client create failed", "client", dexv1Client.Name)
 			cond := metav1.Condition{
 				Type:    authv1alpha1.DexClientConditionTypeApplied,
 				Status:  metav1.ConditionFalse,
 				Reason:  "DexClientCreateFailed",
-				Message: fmt.Sprintf("failed creating client. error: %s", createClientError.ApiError.Error()),
+				Message: fmt.Sprintf("failed creating client. error: %s", createClientError.Error()),
 			}
 			if err := r.updateDexClientStatusConditions(dexv1Client, ctx, cond); err != nil {
 				return ctrl.Result{}, err
 			}
-			return ctrl.Result{}, createClientError.ApiError
+			return ctrl.Result{}, &dexClientFailure{reason: "DexClientCreateFailed", err: createClientError}
 		}
 	} else {
 		log.Info("Client created", "client ID", res.GetId())
 		condApplied := metav1.Condition{
-			Type:    authv1alpha1.DexClientConditionTypeApplied,
-			Status:  metav1.ConditionTrue,
-			Reason:  "Created",
-			Message: "Dex client is created",
+			Type:               authv1alpha1.DexClientConditionTypeApplied,
+			Status:             metav1.ConditionTrue,
+			Reason:             "Created",
+			Message:            "Dex client is created",
+			ObservedGeneration: dexv1Client.Generation,
 		}
 		condOauth := metav1.Condition{
 			Type:    authv1alpha1.DexClientConditionTypeOAuth2ClientCreated,
@@ -268,26 +531,143 @@ func (r *DexClientReconciler) CreateOAuth2Client(dexApiClient *dexapi.APIClient,
 			Reason:  "Created",
 			Message: "oauth2client is created",
 		}
+		dexv1Client.Status.Adopted = false
 		if err := r.updateDexClientStatusConditions(dexv1Client, ctx, condApplied, condOauth); err != nil {
 			return ctrl.Result{}, err
 		}
+		if err := r.recordAppliedPublicFlag(dexv1Client, desired.Public, ctx); err != nil {
+			return ctrl.Result{}, err
+		}
 	}
 	return ctrl.Result{}, nil
 }
 
-func (r *DexClientReconciler) UpdateOAuth2Client(dexApiClient *dexapi.APIClient, dexv1Client *authv1alpha1.DexClient, ctx context.Context) (ctrl.Result, error) {
+// Handle an oauth2client that already exists in dex but was not created for this DexClient
+func (r *DexClientReconciler) adoptOAuth2Client(dexApiClient dexapi.DexAPI, dexv1Client *authv1alpha1.DexClient, ctx context.Context) (ctrl.Result, error) {
+	log := ctrllog.FromContext(ctx)
+	policy := getAdoptionPolicy(dexv1Client)
+	log.Info("Client already exists in dex", "name", dexv1Client.Name, "ClientID", dexv1Client.Spec.ClientID, "adoptionPolicy", policy)
+
+	switch policy {
+	case authv1alpha1.AdoptionPolicyAdopt:
+		if mismatch, err := r.hasAdoptedClientSecretMismatch(dexv1Client, ctx); err != nil {
+			return ctrl.Result{}, err
+		} else if mismatch {
+			// UpdateClient cannot change the secret, recreate the oauth2client with the secret of clientSecretRef
+			r.Recorder.Eventf(dexv1Client, corev1.EventTypeNormal, "Adopted",
+				"adopted existing oauth2client %q, recreating it with the secret of clientSecretRef", dexv1Client.Spec.ClientID)
+			if result, err := r.recreateOAuth2Client(dexApiClient, dexv1Client, ctx); err != nil || result.Requeue {
+				return result, err
+			}
+			dexv1Client.Status.Adopted = true
+			if err := r.Client.Status().Update(ctx, dexv1Client); err != nil {
+				return ctrl.Result{}, err
+			}
+			return ctrl.Result{}, nil
+		}
+		r.Recorder.Eventf(dexv1Client, corev1.EventTypeNormal, "Adopted", "adopted existing oauth2client %q", dexv1Client.Spec.ClientID)
+		cond := metav1.Condition{
+			Type:    authv1alpha1.DexClientConditionTypeOAuth2ClientCreated,
+			Status:  metav1.ConditionTrue,
+			Reason:  "Adopted",
+			Message: "existing oauth2client is adopted",
+		}
+		dexv1Client.Status.Adopted = true
+		if err := r.updateDexClientStatusConditions(dexv1Client, ctx, cond); err != nil {
+			return ctrl.Result{}, err
+		}
+		// Requeue to apply the DexClient to the adopted oauth2client with UpdateClient
+		return ctrl.Result{Requeue: true}, nil
+	case authv1alpha1.AdoptionPolicyOverwrite:
+		r.Recorder.Eventf(dexv1Client, corev1.EventTypeNormal, "Overwritten", "deleting existing oauth2client %q to create it again", dexv1Client.Spec.ClientID)
+		if _, err := r.DeleteOAuth2Client(dexApiClient, dexv1Client, ctx); err != nil {
+			return ctrl.Result{}, err
+		}
+		// Requeue to create the oauth2client from the DexClient
+		return ctrl.Result{Requeue: true}, nil
+	default:
+		message := fmt.Sprintf("oauth2client %q already exists in dex and is not adopted (adoptionPolicy: %s)", dexv1Client.Spec.ClientID, policy)
+		r.Recorder.Event(dexv1Client, corev1.EventTypeWarning, "AlreadyExists", message)
+		cond := metav1.Condition{
+			Type:    authv1alpha1.DexClientConditionTypeApplied,
+			Status:  metav1.ConditionFalse,
+			Reason:  "AlreadyExists",
+			Message: message,
+		}
+		if err := r.updateDexClientStatusConditions(dexv1Client, ctx, cond); err != nil {
+			return ctrl.Result{}, err
+		}
+		// Nothing to retry until the DexClient or the oauth2client changes
+		return ctrl.Result{}, nil
+	}
+}
+
+// Compare the secret of an oauth2client about to be adopted with the secret referenced by the DexClient. When the dex
+// storage cannot be read the secrets cannot be compared, the mismatch is then left to the next secret update.
+func (r *DexClientReconciler) hasAdoptedClientSecretMismatch(dexv1Client *authv1alpha1.DexClient, ctx context.Context) (bool, error) {
+	log := ctrllog.FromContext(ctx)
+
+	clientSecret, err := r.getClientClientSecretFromRef(dexv1Client, ctx)
+	if err != nil {
+		cond := metav1.Condition{
+			Type:    authv1alpha1.DexClientConditionTypeApplied,
+			Status:  metav1.ConditionFalse,
+			Reason:  "DexClientSecretFailed",
+			Message: fmt.Sprintf("failed getting client secret. error: %s", err.Error()),
+		}
+		if err := r.updateDexClientStatusConditions(dexv1Client, ctx, cond); err != nil {
+			return false, err
+		}
+		return false, &dexClientFailure{reason: "DexClientSecretFailed", err: err}
+	}
+	storedClient, err := dexapi.GetStoredClient(ctx, r.Client, dexv1Client.Namespace, dexv1Client.Spec.ClientID)
+	if err != nil {
+		log.V(1).Info("unable to read oauth2client from dex storage, skipping client secret check", "error", err.Error())
+		return false, nil
+	}
+	return storedClient.Secret != clientSecret, nil
+}
+
+// The adoption policy of a DexClient, the annotation takes precedence over the spec
+func getAdoptionPolicy(dexv1Client *authv1alpha1.DexClient) authv1alpha1.AdoptionPolicy {
+	switch policy := authv1alpha1.AdoptionPolicy(dexv1Client.Annotations[DEX_CLIENT_ADOPTION_ANNOTATION]); policy {
+	case authv1alpha1.AdoptionPolicyAdopt, authv1alpha1.AdoptionPolicyFail, authv1alpha1.AdoptionPolicyOverwrite:
+		return policy
+	}
+	if dexv1Client.Spec.AdoptionPolicy != "" {
+		return dexv1Client.Spec.AdoptionPolicy
+	}
+	return authv1alpha1.AdoptionPolicyFail
+}
+
+func (r *DexClientReconciler) UpdateOAuth2Client(dexApiClient dexapi.DexAPI, dexv1Client *authv1alpha1.DexClient, ctx context.Context) (ctrl.Result, error) {
+	return r.updateOAuth2Client(dexApiClient, dexv1Client, &metav1.Condition{
+		Type:               authv1alpha1.DexClientConditionTypeApplied,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Updated",
+		Message:            "Dex client is updated",
+		ObservedGeneration: dexv1Client.Generation,
+	}, ctx)
+}
+
+// Update the oauth2client in place and set the applied condition once it is updated, unless it is nil
+func (r *DexClientReconciler) updateOAuth2Client(dexApiClient dexapi.DexAPI, dexv1Client *authv1alpha1.DexClient, applied *metav1.Condition, ctx context.Context) (ctrl.Result, error) {
 	log := ctrllog.FromContext(ctx)
 	// Update Client
 	log.Info("Client update", "name", dexv1Client.Name)
+	desired := desiredOAuth2Client(dexv1Client)
 	err := dexApiClient.UpdateClient(
 		ctx,
-		dexv1Client.Spec.ClientID,
-		dexv1Client.Spec.RedirectURIs,
-		dexv1Client.Spec.TrustedPeers,
-		dexv1Client.Spec.Public,
-		dexv1Client.Name,
-		dexv1Client.Spec.LogoURL,
+		desired.Id,
+		desired.RedirectUris,
+		desired.TrustedPeers,
+		desired.Name,
+		desired.LogoUrl,
 	)
+	if dexapi.IsUnimplemented(err) {
+		// The dex server predates UpdateClient, changes can only be applied by recreating the oauth2client
+		return r.applyWithoutUpdateClient(dexApiClient, dexv1Client, ctx)
+	}
 	if err != nil {
 		log.Error(err, "Client update failed", "name", dexv1Client.Name)
 		cond := metav1.Condition{
@@ -299,23 +679,51 @@ func (r *DexClientReconciler) UpdateOAuth2Client(dexApiClient *dexapi.APIClient,
 		if err := r.updateDexClientStatusConditions(dexv1Client, ctx, cond); err != nil {
 			return ctrl.Result{}, err
 		}
-		return ctrl.Result{}, err
+		return ctrl.Result{}, &dexClientFailure{reason: "DexClientUpdateFailed", err: err}
 	} else {
 		log.Info("Client updated", "name", dexv1Client.Name)
-		cond := metav1.Condition{
-			Type:    authv1alpha1.DexClientConditionTypeApplied,
-			Status:  metav1.ConditionTrue,
-			Reason:  "Updated",
-			Message: "Dex client is updated",
+		if applied == nil {
+			return ctrl.Result{}, nil
 		}
-		if err := r.updateDexClientStatusConditions(dexv1Client, ctx, cond); err != nil {
+		if err := r.updateDexClientStatusConditions(dexv1Client, ctx, *applied); err != nil {
 			return ctrl.Result{}, err
 		}
 	}
 	return ctrl.Result{}, nil
 }
 
-func (r *DexClientReconciler) DeleteOAuth2Client(dexApiClient *dexapi.APIClient, dexv1Client *authv1alpha1.DexClient, ctx context.Context) (ctrl.Result, error) {
+// Apply the DexClient to a dex server which does not serve UpdateClient. Every field then requires a recreate, the
+// oauth2client held by the dex storage tells which ones changed; when it cannot be read, all the fields of a DexClient
+// changed since it was last applied are assumed to have changed.
+func (r *DexClientReconciler) applyWithoutUpdateClient(dexApiClient dexapi.DexAPI, dexv1Client *authv1alpha1.DexClient, ctx context.Context) (ctrl.Result, error) {
+	log := ctrllog.FromContext(ctx)
+
+	fields := []string{}
+	storedClient, err := dexapi.GetStoredClient(ctx, r.Client, dexv1Client.Namespace, dexv1Client.Spec.ClientID)
+	if err == nil {
+		fields = oauth2ClientDriftedFields(desiredOAuth2Client(dexv1Client), storedClient)
+	} else if !isDexClientSpecApplied(dexv1Client) {
+		log.V(1).Info("unable to read oauth2client from dex storage", "error", err.Error())
+		fields = []string{"redirectURIs", "trustedPeers", "name", "logoURL"}
+	}
+	if len(fields) > 0 {
+		if recreated, result, err := r.applyRecreatePolicy(dexApiClient, dexv1Client, fields, ctx); recreated || err != nil {
+			return result, err
+		}
+		// Nothing can be applied in place, wait for the oauth2client to be recreated
+		return ctrl.Result{}, nil
+	}
+	cond := metav1.Condition{
+		Type:               authv1alpha1.DexClientConditionTypeApplied,
+		Status:             metav1.ConditionTrue,
+		Reason:             "UpToDate",
+		Message:            "Dex client is up to date",
+		ObservedGeneration: dexv1Client.Generation,
+	}
+	return ctrl.Result{}, r.updateDexClientStatusConditions(dexv1Client, ctx, cond)
+}
+
+func (r *DexClientReconciler) DeleteOAuth2Client(dexApiClient dexapi.DexAPI, dexv1Client *authv1alpha1.DexClient, ctx context.Context) (ctrl.Result, error) {
 	log := ctrllog.FromContext(ctx)
 	// Delete Client
 	log.Info("Client delete", "client ID", dexv1Client.Name)
@@ -323,9 +731,9 @@ func (r *DexClientReconciler) DeleteOAuth2Client(dexApiClient *dexapi.APIClient,
 		ctx,
 		dexv1Client.Spec.ClientID,
 	)
-	if err != nil && !err.NotFound { // Ignore the error if the client wasn't found
-		log.Error(err.ApiError, "Client deletion failed", "client", dexv1Client.Name)
-		return ctrl.Result{}, err.ApiError
+	if err != nil && !dexapi.IsNotFound(err) { // Ignore the error if the client wasn't found
+		log.Error(err, "Client deletion failed", "client", dexv1Client.Name)
+		return ctrl.Result{}, &dexClientFailure{reason: "DexClientDeleteFailed", err: err}
 	}
 	return ctrl.Result{}, nil
 }
@@ -437,6 +845,9 @@ func DexClientHasCondition(dexClient *authv1alpha1.DexClient, c metav1.Condition
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *DexClientReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if r.DexConnections == nil {
+		r.DexConnections = dexapi.NewConnectionManager(dexapi.NewDexAPI)
+	}
 
 	dexClientPredicate := predicate.Predicate(predicate.Funcs{
 		GenericFunc: func(e event.GenericEvent) bool { return false },
@@ -445,9 +856,10 @@ func (r *DexClientReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		UpdateFunc: func(e event.UpdateEvent) bool {
 			dexClientOld := e.ObjectOld.(*authv1alpha1.DexClient)
 			dexClientNew := e.ObjectNew.(*authv1alpha1.DexClient)
-			// only handle the Finalizer and Spec changes
+			// only handle the Finalizer, adoption policy annotation and Spec changes
 			return !equality.Semantic.DeepEqual(e.ObjectOld.GetFinalizers(), e.ObjectNew.GetFinalizers()) ||
 				!equality.Semantic.DeepEqual(e.ObjectOld.GetDeletionTimestamp(), e.ObjectNew.GetDeletionTimestamp()) ||
+				e.ObjectOld.GetAnnotations()[DEX_CLIENT_ADOPTION_ANNOTATION] != e.ObjectNew.GetAnnotations()[DEX_CLIENT_ADOPTION_ANNOTATION] ||
 				!equality.Semantic.DeepEqual(dexClientOld.Spec, dexClientNew.Spec)
 
 		},
@@ -464,8 +876,71 @@ func (r *DexClientReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		},
 	}
 
-	return ctrl.NewControllerManagedBy(mgr).
+	controllerBuilder := ctrl.NewControllerManagedBy(mgr)
+
+	// Regenerate the redirect URIs as managed clusters join or leave, when the ManagedCluster kind is installed
+	if _, err := mgr.GetRESTMapper().RESTMapping(ManagedClusterGVK.GroupKind(), ManagedClusterGVK.Version); err == nil {
+		managedCluster := &unstructured.Unstructured{}
+		managedCluster.SetGroupVersionKind(ManagedClusterGVK)
+		controllerBuilder = controllerBuilder.Watches(&source.Kind{Type: managedCluster},
+			handler.EnqueueRequestsFromMapFunc(func(a client.Object) []reconcile.Request {
+				var dexClientList authv1alpha1.DexClientList
+				_ = mgr.GetClient().List(context.TODO(), &dexClientList)
+
+				var requests = []reconcile.Request{}
+
+				for _, dexClient := range dexClientList.Items {
+					if len(dexClient.Spec.RedirectURITemplates) == 0 {
+						continue
+					}
+					requests = append(requests, reconcile.Request{
+						NamespacedName: types.NamespacedName{
+							Name:      dexClient.Name,
+							Namespace: dexClient.Namespace,
+						},
+					})
+				}
+				return requests
+			}),
+			builder.WithPredicates(predicate.Or(predicate.LabelChangedPredicate{}, predicate.AnnotationChangedPredicate{})))
+	}
+
+	// Resolve the trusted peers again when a referenced DexClient is created, deleted or changes its client ID
+	trustedPeerPredicate := predicate.Funcs{
+		GenericFunc: func(e event.GenericEvent) bool { return false },
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return e.ObjectOld.(*authv1alpha1.DexClient).Spec.ClientID != e.ObjectNew.(*authv1alpha1.DexClient).Spec.ClientID
+		},
+	}
+
+	return controllerBuilder.
 		For(&authv1alpha1.DexClient{}, builder.WithPredicates(dexClientPredicate)).
+		Watches(&source.Kind{Type: &authv1alpha1.DexServer{}}, // Check the allowed connectors again when the connectors of the DexServer change
+			handler.EnqueueRequestsFromMapFunc(func(a client.Object) []reconcile.Request {
+				var dexClientList authv1alpha1.DexClientList
+				_ = mgr.GetClient().List(context.TODO(), &dexClientList, client.InNamespace(a.GetNamespace()))
+
+				var requests = []reconcile.Request{}
+
+				for _, dexClient := range dexClientList.Items {
+					if len(dexClient.Spec.AllowedConnectors) == 0 {
+						continue
+					}
+					requests = append(requests, reconcile.Request{
+						NamespacedName: types.NamespacedName{
+							Name:      dexClient.Name,
+							Namespace: dexClient.Namespace,
+						},
+					})
+				}
+				return requests
+			}),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(&source.Kind{Type: &authv1alpha1.DexClient{}},
+			handler.EnqueueRequestsFromMapFunc(func(a client.Object) []reconcile.Request {
+				return dexClientsReferencingPeer(mgr.GetClient(), a)
+			}),
+			builder.WithPredicates(trustedPeerPredicate)).
 		Owns(&corev1.Secret{}).
 		Watches(&source.Kind{Type: &corev1.Secret{}}, // Since the client secrets for Dex Clients are not generated by this controller, updates to them will not trigger the reconcile loop. We need map them to a resource (dex client) that is managed by this controller.
 			handler.EnqueueRequestsFromMapFunc(func(a client.Object) []reconcile.Request {
@@ -504,6 +979,16 @@ func (r *DexClientReconciler) getMTLSSecret(m *authv1alpha1.DexClient, ctx conte
 	return resource, nil
 }
 
+// The options to connect to the gRPC API of the dex server running in namespace with its mTLS secret
+func newDexAPIOptions(namespace string, mTLSSecret *corev1.Secret) *dexapi.Options {
+	return &dexapi.Options{
+		HostAndPort: fmt.Sprintf("%s.%s.%s%s", GRPC_SERVICE_NAME, namespace, "svc.cluster.local", ":5557"),
+		CABuffer:    bytes.NewBuffer(mTLSSecret.Data["ca.crt"]),
+		CrtBuffer:   bytes.NewBuffer(mTLSSecret.Data["client.crt"]),
+		KeyBuffer:   bytes.NewBuffer(mTLSSecret.Data["client.key"]),
+	}
+}
+
 func (r *DexClientReconciler) getClientClientSecretFromRef(m *authv1alpha1.DexClient, ctx context.Context) (string, error) {
 	log := ctrllog.FromContext(ctx)
 	secretName := m.Spec.ClientSecretRef.Name
@@ -3,7 +3,11 @@
 package controllers
 
 import (
+	"bytes"
 	"context"
+	"fmt"
+	"sync"
+	"text/template"
 	"time"
 
 	api "github.com/dexidp/dex/api/v2"
@@ -12,8 +16,12 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -52,7 +60,7 @@ func (m *MockDexAPIClient) ListPasswords(ctx context.Context, in *api.ListPasswo
 	return nil, nil
 }
 func (m *MockDexAPIClient) GetVersion(ctx context.Context, in *api.VersionReq, opts ...grpc.CallOption) (*api.VersionResp, error) {
-	return nil, nil
+	return &api.VersionResp{Server: "v2.30.0", Api: 2}, nil
 }
 func (m *MockDexAPIClient) ListRefresh(ctx context.Context, in *api.ListRefreshReq, opts ...grpc.CallOption) (*api.ListRefreshResp, error) {
 	return nil, nil
@@ -67,6 +75,21 @@ func (m *MockDexAPIClient) CloseConnection() error {
 	return nil
 }
 
+// A DexClient reconciler calling MockDexAPIClient
+func newMockedDexClientReconciler() *DexClientReconciler {
+	return newTestDexClientReconciler(func(ctx context.Context, opts *dexapi.Options) (dexapi.DexAPI, error) {
+		// Mock GRPC connection
+		conn, err := grpc.Dial("localhost:3000", grpc.WithInsecure())
+		if err != nil {
+			return nil, err
+		}
+		return &dexapi.APIClient{
+			Dex: new(MockDexAPIClient),
+			Cc:  conn,
+		}, nil
+	})
+}
+
 var _ = Describe("Process DexClient CR", func() {
 	MyDexClientName := "dex-client-cluster1"
 	MyDexClientNamespace := "dex-client-cluster1-ns"
@@ -190,8 +213,8 @@ var _ = Describe("Process DexClient CR", func() {
 				req := ctrl.Request{}
 				req.Name = MyDexClientName
 				req.Namespace = MyDexClientNamespace
-				_, err := rDexClient.Reconcile(context.TODO(), req)
-				return err != nil // Reconcile will have an error
+				result, err := rDexClient.Reconcile(context.TODO(), req)
+				return err == nil && result.RequeueAfter > 0 // Reconcile will back off
 			}, 10, 5).Should(BeTrue())
 		})
 		err := k8sClient.Get(ctx, client.ObjectKey{Name: MyDexClientName, Namespace: MyDexClientNamespace}, dexClient)
@@ -200,25 +223,16 @@ var _ = Describe("Process DexClient CR", func() {
 		Expect(dexClient.Status.Conditions[0].Reason).To(Equal("GRPCConnectionFailed"))
 	})
 	It("should apply CR (status condition: Created) if dex api and grpc are mocked", func() {
+		var r *DexClientReconciler
 		By("mocking the dex api client and grpc connection", func() {
-			DexapiNewClientPEM = func(opts *dexapi.Options) (*dexapi.APIClient, error) {
-				// Mock dex API client
-				dexApiClient := new(MockDexAPIClient)
-				// Mock GRPC connection
-				conn, err := grpc.Dial("localhost:3000", grpc.WithInsecure())
-				Expect(err).To(BeNil())
-				return &dexapi.APIClient{
-					Dex: dexApiClient,
-					Cc:  conn,
-				}, nil
-			}
+			r = newMockedDexClientReconciler()
 		})
 		By("running reconcile", func() {
 			Eventually(func() bool {
 				req := ctrl.Request{}
 				req.Name = MyDexClientName
 				req.Namespace = MyDexClientNamespace
-				_, err := rDexClient.Reconcile(context.TODO(), req)
+				_, err := r.Reconcile(context.TODO(), req)
 				Expect(err).To(BeNil())
 				err = k8sClient.Get(ctx, client.ObjectKey{Name: MyDexClientName, Namespace: MyDexClientNamespace}, dexClient)
 				Expect(err).To(BeNil())
@@ -226,9 +240,17 @@ var _ = Describe("Process DexClient CR", func() {
 				return dexClient.Status.Conditions[0].Reason == "Created"
 			}, 30, 1).Should(BeTrue())
 		})
+		By("reporting the synced oauth2client in the status", func() {
+			Expect(dexClient.Status.ObservedGeneration).To(Equal(dexClient.Generation))
+			Expect(dexClient.Status.ClientID).To(Equal(dexClient.Spec.ClientID))
+			Expect(dexClient.Status.DexVersion).To(Equal("v2.30.0"))
+			Expect(dexClient.Status.LastSyncedTime).ToNot(BeNil())
+			Expect(dexClient.Status.RelatedObjects).To(Equal(getDexClientRelatedObjects(dexClient)))
+		})
 	})
 	It("should update the dex client", func() {
 		dexClient := &authv1alpha1.DexClient{}
+		r := newMockedDexClientReconciler()
 		By("retrieving the DexClient", func() {
 			err := k8sClient.Get(ctx, client.ObjectKey{Name: MyDexClientName, Namespace: MyDexClientNamespace}, dexClient)
 			Expect(err).Should(BeNil())
@@ -250,15 +272,495 @@ var _ = Describe("Process DexClient CR", func() {
 				req := ctrl.Request{}
 				req.Name = MyDexClientName
 				req.Namespace = MyDexClientNamespace
-				_, err := rDexClient.Reconcile(context.TODO(), req)
+				_, err := r.Reconcile(context.TODO(), req)
 				Expect(err).To(BeNil())
 				err = k8sClient.Get(ctx, client.ObjectKey{Name: MyDexClientName, Namespace: MyDexClientNamespace}, dexClient)
 				Expect(err).To(BeNil())
 				return dexClient.Status.Conditions[0].Reason == "Updated"
 			}, 30, 1).Should(BeTrue())
 		})
-		By("Revert NewClientPEM", func() {
-			DexapiNewClientPEM = dexapi.NewClientPEM
+	})
+})
+
+var _ = Describe("Detect drift between a DexClient and its oauth2client", func() {
+	It("should report the fields which differ from the DexClient", func() {
+		dexClient := &authv1alpha1.DexClient{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "dex-client-drift",
+			},
+			Spec: authv1alpha1.DexClientSpec{
+				ClientID:     "dex-client-drift-id",
+				RedirectURIs: []string{"https://a.example.com/callback", "https://b.example.com/callback"},
+				TrustedPeers: []string{"peer"},
+			},
+		}
+		desired := desiredOAuth2Client(dexClient)
+		By("ignoring the order of redirect URIs", func() {
+			actual := desiredOAuth2Client(dexClient)
+			actual.RedirectUris = []string{"https://b.example.com/callback", "https://a.example.com/callback"}
+			Expect(oauth2ClientDriftedFields(desired, actual)).To(BeEmpty())
+		})
+		By("detecting modified fields", func() {
+			actual := desiredOAuth2Client(dexClient)
+			actual.TrustedPeers = nil
+			actual.Public = true
+			Expect(oauth2ClientDriftedFields(desired, actual)).To(Equal([]string{"trustedPeers", "public"}))
+		})
+	})
+})
+
+var _ = Describe("Adopt existing oauth2clients", func() {
+	It("should take the adoption policy from the annotation before the spec", func() {
+		dexClient := &authv1alpha1.DexClient{}
+		Expect(getAdoptionPolicy(dexClient)).To(Equal(authv1alpha1.AdoptionPolicyFail))
+		dexClient.Spec.AdoptionPolicy = authv1alpha1.AdoptionPolicyOverwrite
+		Expect(getAdoptionPolicy(dexClient)).To(Equal(authv1alpha1.AdoptionPolicyOverwrite))
+		dexClient.Annotations = map[string]string{DEX_CLIENT_ADOPTION_ANNOTATION: "Adopt"}
+		Expect(getAdoptionPolicy(dexClient)).To(Equal(authv1alpha1.AdoptionPolicyAdopt))
+	})
+	It("should derive valid DexClient names from client IDs", func() {
+		Expect(dexClientNameForID("My_App")).To(Equal("my-app"))
+		Expect(dexClientNameForID("__")).To(Equal(dexapi.StorageObjectName("__")))
+	})
+})
+
+var _ = Describe("Apply fields which cannot be updated in place", func() {
+	It("should report the public flag as requiring a recreate", func() {
+		Expect(dexapi.FieldsRequiringRecreate(&api.Client{Public: false}, &api.Client{Public: true})).To(Equal([]string{"public"}))
+		Expect(dexapi.FieldsRequiringRecreate(&api.Client{Public: true}, &api.Client{Public: true})).To(BeEmpty())
+	})
+	It("should detect dex servers which do not serve UpdateClient", func() {
+		Expect(dexapi.IsUnimplemented(&dexapi.Error{Op: "update", Code: codes.Unimplemented, Err: fmt.Errorf("unknown method")})).To(BeTrue())
+		Expect(dexapi.IsUnimplemented(&dexapi.Error{Op: "update", Code: codes.NotFound, Err: fmt.Errorf("client not found")})).To(BeFalse())
+	})
+	It("should default the recreate policy to Automatic", func() {
+		dexClient := &authv1alpha1.DexClient{}
+		Expect(getRecreatePolicy(dexClient)).To(Equal(authv1alpha1.RecreatePolicyAutomatic))
+		dexClient.Spec.RecreatePolicy = authv1alpha1.RecreatePolicyManual
+		Expect(getRecreatePolicy(dexClient)).To(Equal(authv1alpha1.RecreatePolicyManual))
+	})
+})
+
+var _ = Describe("Expand redirect URI templates", func() {
+	It("should expand a template with the labels and claims of a cluster", func() {
+		cluster := &unstructured.Unstructured{}
+		cluster.SetGroupVersionKind(ManagedClusterGVK)
+		cluster.SetName("cluster1")
+		cluster.SetLabels(map[string]string{"region": "eu"})
+		Expect(unstructured.SetNestedSlice(cluster.Object, []interface{}{
+			map[string]interface{}{"name": "consoleurl.cluster.open-cluster-management.io", "value": "https://console.cluster1.example.com"},
+		}, "status", "clusterClaims")).To(Succeed())
+		data := newRedirectURITemplateData(cluster)
+
+		tmpl := template.Must(template.New("uri").Option("missingkey=error").Parse(
+			`https://oauth.{{ .Name }}.{{ .Labels.region }}.example.com/callback`))
+		Expect(executeRedirectURITemplate(tmpl, data)).To(Equal("https://oauth.cluster1.eu.example.com/callback"))
+
+		tmpl = template.Must(template.New("uri").Option("missingkey=error").Parse(
+			`{{ index .ClusterClaims "consoleurl.cluster.open-cluster-management.io" }}/callback`))
+		Expect(executeRedirectURITemplate(tmpl, data)).To(Equal("https://console.cluster1.example.com/callback"))
+
+		By("leaving the rest of the cluster out of the template data", func() {
+			tmpl := template.Must(template.New("uri").Option("missingkey=error").Parse(`https://{{ .Object.metadata.name }}/callback`))
+			_, err := executeRedirectURITemplate(tmpl, data)
+			Expect(err).To(HaveOccurred())
+		})
+		By("skipping clusters with a missing label", func() {
+			tmpl := template.Must(template.New("uri").Option("missingkey=error").Parse(`https://{{ .Labels.zone }}/callback`))
+			_, err := executeRedirectURITemplate(tmpl, data)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+	It("should merge the generated redirect URIs with the spec", func() {
+		dexClient := &authv1alpha1.DexClient{}
+		dexClient.Spec.RedirectURIs = []string{"https://a.example.com/callback"}
+		dexClient.Status.GeneratedRedirectURIs = []string{"https://a.example.com/callback", "https://b.example.com/callback"}
+		Expect(getRedirectURIs(dexClient)).To(Equal([]string{"https://a.example.com/callback", "https://b.example.com/callback"}))
+	})
+})
+
+var _ = Describe("Resolve trusted peer references", func() {
+	It("should default the namespace of a reference to the namespace of the DexClient", func() {
+		dexClient := &authv1alpha1.DexClient{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "dex"}}
+		Expect(trustedPeerRefName(dexClient, authv1alpha1.DexClientReference{Name: "peer"})).To(
+			Equal(types.NamespacedName{Name: "peer", Namespace: "dex"}))
+		Expect(trustedPeerRefName(dexClient, authv1alpha1.DexClientReference{Name: "peer", Namespace: "other"})).To(
+			Equal(types.NamespacedName{Name: "peer", Namespace: "other"}))
+	})
+	It("should merge the resolved trusted peers with the spec", func() {
+		dexClient := &authv1alpha1.DexClient{}
+		dexClient.Spec.TrustedPeers = []string{"peer-a"}
+		dexClient.Status.ResolvedTrustedPeers = []string{"peer-a", "peer-b"}
+		Expect(getTrustedPeers(dexClient)).To(Equal([]string{"peer-a", "peer-b"}))
+	})
+})
+
+var _ = Describe("Restrict DexClients to a subset of connectors", func() {
+	It("should list the connectors the DexServer does not define", func() {
+		dexServers := []authv1alpha1.DexServer{{
+			Spec: authv1alpha1.DexServerSpec{
+				Connectors: []authv1alpha1.ConnectorSpec{
+					{Id: "ldap", Type: authv1alpha1.ConnectorTypeLDAP},
+					{Id: "github", Type: authv1alpha1.ConnectorTypeGitHub},
+				},
+			},
+		}}
+		Expect(unknownConnectors([]string{"ldap"}, dexServers)).To(BeEmpty())
+		Expect(unknownConnectors([]string{"ldap", "gitlab"}, dexServers)).To(Equal([]string{"gitlab"}))
+		Expect(unknownConnectors([]string{"ldap"}, nil)).To(Equal([]string{"ldap"}))
+	})
+	It("should list the connectors of the DexServer the client does not allow", func() {
+		dexServers := []authv1alpha1.DexServer{{
+			Spec: authv1alpha1.DexServerSpec{
+				Connectors: []authv1alpha1.ConnectorSpec{
+					{Id: "ldap", Type: authv1alpha1.ConnectorTypeLDAP},
+					{Id: "github", Type: authv1alpha1.ConnectorTypeGitHub},
+				},
+			},
+		}}
+		Expect(disallowedConnectors([]string{"ldap", "github"}, dexServers)).To(BeEmpty())
+		Expect(disallowedConnectors([]string{"ldap"}, dexServers)).To(Equal([]string{"github"}))
+	})
+})
+
+// A DexAPI recording whether its connection was closed
+type closeRecordingDexAPI struct {
+	*dexapi.APIClient
+	closed bool
+}
+
+func (c *closeRecordingDexAPI) CloseConnection() error {
+	c.closed = true
+	return nil
+}
+
+var _ = Describe("Share connections to dex servers", func() {
+	It("should reuse a connection until the certificates change", func() {
+		dials := 0
+		connections := dexapi.NewConnectionManager(func(ctx context.Context, opts *dexapi.Options) (dexapi.DexAPI, error) {
+			dials++
+			return &closeRecordingDexAPI{APIClient: &dexapi.APIClient{Dex: new(MockDexAPIClient)}}, nil
+		})
+		defer connections.Close()
+		options := func(crt string) *dexapi.Options {
+			return &dexapi.Options{
+				HostAndPort: "grpc.dex.svc.cluster.local:5557",
+				CABuffer:    bytes.NewBufferString("ca.crt"),
+				CrtBuffer:   bytes.NewBufferString(crt),
+				KeyBuffer:   bytes.NewBufferString("client.key"),
+			}
+		}
+
+		first, releaseFirst, err := connections.Get(context.TODO(), options("client.crt"))
+		Expect(err).To(BeNil())
+		second, releaseSecond, err := connections.Get(context.TODO(), options("client.crt"))
+		Expect(err).To(BeNil())
+		Expect(second).To(BeIdenticalTo(first))
+		Expect(dials).To(Equal(1))
+		releaseSecond()
+
+		By("reconnecting when the certificates are rotated", func() {
+			rotated, release, err := connections.Get(context.TODO(), options("rotated-client.crt"))
+			Expect(err).To(BeNil())
+			defer release()
+			Expect(rotated).ToNot(BeIdenticalTo(first))
+			Expect(dials).To(Equal(2))
+		})
+		By("closing the replaced connection once it is released", func() {
+			Expect(first.(*closeRecordingDexAPI).closed).To(BeFalse())
+			releaseFirst()
+			Expect(first.(*closeRecordingDexAPI).closed).To(BeTrue())
+		})
+		By("reconnecting after the connection is invalidated", func() {
+			connections.Invalidate("grpc.dex.svc.cluster.local:5557")
+			_, release, err := connections.Get(context.TODO(), options("rotated-client.crt"))
+			Expect(err).To(BeNil())
+			defer release()
+			Expect(dials).To(Equal(3))
+		})
+	})
+	It("should stop waiting for a connection when the context is done", func() {
+		dialing := make(chan struct{})
+		defer close(dialing)
+		connections := dexapi.NewConnectionManager(func(ctx context.Context, opts *dexapi.Options) (dexapi.DexAPI, error) {
+			<-dialing
+			return &dexapi.APIClient{Dex: new(MockDexAPIClient)}, nil
+		})
+		defer connections.Close()
+
+		ctx, cancel := context.WithTimeout(context.TODO(), 100*time.Millisecond)
+		defer cancel()
+		_, _, err := connections.Get(ctx, &dexapi.Options{HostAndPort: "grpc.dex.svc.cluster.local:5557"})
+		Expect(err).To(Equal(context.DeadlineExceeded))
+	})
+	It("should give its retry policy to the connections", func() {
+		var retryPolicy *dexapi.RetryPolicy
+		connections := dexapi.NewConnectionManager(func(ctx context.Context, opts *dexapi.Options) (dexapi.DexAPI, error) {
+			retryPolicy = opts.RetryPolicy
+			return &dexapi.APIClient{Dex: new(MockDexAPIClient)}, nil
+		})
+		defer connections.Close()
+		connections.RetryPolicy = &dexapi.RetryPolicy{MaxAttempts: 1}
+
+		_, release, err := connections.Get(context.TODO(), &dexapi.Options{HostAndPort: "grpc.dex.svc.cluster.local:5557"})
+		Expect(err).To(BeNil())
+		release()
+		Expect(retryPolicy).To(BeIdenticalTo(connections.RetryPolicy))
+	})
+	It("should open one connection for concurrent callers", func() {
+		blockedHost := "grpc.dex.svc.cluster.local:5557"
+		var mu sync.Mutex
+		dials := map[string]int{}
+		dialing := make(chan struct{})
+		connections := dexapi.NewConnectionManager(func(ctx context.Context, opts *dexapi.Options) (dexapi.DexAPI, error) {
+			mu.Lock()
+			dials[opts.HostAndPort]++
+			mu.Unlock()
+			if opts.HostAndPort == blockedHost {
+				<-dialing
+			}
+			return &dexapi.APIClient{Dex: new(MockDexAPIClient)}, nil
+		})
+		defer connections.Close()
+
+		clients := make(chan dexapi.DexAPI, 2)
+		for i := 0; i < 2; i++ {
+			go func() {
+				defer GinkgoRecover()
+				dexApiClient, release, err := connections.Get(context.TODO(), &dexapi.Options{HostAndPort: blockedHost})
+				Expect(err).To(BeNil())
+				release()
+				clients <- dexApiClient
+			}()
+		}
+		By("serving another dex server while the first one is being dialed", func() {
+			_, release, err := connections.Get(context.TODO(), &dexapi.Options{HostAndPort: "grpc.other.svc.cluster.local:5557"})
+			Expect(err).To(BeNil())
+			release()
+		})
+		close(dialing)
+		first, second := <-clients, <-clients
+		Expect(second).To(BeIdenticalTo(first))
+		mu.Lock()
+		defer mu.Unlock()
+		Expect(dials[blockedHost]).To(Equal(1))
+	})
+})
+
+var _ = Describe("Wait for a manual recreate through a fake dex server", func() {
+	DexClientName := "dex-client-manual"
+	DexClientNamespace := "dex-client-manual-ns"
+	DexClientID := "dex-client-manual-id"
+	var fake *fakeDexServer
+	var stop func()
+	var r *DexClientReconciler
+
+	BeforeEach(func() {
+		var newClient func(opts *dexapi.Options) (*dexapi.APIClient, error)
+		fake, newClient, stop = startFakeDexServer()
+		r = newTestDexClientReconciler(func(ctx context.Context, opts *dexapi.Options) (dexapi.DexAPI, error) {
+			dexApiClient, err := newClient(opts)
+			if err != nil {
+				return nil, err
+			}
+			return dexApiClient, nil
+		})
+	})
+
+	AfterEach(func() {
+		stop()
+	})
+
+	// The manager reconciles the DexClient too, so a reconcile is retried until the Applied condition has the
+	// expected reason
+	reconcileUntil := func(reason string) *authv1alpha1.DexClient {
+		dexClient := &authv1alpha1.DexClient{}
+		Eventually(func() string {
+			req := ctrl.Request{}
+			req.Name = DexClientName
+			req.Namespace = DexClientNamespace
+			if _, err := r.Reconcile(context.TODO(), req); err != nil {
+				return err.Error()
+			}
+			Expect(k8sClient.Get(context.TODO(), client.ObjectKey{Name: DexClientName, Namespace: DexClientNamespace}, dexClient)).To(Succeed())
+			cond := meta.FindStatusCondition(dexClient.Status.Conditions, authv1alpha1.DexClientConditionTypeApplied)
+			if cond == nil {
+				return ""
+			}
+			return cond.Reason
+		}, 30, 1).Should(Equal(reason))
+		return dexClient
+	}
+
+	It("should keep the DexClient not applied until the oauth2client is recreated", func() {
+		By("creating the DexClient with the Manual recreate policy", func() {
+			Expect(k8sClient.Create(context.TODO(), &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{Name: DexClientNamespace},
+			})).To(Succeed())
+			Expect(k8sClient.Create(context.TODO(), &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: SECRET_MTLS_NAME, Namespace: DexClientNamespace},
+				Data: map[string][]byte{
+					"ca.crt":     []byte("ca.crt"),
+					"client.crt": []byte("client.crt"),
+					"client.key": []byte("client.key"),
+				},
+			})).To(Succeed())
+			Expect(k8sClient.Create(context.TODO(), &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: DexClientName + "-secret", Namespace: DexClientNamespace},
+				StringData: map[string]string{"clientSecret": "manual-secret"},
+			})).To(Succeed())
+			Expect(k8sClient.Create(context.TODO(), &authv1alpha1.DexClient{
+				ObjectMeta: metav1.ObjectMeta{Name: DexClientName, Namespace: DexClientNamespace},
+				Spec: authv1alpha1.DexClientSpec{
+					ClientID: DexClientID,
+					ClientSecretRef: corev1.SecretReference{
+						Name:      DexClientName + "-secret",
+						Namespace: DexClientNamespace,
+					},
+					RedirectURIs:   []string{"https://manual.example.com/callback"},
+					RecreatePolicy: authv1alpha1.RecreatePolicyManual,
+				},
+			})).To(Succeed())
+			reconcileUntil("Created")
+			Expect(fake.getClient(DexClientID).Public).To(BeFalse())
+		})
+		By("changing the public flag along with a field updated in place", func() {
+			dexClient := &authv1alpha1.DexClient{}
+			Expect(k8sClient.Get(context.TODO(), client.ObjectKey{Name: DexClientName, Namespace: DexClientNamespace}, dexClient)).To(Succeed())
+			dexClient.Spec.Public = true
+			dexClient.Spec.RedirectURIs = []string{"https://manual.example.com/login"}
+			Expect(k8sClient.Update(context.TODO(), dexClient)).To(Succeed())
+
+			dexClient = reconcileUntil("RecreateRequired")
+			applied := meta.FindStatusCondition(dexClient.Status.Conditions, authv1alpha1.DexClientConditionTypeApplied)
+			Expect(applied.Status).To(Equal(metav1.ConditionFalse))
+			Expect(applied.Message).To(ContainSubstring("public"))
+			Expect(meta.IsStatusConditionTrue(dexClient.Status.Conditions, authv1alpha1.DexClientConditionTypeRecreateRequired)).To(BeTrue())
+			Expect(isDexClientSpecApplied(dexClient)).To(BeFalse())
+			Expect(dexClient.Status.ObservedGeneration).ToNot(Equal(dexClient.Generation))
+			Expect(fake.getClient(DexClientID).RedirectUris).To(Equal([]string{"https://manual.example.com/login"}))
+			Expect(fake.getClient(DexClientID).Public).To(BeFalse())
+		})
+		By("staying not applied on the next reconciles", func() {
+			dexClient := reconcileUntil("RecreateRequired")
+			Expect(isDexClientSpecApplied(dexClient)).To(BeFalse())
+		})
+	})
+})
+
+var _ = Describe("Enforce the allowed connectors through a fake dex server", func() {
+	DexServerName := "dex-server-allowed-connectors"
+	Namespace := "dex-client-allowed-connectors-ns"
+	DexClientName := "dex-client-ldap-only"
+	DexClientID := "dex-client-ldap-only-id"
+	var fake *fakeDexServer
+	var stop func()
+	var r *DexClientReconciler
+
+	BeforeEach(func() {
+		var newClient func(opts *dexapi.Options) (*dexapi.APIClient, error)
+		fake, newClient, stop = startFakeDexServer()
+		r = newTestDexClientReconciler(func(ctx context.Context, opts *dexapi.Options) (dexapi.DexAPI, error) {
+			dexApiClient, err := newClient(opts)
+			if err != nil {
+				return nil, err
+			}
+			return dexApiClient, nil
+		})
+	})
+
+	AfterEach(func() {
+		stop()
+	})
+
+	// The manager reconciles the DexClient too, so a reconcile is retried until the Applied condition has the
+	// expected reason
+	reconcileUntil := func(reason string) *authv1alpha1.DexClient {
+		dexClient := &authv1alpha1.DexClient{}
+		Eventually(func() string {
+			req := ctrl.Request{}
+			req.Name = DexClientName
+			req.Namespace = Namespace
+			if _, err := r.Reconcile(context.TODO(), req); err != nil {
+				return err.Error()
+			}
+			Expect(k8sClient.Get(context.TODO(), client.ObjectKey{Name: DexClientName, Namespace: Namespace}, dexClient)).To(Succeed())
+			cond := meta.FindStatusCondition(dexClient.Status.Conditions, authv1alpha1.DexClientConditionTypeApplied)
+			if cond == nil {
+				return ""
+			}
+			return cond.Reason
+		}, 30, 1).Should(Equal(reason))
+		return dexClient
+	}
+
+	setConnectors := func(ids ...string) {
+		dexServer := &authv1alpha1.DexServer{}
+		Expect(k8sClient.Get(context.TODO(), client.ObjectKey{Name: DexServerName, Namespace: Namespace}, dexServer)).To(Succeed())
+		dexServer.Spec.Connectors = []authv1alpha1.ConnectorSpec{}
+		for _, id := range ids {
+			dexServer.Spec.Connectors = append(dexServer.Spec.Connectors, authv1alpha1.ConnectorSpec{
+				Name: id,
+				Id:   id,
+				Type: authv1alpha1.ConnectorTypeGitHub,
+				GitHub: authv1alpha1.GitHubConfigSpec{
+					ClientID:        id + "-client-id",
+					ClientSecretRef: corev1.SecretReference{Name: id + "-secret", Namespace: Namespace},
+				},
+			})
+		}
+		Expect(k8sClient.Update(context.TODO(), dexServer)).To(Succeed())
+	}
+
+	It("should only apply the client while the DexServer defines no other connector", func() {
+		By("creating a DexServer with the allowed connector only", func() {
+			createDexServer(&authv1alpha1.DexServer{
+				ObjectMeta: metav1.ObjectMeta{Name: DexServerName, Namespace: Namespace},
+				Spec:       authv1alpha1.DexServerSpec{Issuer: "https://dex-allowed-connectors.example.com"},
+			}, &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: DexClientName + "-secret"},
+				StringData: map[string]string{"clientSecret": "ldap-only-secret"},
+			})
+			setConnectors("corp")
+		})
+		// The manager issues the mTLS secret of the DexServer, the fake dex server does not check it
+		By("applying the DexClient", func() {
+			Expect(k8sClient.Create(context.TODO(), &authv1alpha1.DexClient{
+				ObjectMeta: metav1.ObjectMeta{Name: DexClientName, Namespace: Namespace},
+				Spec: authv1alpha1.DexClientSpec{
+					ClientID: DexClientID,
+					ClientSecretRef: corev1.SecretReference{
+						Name:      DexClientName + "-secret",
+						Namespace: Namespace,
+					},
+					RedirectURIs:      []string{"https://ldap-only.example.com/callback"},
+					AllowedConnectors: []string{"corp"},
+				},
+			})).To(Succeed())
+			dexClient := reconcileUntil("Created")
+			Expect(meta.IsStatusConditionTrue(dexClient.Status.Conditions, authv1alpha1.DexClientConditionTypeConnectorsRestricted)).To(BeTrue())
+			Expect(fake.getClient(DexClientID)).ToNot(BeNil())
+		})
+		By("deleting the oauth2client when the DexServer gains another connector", func() {
+			setConnectors("corp", "github")
+			dexClient := reconcileUntil("ConnectorsNotRestricted")
+			cond := meta.FindStatusCondition(dexClient.Status.Conditions, authv1alpha1.DexClientConditionTypeConnectorsRestricted)
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+			Expect(cond.Message).To(ContainSubstring("github"))
+			Expect(isOAuth2ClientCreated(dexClient.Status.Conditions)).To(BeFalse())
+			Expect(fake.getClient(DexClientID)).To(BeNil())
+		})
+		By("creating the oauth2client again once the DexServer is fixed", func() {
+			setConnectors("corp")
+			reconcileUntil("Created")
+			Expect(fake.getClient(DexClientID)).ToNot(BeNil())
+		})
+		By("rejecting connectors the DexServer does not define", func() {
+			dexClient := &authv1alpha1.DexClient{}
+			Expect(k8sClient.Get(context.TODO(), client.ObjectKey{Name: DexClientName, Namespace: Namespace}, dexClient)).To(Succeed())
+			dexClient.Spec.AllowedConnectors = []string{"corp", "gitlab"}
+			Expect(k8sClient.Update(context.TODO(), dexClient)).To(Succeed())
+			reconcileUntil("UnknownConnectors")
 		})
 	})
 })
@@ -0,0 +1,157 @@
+// Copyright Red Hat
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+	dexapi "github.com/identitatem/dex-operator/controllers/dex"
+)
+
+var invalidNameChars = regexp.MustCompile("[^a-z0-9.-]+")
+
+// ImportDexAPIOptions returns the options to call the gRPC API of the dex server in namespace with the client
+// certificate of its mTLS secret. address replaces the address of the gRPC service when set, to reach dex from
+// outside the cluster through a port-forward.
+func ImportDexAPIOptions(ctx context.Context, c client.Reader, namespace string, address string) (*dexapi.Options, error) {
+	mTLSSecret := &corev1.Secret{}
+	if err := c.Get(ctx, client.ObjectKey{Name: SECRET_MTLS_NAME, Namespace: namespace}, mTLSSecret); err != nil {
+		return nil, errors.Wrapf(err, "failed to get the grpc mtls secret in namespace %s", namespace)
+	}
+	opts := newDexAPIOptions(namespace, mTLSSecret)
+	if address != "" {
+		opts.HostAndPort = address
+		// The certificate of dex is issued for its gRPC service
+		opts.ServerName = getServiceName(namespace)
+	}
+	return opts, nil
+}
+
+// ImportOAuth2Clients creates a DexClient, along with a secret holding its client secret, for every oauth2client
+// dexAPI lists that is not managed by a DexClient in namespace yet. The DexClients are created in the dex server
+// namespace and adopt the existing oauth2clients. ListClients leaves the client secrets out, so each one is read with
+// GetClient. Oauth2clients which cannot be imported are skipped and reported in the returned error, so the import can
+// be run again. Returns the DexClients which were created, or would be created when dryRun is set.
+func ImportOAuth2Clients(ctx context.Context, c client.Client, dexAPI dexapi.DexAPI, namespace string, dryRun bool) ([]authv1alpha1.DexClient, error) {
+	log := ctrllog.FromContext(ctx)
+
+	clients, err := dexAPI.ListClients(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list oauth2clients")
+	}
+
+	dexClientList := &authv1alpha1.DexClientList{}
+	if err := c.List(ctx, dexClientList, client.InNamespace(namespace)); err != nil {
+		return nil, errors.Wrapf(err, "failed to list DexClients in namespace %s", namespace)
+	}
+	managedClientIDs := map[string]bool{}
+	for _, dexClient := range dexClientList.Items {
+		managedClientIDs[dexClient.Spec.ClientID] = true
+	}
+
+	imported := []authv1alpha1.DexClient{}
+	errs := []error{}
+	for _, clientInfo := range clients {
+		if managedClientIDs[clientInfo.Id] {
+			log.V(1).Info("oauth2client is already managed", "ClientID", clientInfo.Id)
+			continue
+		}
+		storedClient, err := dexAPI.GetClient(ctx, clientInfo.Id)
+		if err != nil {
+			errs = append(errs, errors.Wrapf(err, "failed to import oauth2client %q", clientInfo.Id))
+			continue
+		}
+		name := dexClientNameForID(storedClient.Id)
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name + "-client-secret",
+				Namespace: namespace,
+				Labels: map[string]string{
+					DEX_CLIENT_SECRET_LABEL: "",
+				},
+			},
+			Type: corev1.SecretTypeOpaque,
+			StringData: map[string]string{
+				"clientSecret": storedClient.Secret,
+			},
+		}
+		dexClient := authv1alpha1.DexClient{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+			},
+			Spec: authv1alpha1.DexClientSpec{
+				ClientID: storedClient.Id,
+				ClientSecretRef: corev1.SecretReference{
+					Name:      secret.Name,
+					Namespace: secret.Namespace,
+				},
+				Public:         storedClient.Public,
+				RedirectURIs:   storedClient.RedirectUris,
+				TrustedPeers:   storedClient.TrustedPeers,
+				LogoURL:        storedClient.LogoUrl,
+				AdoptionPolicy: authv1alpha1.AdoptionPolicyAdopt,
+			},
+		}
+		if !dryRun {
+			log.Info("Importing oauth2client", "ClientID", storedClient.Id, "DexClient.name", name)
+			if err := importOAuth2Client(ctx, c, secret, &dexClient); err != nil {
+				// Carry on with the other oauth2clients, the import can be run again once the conflict is resolved
+				errs = append(errs, errors.Wrapf(err, "failed to import oauth2client %q", storedClient.Id))
+				continue
+			}
+		}
+		imported = append(imported, dexClient)
+	}
+	return imported, utilerrors.NewAggregate(errs)
+}
+
+// Create the client secret and the DexClient of an imported oauth2client. A client secret left by an earlier import
+// is reused when it holds the same secret, and the client secret is deleted again when the DexClient cannot be
+// created, so that running the import again picks up where it stopped.
+func importOAuth2Client(ctx context.Context, c client.Client, secret *corev1.Secret, dexClient *authv1alpha1.DexClient) error {
+	created := true
+	if err := c.Create(ctx, secret); kubeerrors.IsAlreadyExists(err) {
+		existing := &corev1.Secret{}
+		if err := c.Get(ctx, client.ObjectKeyFromObject(secret), existing); err != nil {
+			return errors.Wrapf(err, "failed to get client secret %s", secret.Name)
+		}
+		if string(existing.Data["clientSecret"]) != secret.StringData["clientSecret"] {
+			return fmt.Errorf("secret %s/%s already exists with a different client secret", secret.Namespace, secret.Name)
+		}
+		created = false
+	} else if err != nil {
+		return errors.Wrapf(err, "failed to create client secret %s", secret.Name)
+	}
+	if err := c.Create(ctx, dexClient); err != nil {
+		if created {
+			if err := c.Delete(ctx, secret); err != nil && !kubeerrors.IsNotFound(err) {
+				ctrllog.FromContext(ctx).Error(err, "failed to delete client secret", "secret", secret.Name)
+			}
+		}
+		return errors.Wrapf(err, "failed to create DexClient %s", dexClient.Name)
+	}
+	return nil
+}
+
+// Derive a valid resource name from a client ID, falling back to the name dex uses in its own storage
+func dexClientNameForID(id string) string {
+	name := strings.Trim(invalidNameChars.ReplaceAllString(strings.ToLower(id), "-"), "-.")
+	if len(validation.IsDNS1123Subdomain(name)) != 0 {
+		return dexapi.StorageObjectName(id)
+	}
+	return name
+}
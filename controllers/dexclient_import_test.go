@@ -0,0 +1,80 @@
+// Copyright Red Hat
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+	dexapi "github.com/identitatem/dex-operator/controllers/dex"
+)
+
+var _ = Describe("Import the oauth2clients of a fake dex server", func() {
+	Namespace := "dexclient-import-ns"
+	var dexAPI dexapi.DexAPI
+	var stop func()
+
+	BeforeEach(func() {
+		var newClient func(opts *dexapi.Options) (*dexapi.APIClient, error)
+		_, newClient, stop = startFakeDexAPIServer()
+		dexApiClient, err := newClient(nil)
+		Expect(err).To(BeNil())
+		dexAPI = dexApiClient
+	})
+
+	AfterEach(func() {
+		Expect(dexAPI.CloseConnection()).To(Succeed())
+		stop()
+	})
+
+	It("should create a DexClient and its secret for the clients not managed yet", func() {
+		Expect(k8sClient.Create(context.TODO(), &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{Name: Namespace},
+		})).To(Succeed())
+		Expect(k8sClient.Create(context.TODO(), &authv1alpha1.DexClient{
+			ObjectMeta: metav1.ObjectMeta{Name: "managed", Namespace: Namespace},
+			Spec: authv1alpha1.DexClientSpec{
+				ClientID:        "managed-id",
+				ClientSecretRef: corev1.SecretReference{Name: "managed-secret", Namespace: Namespace},
+			},
+		})).To(Succeed())
+		_, err := dexAPI.CreateClient(context.TODO(), []string{"https://managed.example.com/callback"}, nil, false, "managed", "managed-id", "", "managed-secret")
+		Expect(err).To(BeNil())
+		_, err = dexAPI.CreateClient(context.TODO(), []string{"https://legacy.example.com/callback"}, []string{"managed-id"}, true, "legacy", "Legacy_App", "", "legacy-secret")
+		Expect(err).To(BeNil())
+
+		By("listing the DexClients on a dry run", func() {
+			imported, err := ImportOAuth2Clients(context.TODO(), k8sClient, dexAPI, Namespace, true)
+			Expect(err).To(BeNil())
+			Expect(imported).To(HaveLen(1))
+			Expect(imported[0].Name).To(Equal("legacy-app"))
+			dexClient := &authv1alpha1.DexClient{}
+			Expect(k8sClient.Get(context.TODO(), client.ObjectKey{Name: "legacy-app", Namespace: Namespace}, dexClient)).ToNot(Succeed())
+		})
+		By("importing the client with the secret dex holds", func() {
+			_, err := ImportOAuth2Clients(context.TODO(), k8sClient, dexAPI, Namespace, false)
+			Expect(err).To(BeNil())
+			dexClient := &authv1alpha1.DexClient{}
+			Expect(k8sClient.Get(context.TODO(), client.ObjectKey{Name: "legacy-app", Namespace: Namespace}, dexClient)).To(Succeed())
+			Expect(dexClient.Spec.ClientID).To(Equal("Legacy_App"))
+			Expect(dexClient.Spec.Public).To(BeTrue())
+			Expect(dexClient.Spec.RedirectURIs).To(Equal([]string{"https://legacy.example.com/callback"}))
+			Expect(dexClient.Spec.TrustedPeers).To(Equal([]string{"managed-id"}))
+			Expect(dexClient.Spec.AdoptionPolicy).To(Equal(authv1alpha1.AdoptionPolicyAdopt))
+			secret := &corev1.Secret{}
+			Expect(k8sClient.Get(context.TODO(), client.ObjectKey{Name: dexClient.Spec.ClientSecretRef.Name, Namespace: Namespace}, secret)).To(Succeed())
+			Expect(string(secret.Data["clientSecret"])).To(Equal("legacy-secret"))
+		})
+		By("skipping the clients imported before", func() {
+			imported, err := ImportOAuth2Clients(context.TODO(), k8sClient, dexAPI, Namespace, false)
+			Expect(err).To(BeNil())
+			Expect(imported).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,144 @@
+// Copyright Red Hat
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"text/template"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+)
+
+// ManagedClusterGVK is the kind the redirect URI templates are expanded for
+var ManagedClusterGVK = schema.GroupVersionKind{Group: "cluster.open-cluster-management.io", Version: "v1", Kind: "ManagedCluster"}
+
+// The values a redirect URI template is executed with. The rest of the ManagedCluster is left out, the expanded
+// redirect URIs are readable by the users of the DexClient.
+type redirectURITemplateData struct {
+	Name          string
+	Labels        map[string]string
+	Annotations   map[string]string
+	ClusterClaims map[string]string
+}
+
+// Expand the redirect URI templates of a DexClient for every selected ManagedCluster. The result is sorted and free of
+// duplicates. ManagedClusters for which a template fails to execute, for example because a label is missing, are
+// skipped.
+func (r *DexClientReconciler) expandRedirectURITemplates(dexv1Client *authv1alpha1.DexClient, ctx context.Context) ([]string, error) {
+	log := ctrllog.FromContext(ctx)
+
+	if len(dexv1Client.Spec.RedirectURITemplates) == 0 {
+		return nil, nil
+	}
+
+	templates := []*template.Template{}
+	for i, text := range dexv1Client.Spec.RedirectURITemplates {
+		tmpl, err := template.New(fmt.Sprintf("redirectURITemplates[%d]", i)).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid redirect URI template %q", text)
+		}
+		templates = append(templates, tmpl)
+	}
+
+	listOptions := []client.ListOption{}
+	if source := dexv1Client.Spec.RedirectURISource; source != nil && source.Selector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(source.Selector)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid redirect URI source selector")
+		}
+		listOptions = append(listOptions, client.MatchingLabelsSelector{Selector: selector})
+	}
+	objects := &unstructured.UnstructuredList{}
+	objects.SetGroupVersionKind(ManagedClusterGVK.GroupVersion().WithKind(ManagedClusterGVK.Kind + "List"))
+	if err := r.List(ctx, objects, listOptions...); err != nil {
+		return nil, errors.Wrapf(err, "failed to list %s for the redirect URI templates", ManagedClusterGVK.Kind)
+	}
+
+	redirectURIs := sets.NewString()
+	for i := range objects.Items {
+		data := newRedirectURITemplateData(&objects.Items[i])
+		for _, tmpl := range templates {
+			redirectURI, err := executeRedirectURITemplate(tmpl, data)
+			if err != nil {
+				log.Info("Skipping redirect URI template", "template", tmpl.Name(), "object", objects.Items[i].GetName(), "error", err.Error())
+				continue
+			}
+			redirectURIs.Insert(redirectURI)
+		}
+	}
+	return redirectURIs.List(), nil
+}
+
+func newRedirectURITemplateData(u *unstructured.Unstructured) *redirectURITemplateData {
+	data := &redirectURITemplateData{
+		Name:          u.GetName(),
+		Labels:        u.GetLabels(),
+		Annotations:   u.GetAnnotations(),
+		ClusterClaims: map[string]string{},
+	}
+	// ManagedClusters report their claims as a list of name/value pairs
+	claims, _, _ := unstructured.NestedSlice(u.Object, "status", "clusterClaims")
+	for _, claim := range claims {
+		if c, ok := claim.(map[string]interface{}); ok {
+			name, _ := c["name"].(string)
+			value, _ := c["value"].(string)
+			data.ClusterClaims[name] = value
+		}
+	}
+	return data
+}
+
+func executeRedirectURITemplate(tmpl *template.Template, data *redirectURITemplateData) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	redirectURI := buf.String()
+	if u, err := url.Parse(redirectURI); err != nil || !u.IsAbs() {
+		return "", fmt.Errorf("%q is not an absolute URI", redirectURI)
+	}
+	return redirectURI, nil
+}
+
+// Expand the redirect URI templates and record the result in the status. When the generated redirect URIs change the
+// Applied condition is reset, so that the change is applied with UpdateClient rather than reported as drift.
+func (r *DexClientReconciler) syncGeneratedRedirectURIs(dexv1Client *authv1alpha1.DexClient, ctx context.Context) error {
+	generated, err := r.expandRedirectURITemplates(dexv1Client, ctx)
+	if err != nil {
+		return err
+	}
+	if sets.NewString(generated...).Equal(sets.NewString(dexv1Client.Status.GeneratedRedirectURIs...)) {
+		return nil
+	}
+	dexv1Client.Status.GeneratedRedirectURIs = generated
+	cond := metav1.Condition{
+		Type:    authv1alpha1.DexClientConditionTypeApplied,
+		Status:  metav1.ConditionFalse,
+		Reason:  "RedirectURIsChanged",
+		Message: fmt.Sprintf("%d redirect URIs generated from templates", len(generated)),
+	}
+	return r.updateDexClientStatusConditions(dexv1Client, ctx, cond)
+}
+
+// The redirect URIs of a DexClient, including the ones generated from templates
+func getRedirectURIs(dexv1Client *authv1alpha1.DexClient) []string {
+	redirectURIs := append([]string{}, dexv1Client.Spec.RedirectURIs...)
+	specURIs := sets.NewString(dexv1Client.Spec.RedirectURIs...)
+	for _, redirectURI := range dexv1Client.Status.GeneratedRedirectURIs {
+		if !specURIs.Has(redirectURI) {
+			redirectURIs = append(redirectURIs, redirectURI)
+		}
+	}
+	return redirectURIs
+}
@@ -0,0 +1,78 @@
+// Copyright Red Hat
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+	dexapi "github.com/identitatem/dex-operator/controllers/dex"
+)
+
+// Record in the status what was last synced with dex, once the current spec has been applied
+func (r *DexClientReconciler) updateDexClientSyncStatus(dexApiClient dexapi.DexAPI, dexv1Client *authv1alpha1.DexClient, ctx context.Context) error {
+	log := ctrllog.FromContext(ctx)
+
+	if !isDexClientSpecApplied(dexv1Client) {
+		return nil
+	}
+
+	status := &dexv1Client.Status
+	status.ObservedGeneration = dexv1Client.Generation
+	status.ClientID = dexv1Client.Spec.ClientID
+	status.SecretHash = dexv1Client.Annotations[DEX_CLIENT_SECRET_HASH_ANNOTATION]
+	now := metav1.Now()
+	status.LastSyncedTime = &now
+
+	if version, err := dexApiClient.GetServerInfo(ctx); err != nil {
+		log.V(1).Info("unable to get the dex server version", "error", err.Error())
+	} else {
+		status.DexVersion = version
+	}
+
+	// Each dex server runs in its own namespace, the DexClient is applied to the only DexServer there
+	dexServerList := &authv1alpha1.DexServerList{}
+	if err := r.List(ctx, dexServerList, client.InNamespace(dexv1Client.Namespace)); err != nil {
+		return err
+	}
+	if len(dexServerList.Items) > 1 {
+		return fmt.Errorf("namespace %s holds %d DexServers, the DexServer of DexClient %s is ambiguous",
+			dexv1Client.Namespace, len(dexServerList.Items), dexv1Client.Name)
+	}
+	status.IssuerURL = ""
+	status.DexServerRef = nil
+	if len(dexServerList.Items) == 1 {
+		dexServer := dexServerList.Items[0]
+		status.IssuerURL = dexServer.Spec.Issuer
+		status.DexServerRef = &authv1alpha1.RelatedObjectReference{
+			Kind:      "DexServer",
+			Name:      dexServer.Name,
+			Namespace: dexServer.Namespace,
+		}
+	}
+
+	status.RelatedObjects = getDexClientRelatedObjects(dexv1Client)
+
+	return r.Client.Status().Update(ctx, dexv1Client)
+}
+
+// The objects a DexClient reads: its client secret and the mTLS secret of the dex server
+func getDexClientRelatedObjects(dexv1Client *authv1alpha1.DexClient) []authv1alpha1.RelatedObjectReference {
+	return []authv1alpha1.RelatedObjectReference{
+		{
+			Kind:      "Secret",
+			Name:      dexv1Client.Spec.ClientSecretRef.Name,
+			Namespace: dexv1Client.Spec.ClientSecretRef.Namespace,
+		},
+		{
+			Kind:      "Secret",
+			Name:      SECRET_MTLS_NAME,
+			Namespace: dexv1Client.Namespace,
+		},
+	}
+}
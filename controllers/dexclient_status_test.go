@@ -0,0 +1,142 @@
+// Copyright Red Hat
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+	dexapi "github.com/identitatem/dex-operator/controllers/dex"
+)
+
+var _ = Describe("Report the synced oauth2client in the DexClient status", func() {
+	DexServerName := "dex-server-status"
+	Namespace := "dex-client-status-ns"
+	DexClientName := "dex-client-status"
+	DexClientID := "dex-client-status-id"
+	var fake *fakeDexServer
+	var dexAPI dexapi.DexAPI
+	var stop func()
+	var r *DexClientReconciler
+	// the DexClient once it is applied
+	dexClient := &authv1alpha1.DexClient{}
+
+	BeforeEach(func() {
+		var newClient func(opts *dexapi.Options) (*dexapi.APIClient, error)
+		fake, newClient, stop = startFakeDexServer()
+		dexApiClient, err := newClient(nil)
+		Expect(err).To(BeNil())
+		dexAPI = dexApiClient
+		r = newTestDexClientReconciler(func(ctx context.Context, opts *dexapi.Options) (dexapi.DexAPI, error) {
+			return newClient(opts)
+		})
+	})
+
+	AfterEach(func() {
+		Expect(dexAPI.CloseConnection()).To(Succeed())
+		stop()
+	})
+
+	It("should apply the DexClient", func() {
+		createDexServer(&authv1alpha1.DexServer{
+			ObjectMeta: metav1.ObjectMeta{Name: DexServerName, Namespace: Namespace},
+			Spec:       authv1alpha1.DexServerSpec{Issuer: "https://dex-status.example.com"},
+		}, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: DexClientName + "-secret"},
+			StringData: map[string]string{"clientSecret": "status-secret"},
+		})
+		Expect(k8sClient.Create(context.TODO(), &authv1alpha1.DexClient{
+			ObjectMeta: metav1.ObjectMeta{Name: DexClientName, Namespace: Namespace},
+			Spec: authv1alpha1.DexClientSpec{
+				ClientID: DexClientID,
+				ClientSecretRef: corev1.SecretReference{
+					Name:      DexClientName + "-secret",
+					Namespace: Namespace,
+				},
+				RedirectURIs: []string{"https://status.example.com/callback"},
+			},
+		})).To(Succeed())
+		// The manager issues the mTLS secret of the DexServer and reconciles the DexClient too, so a reconcile is
+		// retried until the status is filled in
+		Eventually(func() string {
+			req := ctrl.Request{}
+			req.Name = DexClientName
+			req.Namespace = Namespace
+			if _, err := r.Reconcile(context.TODO(), req); err != nil {
+				return err.Error()
+			}
+			Expect(k8sClient.Get(context.TODO(), client.ObjectKey{Name: DexClientName, Namespace: Namespace}, dexClient)).To(Succeed())
+			return dexClient.Status.ClientID
+		}, 30, 1).Should(Equal(DexClientID))
+		Expect(fake.getClient(DexClientID)).ToNot(BeNil())
+	})
+	It("should report the generation it applied", func() {
+		Expect(dexClient.Status.ObservedGeneration).To(Equal(dexClient.Generation))
+	})
+	It("should report the client ID", func() {
+		Expect(dexClient.Status.ClientID).To(Equal(DexClientID))
+	})
+	It("should report the issuer of the DexServer", func() {
+		Expect(dexClient.Status.IssuerURL).To(Equal("https://dex-status.example.com"))
+	})
+	It("should reference the DexServer", func() {
+		Expect(dexClient.Status.DexServerRef).To(Equal(&authv1alpha1.RelatedObjectReference{
+			Kind:      "DexServer",
+			Name:      DexServerName,
+			Namespace: Namespace,
+		}))
+	})
+	It("should report the dex version", func() {
+		Expect(dexClient.Status.DexVersion).To(Equal("v2.30.0"))
+	})
+	It("should report when it was last synced", func() {
+		Expect(dexClient.Status.LastSyncedTime).ToNot(BeNil())
+		Expect(dexClient.Status.LastSyncedTime.Time).To(BeTemporally("~", time.Now(), time.Minute))
+	})
+	It("should report the hash of the client secret it applied", func() {
+		Expect(dexClient.Status.SecretHash).ToNot(BeEmpty())
+		Expect(dexClient.Status.SecretHash).To(Equal(dexClient.Annotations[DEX_CLIENT_SECRET_HASH_ANNOTATION]))
+	})
+	It("should list the secrets it reads as related objects", func() {
+		Expect(dexClient.Status.RelatedObjects).To(Equal([]authv1alpha1.RelatedObjectReference{
+			{Kind: "Secret", Name: DexClientName + "-secret", Namespace: Namespace},
+			{Kind: "Secret", Name: SECRET_MTLS_NAME, Namespace: Namespace},
+		}))
+	})
+	It("should show readiness, issuer and age in the printer columns", func() {
+		crd, err := rDexServer.APIExtensionClient.ApiextensionsV1().CustomResourceDefinitions().Get(context.TODO(),
+			"dexclients.auth.identitatem.io", metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		Expect(crd.Spec.Versions[0].AdditionalPrinterColumns).To(Equal([]apiextensionsv1.CustomResourceColumnDefinition{
+			{Name: "Ready", Type: "string", JSONPath: `.status.conditions[?(@.type=="Applied")].status`},
+			{Name: "Issuer", Type: "string", JSONPath: ".status.issuerURL"},
+			{Name: "Age", Type: "date", JSONPath: ".metadata.creationTimestamp"},
+		}))
+	})
+	It("should report an error when the DexServer is ambiguous", func() {
+		Expect(k8sClient.Create(context.TODO(), &authv1alpha1.DexServer{
+			ObjectMeta: metav1.ObjectMeta{Name: DexServerName + "-other", Namespace: Namespace},
+			Spec:       authv1alpha1.DexServerSpec{Issuer: "https://dex-status-other.example.com"},
+		})).To(Succeed())
+		applied := dexClient.DeepCopy()
+		meta.SetStatusCondition(&applied.Status.Conditions, metav1.Condition{
+			Type:               authv1alpha1.DexClientConditionTypeApplied,
+			Status:             metav1.ConditionTrue,
+			Reason:             "Updated",
+			ObservedGeneration: applied.Generation,
+		})
+		err := r.updateDexClientSyncStatus(dexAPI, applied, context.TODO())
+		Expect(err).ToNot(BeNil())
+		Expect(err.Error()).To(ContainSubstring("2 DexServers"))
+	})
+})
@@ -0,0 +1,151 @@
+// Copyright Red Hat
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+)
+
+// The namespaced name a trusted peer reference points to
+func trustedPeerRefName(dexv1Client *authv1alpha1.DexClient, ref authv1alpha1.DexClientReference) types.NamespacedName {
+	namespace := ref.Namespace
+	if namespace == "" {
+		namespace = dexv1Client.Namespace
+	}
+	return types.NamespacedName{Name: ref.Name, Namespace: namespace}
+}
+
+// Resolve the trusted peer references of a DexClient to client IDs. Returns the resolved client IDs, sorted and free
+// of duplicates, and a description of every reference that could not be resolved.
+func (r *DexClientReconciler) resolveTrustedPeerRefs(dexv1Client *authv1alpha1.DexClient, ctx context.Context) ([]string, []string, error) {
+	resolved := sets.NewString()
+	unresolved := []string{}
+	for _, ref := range dexv1Client.Spec.TrustedPeerRefs {
+		name := trustedPeerRefName(dexv1Client, ref)
+		if name.Namespace != dexv1Client.Namespace {
+			// Each dex server runs in its own namespace, a client of another dex server cannot be a peer
+			unresolved = append(unresolved, fmt.Sprintf("%s (served by another dex server)", name))
+			continue
+		}
+		peer := &authv1alpha1.DexClient{}
+		if err := r.Get(ctx, name, peer); err != nil {
+			if kubeerrors.IsNotFound(err) {
+				unresolved = append(unresolved, fmt.Sprintf("%s (not found)", name))
+				continue
+			}
+			return nil, nil, err
+		}
+		if peer.Spec.ClientID == "" {
+			unresolved = append(unresolved, fmt.Sprintf("%s (no client ID)", name))
+			continue
+		}
+		resolved.Insert(peer.Spec.ClientID)
+	}
+	return resolved.List(), unresolved, nil
+}
+
+// Resolve the trusted peer references and record the client IDs in the status, along with the TrustedPeersResolved
+// condition. When the resolved client IDs change the Applied condition is reset, so that the change is applied with
+// UpdateClient rather than reported as drift.
+func (r *DexClientReconciler) syncResolvedTrustedPeers(dexv1Client *authv1alpha1.DexClient, ctx context.Context) error {
+	resolved, unresolved, err := r.resolveTrustedPeerRefs(dexv1Client, ctx)
+	if err != nil {
+		return err
+	}
+
+	conditions := []metav1.Condition{}
+	if len(unresolved) > 0 {
+		conditions = append(conditions, metav1.Condition{
+			Type:               authv1alpha1.DexClientConditionTypeTrustedPeersResolved,
+			Status:             metav1.ConditionFalse,
+			Reason:             "TrustedPeersNotResolved",
+			Message:            fmt.Sprintf("trusted peers not resolved: %s", strings.Join(unresolved, ", ")),
+			ObservedGeneration: dexv1Client.Generation,
+		})
+	} else if len(dexv1Client.Spec.TrustedPeerRefs) > 0 ||
+		meta.FindStatusCondition(dexv1Client.Status.Conditions, authv1alpha1.DexClientConditionTypeTrustedPeersResolved) != nil {
+		conditions = append(conditions, metav1.Condition{
+			Type:               authv1alpha1.DexClientConditionTypeTrustedPeersResolved,
+			Status:             metav1.ConditionTrue,
+			Reason:             "TrustedPeersResolved",
+			Message:            "all trusted peers are resolved",
+			ObservedGeneration: dexv1Client.Generation,
+		})
+	}
+	changed := !sets.NewString(resolved...).Equal(sets.NewString(dexv1Client.Status.ResolvedTrustedPeers...))
+	if changed {
+		dexv1Client.Status.ResolvedTrustedPeers = resolved
+		conditions = append(conditions, metav1.Condition{
+			Type:    authv1alpha1.DexClientConditionTypeApplied,
+			Status:  metav1.ConditionFalse,
+			Reason:  "TrustedPeersChanged",
+			Message: fmt.Sprintf("%d trusted peers resolved from references", len(resolved)),
+		})
+	} else if conditionsEqual(dexv1Client.Status.Conditions, mergeStatusConditions(dexv1Client.Status.Conditions, conditions...)) {
+		return nil
+	}
+	return r.updateDexClientStatusConditions(dexv1Client, ctx, conditions...)
+}
+
+// Conditions are equal when they have the same type, status, reason, message and observed generation
+func conditionsEqual(a []metav1.Condition, b []metav1.Condition) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, cond := range a {
+		other := meta.FindStatusCondition(b, cond.Type)
+		if other == nil || other.Status != cond.Status || other.Reason != cond.Reason || other.Message != cond.Message ||
+			other.ObservedGeneration != cond.ObservedGeneration {
+			return false
+		}
+	}
+	return true
+}
+
+// The trusted peers of a DexClient, including the ones resolved from references
+func getTrustedPeers(dexv1Client *authv1alpha1.DexClient) []string {
+	trustedPeers := append([]string{}, dexv1Client.Spec.TrustedPeers...)
+	specPeers := sets.NewString(dexv1Client.Spec.TrustedPeers...)
+	for _, peer := range dexv1Client.Status.ResolvedTrustedPeers {
+		if !specPeers.Has(peer) {
+			trustedPeers = append(trustedPeers, peer)
+		}
+	}
+	return trustedPeers
+}
+
+// Map a DexClient to the DexClients which reference it as a trusted peer
+func dexClientsReferencingPeer(c client.Client, peer client.Object) []reconcile.Request {
+	var dexClientList authv1alpha1.DexClientList
+	_ = c.List(context.TODO(), &dexClientList, client.InNamespace(peer.GetNamespace()))
+
+	var requests = []reconcile.Request{}
+
+	for i := range dexClientList.Items {
+		dexClient := &dexClientList.Items[i]
+		for _, ref := range dexClient.Spec.TrustedPeerRefs {
+			if trustedPeerRefName(dexClient, ref) == (types.NamespacedName{Name: peer.GetName(), Namespace: peer.GetNamespace()}) {
+				requests = append(requests, reconcile.Request{
+					NamespacedName: types.NamespacedName{
+						Name:      dexClient.Name,
+						Namespace: dexClient.Namespace,
+					},
+				})
+				break
+			}
+		}
+	}
+	return requests
+}
@@ -0,0 +1,120 @@
+// Copyright Red Hat
+
+package controllers
+
+import (
+	"context"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	routev1 "github.com/openshift/api/route/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+)
+
+var _ = Describe("Expose the dex web endpoint of a DexServer on additional hosts", func() {
+	DexServerName := "dex-server-hosts"
+	DexServerNamespace := "dex-server-hosts-ns"
+	DexServerIssuer := "https://sso.example.com"
+	AdditionalRouteName := "dex-server-hosts-d966ff22"
+
+	getDexServer := func() *authv1alpha1.DexServer {
+		dexServer := &authv1alpha1.DexServer{}
+		Expect(k8sClient.Get(context.TODO(), client.ObjectKey{Name: DexServerName, Namespace: DexServerNamespace}, dexServer)).To(Succeed())
+		return dexServer
+	}
+
+	It("should expose each additional host through a Route of its own", func() {
+		createDexServer(&authv1alpha1.DexServer{
+			ObjectMeta: metav1.ObjectMeta{Name: DexServerName, Namespace: DexServerNamespace},
+			Spec: authv1alpha1.DexServerSpec{
+				Issuer:   DexServerIssuer,
+				Exposure: authv1alpha1.ExposureTypeRoute,
+				AdditionalHosts: []authv1alpha1.AdditionalHostSpec{{
+					Host:           "login.bu.example.com",
+					CertificateRef: corev1.LocalObjectReference{Name: "login-bu-cert"},
+				}},
+			},
+		}, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "login-bu-cert", Namespace: DexServerNamespace},
+			Data: map[string][]byte{
+				"tls.crt": []byte("login certificate"),
+				"tls.key": []byte("login key"),
+			},
+		})
+		reconcileDexServer(DexServerName, DexServerNamespace)
+
+		route := &routev1.Route{}
+		Expect(k8sClient.Get(context.TODO(), client.ObjectKey{Name: DexServerName, Namespace: DexServerNamespace}, route)).To(Succeed())
+		Expect(route.Spec.Host).To(Equal("sso.example.com"))
+		Expect(route.Spec.TLS.Certificate).To(BeEmpty())
+
+		route = &routev1.Route{}
+		Expect(k8sClient.Get(context.TODO(), client.ObjectKey{Name: AdditionalRouteName, Namespace: DexServerNamespace}, route)).To(Succeed())
+		Expect(route.Spec.Host).To(Equal("login.bu.example.com"))
+		Expect(route.Spec.To.Name).To(Equal(DexServerName))
+		Expect(route.Spec.TLS.Certificate).To(Equal("login certificate"))
+		Expect(route.Spec.TLS.Key).To(Equal("login key"))
+
+		status := getDexServer().Status.Exposure
+		Expect(status.Issuer).To(Equal(DexServerIssuer))
+		Expect(status.AdditionalHosts).To(Equal([]string{"login.bu.example.com"}))
+		Expect(status.Message).To(ContainSubstring("issued under the canonical issuer " + DexServerIssuer))
+	})
+	It("should route the additional hosts in the Ingress", func() {
+		dexServer := getDexServer()
+		dexServer.Spec.Exposure = authv1alpha1.ExposureTypeIngress
+		dexServer.Spec.IngressCertificateRef = corev1.LocalObjectReference{Name: "sso-cert"}
+		dexServer.Spec.AdditionalHosts = append(dexServer.Spec.AdditionalHosts, authv1alpha1.AdditionalHostSpec{Host: "sso.other.example.com"})
+		Expect(k8sClient.Update(context.TODO(), dexServer)).To(Succeed())
+		reconcileDexServer(DexServerName, DexServerNamespace)
+
+		err := k8sClient.Get(context.TODO(), client.ObjectKey{Name: AdditionalRouteName, Namespace: DexServerNamespace}, &routev1.Route{})
+		Expect(kubeerrors.IsNotFound(err)).To(BeTrue())
+
+		ingress := &networkingv1.Ingress{}
+		Expect(k8sClient.Get(context.TODO(), client.ObjectKey{Name: DexServerName, Namespace: DexServerNamespace}, ingress)).To(Succeed())
+		Expect(ingress.Spec.Rules).To(HaveLen(3))
+		for i, host := range []string{"sso.example.com", "login.bu.example.com", "sso.other.example.com"} {
+			Expect(ingress.Spec.Rules[i].Host).To(Equal(host))
+		}
+		Expect(ingress.Spec.TLS).To(Equal([]networkingv1.IngressTLS{
+			{Hosts: []string{"sso.example.com", "sso.other.example.com"}, SecretName: "sso-cert"},
+			{Hosts: []string{"login.bu.example.com"}, SecretName: "login-bu-cert"},
+		}))
+	})
+	It("should name the Routes of hosts differing only by their dots and dashes apart", func() {
+		dexServer := getDexServer()
+		Expect(getAdditionalHostRouteName(dexServer, "login-bu.example.com")).ToNot(Equal(getAdditionalHostRouteName(dexServer, "login.bu-example.com")))
+		Expect(len(getAdditionalHostRouteName(dexServer, strings.Repeat("a", 63)+".example.com"))).To(Equal(len(DexServerName) + 9))
+	})
+	It("should merge the deprecated extra hosts of the Ingress into the additional hosts", func() {
+		dexServer := getDexServer()
+		dexServer.Spec.Ingress = &authv1alpha1.IngressSpec{ExtraHosts: []string{"login.bu.example.com", "login.example.com"}}
+		Expect(getAdditionalHosts(dexServer)).To(Equal([]authv1alpha1.AdditionalHostSpec{
+			{Host: "login.bu.example.com", CertificateRef: corev1.LocalObjectReference{Name: "login-bu-cert"}},
+			{Host: "sso.other.example.com"},
+			{Host: "login.example.com"},
+		}))
+	})
+	It("should stop routing the removed additional hosts", func() {
+		dexServer := getDexServer()
+		dexServer.Spec.AdditionalHosts = nil
+		Expect(k8sClient.Update(context.TODO(), dexServer)).To(Succeed())
+		reconcileDexServer(DexServerName, DexServerNamespace)
+
+		ingress := &networkingv1.Ingress{}
+		Expect(k8sClient.Get(context.TODO(), client.ObjectKey{Name: DexServerName, Namespace: DexServerNamespace}, ingress)).To(Succeed())
+		Expect(ingress.Spec.Rules).To(HaveLen(1))
+		Expect(ingress.Spec.TLS).To(HaveLen(1))
+		status := getDexServer().Status.Exposure
+		Expect(status.AdditionalHosts).To(BeEmpty())
+		Expect(status.Message).To(BeEmpty())
+	})
+})
@@ -0,0 +1,320 @@
+// Copyright Red Hat
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+)
+
+const (
+	SECRET_MTLS_SERVER_NAME  = "grpc-mtls-server"
+	SECRET_MTLS_CLIENT_NAME  = "grpc-mtls-client"
+	CERTIFICATE_SECRET_LABEL = "auth.identitatem.io/dexserver"
+)
+
+// cert-manager is not a dependency of the operator, its Certificates are handled as unstructured objects
+var certificateGVK = schema.GroupVersionKind{Group: "cert-manager.io", Version: "v1", Kind: "Certificate"}
+
+func isCertManagerIssued(dexServer *authv1alpha1.DexServer) bool {
+	return dexServer.Spec.CertificateIssuer != nil &&
+		dexServer.Spec.CertificateIssuer.Mode == authv1alpha1.CertificateIssuerModeCertManager
+}
+
+// The Certificates of a DexServer: the gRPC server and client certificates, and the certificate of the web endpoint
+func getCertificateNames(dexServer *authv1alpha1.DexServer) []string {
+	return []string{
+		dexServer.Name + "-grpc-server",
+		dexServer.Name + "-grpc-client",
+		dexServer.Name + "-web",
+	}
+}
+
+// The private key of a cert-manager Certificate, with the configured algorithm, encoded in PKCS#8 like the generated keys
+func getCertManagerPrivateKey(keyAlgorithm authv1alpha1.KeyAlgorithm) map[string]interface{} {
+	privateKey := map[string]interface{}{
+		"encoding":       "PKCS8",
+		"rotationPolicy": "Always",
+	}
+	switch keyAlgorithm {
+	case authv1alpha1.KeyAlgorithmRSA4096:
+		privateKey["algorithm"] = "RSA"
+		privateKey["size"] = int64(4096)
+	case authv1alpha1.KeyAlgorithmECDSAP256:
+		privateKey["algorithm"] = "ECDSA"
+		privateKey["size"] = int64(256)
+	case authv1alpha1.KeyAlgorithmECDSAP384:
+		privateKey["algorithm"] = "ECDSA"
+		privateKey["size"] = int64(384)
+	case authv1alpha1.KeyAlgorithmEd25519:
+		privateKey["algorithm"] = "Ed25519"
+	default:
+		privateKey["algorithm"] = "RSA"
+		privateKey["size"] = int64(PRIVATE_KEY_SIZE)
+	}
+	return privateKey
+}
+
+// Define a cert-manager Certificate. The secret it produces is labelled with the DexServer, so that its renewal
+// triggers a reconcile.
+func (r *DexServerReconciler) defineCertificate(dexServer *authv1alpha1.DexServer, name string, secretName string, dnsNames []string, usages []interface{}, config *mtlsConfig) (*unstructured.Unstructured, error) {
+	issuerRef := dexServer.Spec.CertificateIssuer.IssuerRef
+	if issuerRef == nil || issuerRef.Name == "" {
+		return nil, fmt.Errorf("certificateIssuer.issuerRef is required in CertManager mode")
+	}
+	issuer := map[string]interface{}{
+		"name": issuerRef.Name,
+		"kind": "Issuer",
+	}
+	if issuerRef.Kind != "" {
+		issuer["kind"] = issuerRef.Kind
+	}
+	if issuerRef.Group != "" {
+		issuer["group"] = issuerRef.Group
+	}
+	names := []interface{}{}
+	for _, dnsName := range dnsNames {
+		names = append(names, dnsName)
+	}
+	spec := map[string]interface{}{
+		"secretName": secretName,
+		"secretTemplate": map[string]interface{}{
+			"labels": map[string]interface{}{
+				CERTIFICATE_SECRET_LABEL: dexServer.Name,
+			},
+		},
+		"commonName": dnsNames[0],
+		"dnsNames":   names,
+		"usages":     usages,
+		"issuerRef":  issuer,
+	}
+	if config != nil {
+		spec["duration"] = config.certDuration.String()
+		spec["renewBefore"] = config.renewBefore.String()
+		spec["privateKey"] = getCertManagerPrivateKey(config.keyAlgorithm)
+	}
+
+	certificate := &unstructured.Unstructured{}
+	certificate.SetGroupVersionKind(certificateGVK)
+	certificate.SetName(name)
+	certificate.SetNamespace(dexServer.Namespace)
+	certificate.SetLabels(map[string]string{"app": dexServer.Name})
+	if err := unstructured.SetNestedField(certificate.Object, spec, "spec"); err != nil {
+		return nil, err
+	}
+	if err := ctrl.SetControllerReference(dexServer, certificate, r.Scheme); err != nil {
+		return nil, err
+	}
+	return certificate, nil
+}
+
+// Create or update the Certificates of a DexServer in CertManager mode
+func (r *DexServerReconciler) syncCertificates(dexServer *authv1alpha1.DexServer, config *mtlsConfig, ctx context.Context) error {
+	log := ctrllog.FromContext(ctx)
+	names := getCertificateNames(dexServer)
+
+	webDNSNames := getWebDNSNames(dexServer)
+
+	certificates := []struct {
+		name       string
+		secretName string
+		dnsNames   []string
+		usages     []interface{}
+		config     *mtlsConfig
+	}{
+		{names[0], SECRET_MTLS_SERVER_NAME, []string{getServiceName(dexServer.Namespace)}, []interface{}{"server auth", "client auth"}, config},
+		{names[1], SECRET_MTLS_CLIENT_NAME, []string{getServiceName(dexServer.Namespace)}, []interface{}{"client auth"}, config},
+		{names[2], dexServer.Name + SECRET_WEB_TLS_SUFFIX, webDNSNames, []interface{}{"server auth"}, nil},
+	}
+	for _, c := range certificates {
+		desired, err := r.defineCertificate(dexServer, c.name, c.secretName, c.dnsNames, c.usages, c.config)
+		if err != nil {
+			return err
+		}
+		current := &unstructured.Unstructured{}
+		current.SetGroupVersionKind(certificateGVK)
+		err = r.Client.Get(ctx, client.ObjectKey{Name: c.name, Namespace: dexServer.Namespace}, current)
+		switch {
+		case kubeerrors.IsNotFound(err):
+			log.Info("creating Certificate", "name", c.name)
+			if err := r.Client.Create(ctx, desired); err != nil {
+				return errors.Wrapf(err, "error creating Certificate %s", c.name)
+			}
+		case err != nil:
+			return errors.Wrapf(err, "error getting Certificate %s", c.name)
+		case !equality.Semantic.DeepEqual(current.Object["spec"], desired.Object["spec"]):
+			log.Info("updating Certificate", "name", c.name)
+			current.Object["spec"] = desired.Object["spec"]
+			if err := r.Client.Update(ctx, current); err != nil {
+				return errors.Wrapf(err, "error updating Certificate %s", c.name)
+			}
+		}
+	}
+	return nil
+}
+
+// Delete the Certificates left over by the CertManager mode, and the secrets they issued. The gRPC server secret tells
+// whether there are any, without looking Certificates up on clusters where cert-manager is not installed.
+func (r *DexServerReconciler) deleteCertificates(dexServer *authv1alpha1.DexServer, ctx context.Context) error {
+	log := ctrllog.FromContext(ctx)
+	if err := r.Client.Get(ctx, client.ObjectKey{Name: SECRET_MTLS_SERVER_NAME, Namespace: dexServer.Namespace}, &corev1.Secret{}); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	for _, name := range getCertificateNames(dexServer) {
+		certificate := &unstructured.Unstructured{}
+		certificate.SetGroupVersionKind(certificateGVK)
+		certificate.SetName(name)
+		certificate.SetNamespace(dexServer.Namespace)
+		if err := r.Client.Delete(ctx, certificate); err != nil && !kubeerrors.IsNotFound(err) && !meta.IsNoMatchError(err) {
+			return errors.Wrapf(err, "error deleting Certificate %s", name)
+		}
+	}
+	for _, name := range []string{SECRET_MTLS_SERVER_NAME, SECRET_MTLS_CLIENT_NAME, dexServer.Name + SECRET_WEB_TLS_SUFFIX} {
+		secret := &corev1.Secret{}
+		if err := r.Client.Get(ctx, client.ObjectKey{Name: name, Namespace: dexServer.Namespace}, secret); err != nil {
+			if kubeerrors.IsNotFound(err) {
+				continue
+			}
+			return err
+		}
+		if _, ok := secret.Labels[CERTIFICATE_SECRET_LABEL]; !ok {
+			continue
+		}
+		log.Info("deleting secret issued by cert-manager", "name", name)
+		if err := r.Client.Delete(ctx, secret); err != nil && !kubeerrors.IsNotFound(err) {
+			return errors.Wrapf(err, "error deleting secret %s", name)
+		}
+	}
+	return nil
+}
+
+// Get a secret issued by cert-manager, which has to hold its certificate and the CA of the issuer
+func (r *DexServerReconciler) getIssuedSecret(dexServer *authv1alpha1.DexServer, name string, ctx context.Context) (*corev1.Secret, time.Time, error) {
+	secret := &corev1.Secret{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Name: name, Namespace: dexServer.Namespace}, secret); err != nil {
+		if kubeerrors.IsNotFound(err) {
+			return nil, time.Time{}, fmt.Errorf("secret %s is not issued yet", name)
+		}
+		return nil, time.Time{}, err
+	}
+	if len(secret.Data["ca.crt"]) == 0 {
+		return nil, time.Time{}, fmt.Errorf("secret %s holds no ca.crt, the issuer has to provide its CA", name)
+	}
+	block, _ := pem.Decode(secret.Data["tls.crt"])
+	if block == nil {
+		return nil, time.Time{}, fmt.Errorf("secret %s holds no certificate", name)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, time.Time{}, errors.Wrapf(err, "error parsing the certificate of secret %s", name)
+	}
+	return secret, cert.NotAfter, nil
+}
+
+// In CertManager mode, the gRPC mTLS secret mounted by dex and read by the operator is assembled from the secrets
+// issued by cert-manager. Its expiry annotation is the one of the earliest certificate, so that dex is rolled out
+// whenever one is renewed.
+func (r *DexServerReconciler) manageCertManagerMTLSSecret(dexServer *authv1alpha1.DexServer, config *mtlsConfig, ctx context.Context) error {
+	log := ctrllog.FromContext(ctx)
+	if err := r.syncCertificates(dexServer, config, ctx); err != nil {
+		return err
+	}
+	serverSecret, serverExpiry, err := r.getIssuedSecret(dexServer, SECRET_MTLS_SERVER_NAME, ctx)
+	if err != nil {
+		return err
+	}
+	clientSecret, clientExpiry, err := r.getIssuedSecret(dexServer, SECRET_MTLS_CLIENT_NAME, ctx)
+	if err != nil {
+		return err
+	}
+	expiry := serverExpiry
+	if clientExpiry.Before(expiry) {
+		expiry = clientExpiry
+	}
+	caBundle := append([]byte{}, serverSecret.Data["ca.crt"]...)
+	if !equality.Semantic.DeepEqual(serverSecret.Data["ca.crt"], clientSecret.Data["ca.crt"]) {
+		caBundle = append(caBundle, clientSecret.Data["ca.crt"]...)
+	}
+
+	spec := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      SECRET_MTLS_NAME,
+			Namespace: dexServer.Namespace,
+			Labels: map[string]string{
+				"app": dexServer.Name,
+			},
+			Annotations: map[string]string{
+				MTLS_CERT_EXPIRY_ANNOTATION: expiry.UTC().Format(time.RFC3339),
+				MTLS_CA_ROTATION_ANNOTATION: string(authv1alpha1.MTLSRotationPhaseStable),
+			},
+		},
+		Data: map[string][]byte{
+			"ca.crt":     caBundle,
+			"tls.crt":    serverSecret.Data["tls.crt"],
+			"tls.key":    serverSecret.Data["tls.key"],
+			"client.crt": clientSecret.Data["tls.crt"],
+			"client.key": clientSecret.Data["tls.key"],
+		},
+	}
+	if err := ctrl.SetControllerReference(dexServer, spec, r.Scheme); err != nil {
+		return err
+	}
+
+	secret, err := r.getMTLSSecret(dexServer, ctx)
+	switch {
+	case kubeerrors.IsNotFound(err):
+		log.Info("Creating a new MTLS Secret from the issued certificates", "Secret.Namespace", spec.Namespace, "Secret.Name", spec.Name)
+		if err := r.Create(ctx, spec); err != nil {
+			return errors.Wrap(err, "error creating mtls secret")
+		}
+	case err != nil:
+		return errors.Wrap(err, "error getting mtls secret")
+	case !equality.Semantic.DeepEqual(secret.Data, spec.Data) || !equality.Semantic.DeepEqual(secret.Annotations, spec.Annotations):
+		log.Info("Updating MTLS Secret from the issued certificates", "Secret.Namespace", spec.Namespace, "Secret.Name", spec.Name)
+		if err := r.Update(ctx, spec); err != nil {
+			return errors.Wrap(err, "error updating mtls secret")
+		}
+	}
+
+	mtlsStatus := &authv1alpha1.MTLSStatus{
+		RotationPhase: authv1alpha1.MTLSRotationPhaseStable,
+		CertExpiry:    &metav1.Time{Time: expiry},
+	}
+	if block, _ := pem.Decode(serverSecret.Data["ca.crt"]); block != nil {
+		if ca, err := x509.ParseCertificate(block.Bytes); err == nil {
+			mtlsStatus.CAExpiry = &metav1.Time{Time: ca.NotAfter}
+		}
+	}
+	dexServer.Status.MTLS = mtlsStatus
+	return nil
+}
+
+// The hash of the web TLS secret issued by cert-manager or by the operator, dex is rolled out when it changes
+func (r *DexServerReconciler) getWebTLSHash(dexServer *authv1alpha1.DexServer, ctx context.Context) (string, error) {
+	if !isCertManagerIssued(dexServer) && !r.isWebTLSSelfSigned(dexServer) {
+		return "", nil
+	}
+	secret := &corev1.Secret{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Name: dexServer.Name + SECRET_WEB_TLS_SUFFIX, Namespace: dexServer.Namespace}, secret); err != nil {
+		return "", client.IgnoreNotFound(err)
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(append(append([]byte{}, secret.Data["tls.crt"]...), secret.Data["tls.key"]...))), nil
+}
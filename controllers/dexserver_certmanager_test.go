@@ -0,0 +1,158 @@
+// Copyright Red Hat
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+)
+
+var _ = Describe("Issue the DexServer certificates with cert-manager", func() {
+	DexServerName := "dex-server-cert-manager"
+	DexServerNamespace := "dex-server-cert-manager-ns"
+
+	getCertificate := func(name string) (*unstructured.Unstructured, error) {
+		certificate := &unstructured.Unstructured{}
+		certificate.SetGroupVersionKind(certificateGVK)
+		err := k8sClient.Get(context.TODO(), client.ObjectKey{Name: name, Namespace: DexServerNamespace}, certificate)
+		return certificate, err
+	}
+
+	// cert-manager does not run in the test environment, issue the secrets of the Certificates from a test CA
+	issueSecret := func(name string, ca *mtlsCA, config *mtlsConfig) {
+		certs, err := generateMTLSCerts(DexServerNamespace, ca, config)
+		Expect(err).To(BeNil())
+		Expect(k8sClient.Create(context.TODO(), &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: DexServerNamespace,
+				Labels:    map[string]string{CERTIFICATE_SECRET_LABEL: DexServerName},
+			},
+			Data: map[string][]byte{
+				"ca.crt":  ca.pem.Bytes(),
+				"tls.crt": certs.certPEM.Bytes(),
+				"tls.key": certs.certPrivKeyPEM.Bytes(),
+			},
+		})).To(Succeed())
+	}
+
+	It("should install the cert-manager Certificate CRD", func() {
+		preserveUnknownFields := true
+		Expect(k8sClient.Create(context.TODO(), &apiextensionsv1.CustomResourceDefinition{
+			ObjectMeta: metav1.ObjectMeta{Name: "certificates.cert-manager.io"},
+			Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+				Group: "cert-manager.io",
+				Names: apiextensionsv1.CustomResourceDefinitionNames{
+					Plural:   "certificates",
+					Singular: "certificate",
+					Kind:     "Certificate",
+					ListKind: "CertificateList",
+				},
+				Scope: apiextensionsv1.NamespaceScoped,
+				Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+					{
+						Name:    "v1",
+						Served:  true,
+						Storage: true,
+						Schema: &apiextensionsv1.CustomResourceValidation{
+							OpenAPIV3Schema: &apiextensionsv1.JSONSchemaProps{
+								Type:                   "object",
+								XPreserveUnknownFields: &preserveUnknownFields,
+							},
+						},
+					},
+				},
+			},
+		})).To(Succeed())
+		Eventually(func() error {
+			_, err := getCertificate("none")
+			if meta.IsNoMatchError(err) {
+				return err
+			}
+			return nil
+		}, 30, 1).Should(Succeed())
+	})
+	It("should request the certificates from the issuer", func() {
+		createDexServer(&authv1alpha1.DexServer{
+			ObjectMeta: metav1.ObjectMeta{Name: DexServerName, Namespace: DexServerNamespace},
+			Spec: authv1alpha1.DexServerSpec{
+				Issuer: "https://dex-server-cert-manager.example.com",
+				CertificateIssuer: &authv1alpha1.CertificateIssuerSpec{
+					Mode: authv1alpha1.CertificateIssuerModeCertManager,
+					IssuerRef: &authv1alpha1.CertManagerIssuerReference{
+						Name: "corporate-ca",
+						Kind: "ClusterIssuer",
+					},
+				},
+			},
+		})
+
+		Eventually(func() error {
+			// fails until the certificates are issued
+			_ = reconcileDexServerOnce(DexServerName, DexServerNamespace)
+			_, err := getCertificate(DexServerName + "-web")
+			return err
+		}, 30, 1).Should(Succeed())
+
+		certificate, err := getCertificate(DexServerName + "-grpc-server")
+		Expect(err).To(BeNil())
+		secretName, _, _ := unstructured.NestedString(certificate.Object, "spec", "secretName")
+		Expect(secretName).To(Equal(SECRET_MTLS_SERVER_NAME))
+		issuerKind, _, _ := unstructured.NestedString(certificate.Object, "spec", "issuerRef", "kind")
+		Expect(issuerKind).To(Equal("ClusterIssuer"))
+		certificate, err = getCertificate(DexServerName + "-web")
+		Expect(err).To(BeNil())
+		dnsNames, _, _ := unstructured.NestedStringSlice(certificate.Object, "spec", "dnsNames")
+		Expect(dnsNames).To(ContainElement("dex-server-cert-manager.example.com"))
+	})
+	It("should assemble the gRPC mTLS secret from the issued secrets", func() {
+		config, err := getMTLSConfig(&authv1alpha1.DexServer{})
+		Expect(err).To(BeNil())
+		ca, err := generateMTLSCA(getGRPCCACommonName(DexServerNamespace), config)
+		Expect(err).To(BeNil())
+		issueSecret(SECRET_MTLS_SERVER_NAME, ca, config)
+		issueSecret(SECRET_MTLS_CLIENT_NAME, ca, config)
+		issueSecret(DexServerName+SECRET_WEB_TLS_SUFFIX, ca, config)
+
+		reconcileDexServer(DexServerName, DexServerNamespace)
+
+		server := &corev1.Secret{}
+		Expect(k8sClient.Get(context.TODO(), client.ObjectKey{Name: SECRET_MTLS_SERVER_NAME, Namespace: DexServerNamespace}, server)).To(Succeed())
+		issuedClient := &corev1.Secret{}
+		Expect(k8sClient.Get(context.TODO(), client.ObjectKey{Name: SECRET_MTLS_CLIENT_NAME, Namespace: DexServerNamespace}, issuedClient)).To(Succeed())
+		mtls := &corev1.Secret{}
+		Expect(k8sClient.Get(context.TODO(), client.ObjectKey{Name: SECRET_MTLS_NAME, Namespace: DexServerNamespace}, mtls)).To(Succeed())
+		Expect(mtls.Data["ca.crt"]).To(Equal(ca.pem.Bytes()))
+		Expect(mtls.Data["tls.crt"]).To(Equal(server.Data["tls.crt"]))
+		Expect(mtls.Data["client.crt"]).To(Equal(issuedClient.Data["tls.crt"]))
+		Expect(mtls.Data).ToNot(HaveKey("ca.key"))
+
+		service := &corev1.Service{}
+		Expect(k8sClient.Get(context.TODO(), client.ObjectKey{Name: DexServerName, Namespace: DexServerNamespace}, service)).To(Succeed())
+		Expect(service.Annotations).ToNot(HaveKey("service.beta.openshift.io/serving-cert-secret-name"))
+	})
+	It("should delete the certificates when going back to self-signed certificates", func() {
+		dexServer := &authv1alpha1.DexServer{}
+		Expect(k8sClient.Get(context.TODO(), client.ObjectKey{Name: DexServerName, Namespace: DexServerNamespace}, dexServer)).To(Succeed())
+		dexServer.Spec.CertificateIssuer = nil
+		Expect(k8sClient.Update(context.TODO(), dexServer)).To(Succeed())
+
+		reconcileDexServer(DexServerName, DexServerNamespace)
+		_, err := getCertificate(DexServerName + "-grpc-server")
+		Expect(err).ToNot(BeNil())
+		Expect(k8sClient.Get(context.TODO(), client.ObjectKey{Name: SECRET_MTLS_SERVER_NAME, Namespace: DexServerNamespace}, &corev1.Secret{})).ToNot(Succeed())
+		mtls := &corev1.Secret{}
+		Expect(k8sClient.Get(context.TODO(), client.ObjectKey{Name: SECRET_MTLS_NAME, Namespace: DexServerNamespace}, mtls)).To(Succeed())
+		Expect(mtls.Data).To(HaveKey("ca.key"))
+	})
+})
@@ -0,0 +1,152 @@
+// Copyright Red Hat
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/util/sets"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+	dexapi "github.com/identitatem/dex-operator/controllers/dex"
+)
+
+// A connector of a DexServer in Live connector management is applied through the dex gRPC API, unless it needs files
+// mounted in the dex deployment, which only a rollout of the deployment can change. dex does not start without a
+// connector in its configuration file or storage, and the API only serves once dex runs, so the first connector stays
+// in the configuration file when no other connector does.
+func isLiveConnector(dexServer *authv1alpha1.DexServer, connector authv1alpha1.ConnectorSpec) bool {
+	if dexServer.Spec.ConnectorManagement != authv1alpha1.ConnectorManagementLive || !canBeLiveConnector(connector) {
+		return false
+	}
+	for _, c := range dexServer.Spec.Connectors {
+		if !canBeLiveConnector(c) {
+			return true
+		}
+	}
+	return connector.Id != dexServer.Spec.Connectors[0].Id
+}
+
+func canBeLiveConnector(connector authv1alpha1.ConnectorSpec) bool {
+	return connector.Type != authv1alpha1.ConnectorTypeLDAP || connector.LDAP.RootCARef.Name == ""
+}
+
+// Define the connector applied through the dex API. dex only expands environment variables in its configuration file,
+// so the credentials of the connector are read from its secret. Returns false for connector types that are not
+// supported.
+func (r *DexServerReconciler) defineLiveConnector(dexServer *authv1alpha1.DexServer, connector authv1alpha1.ConnectorSpec, ctx context.Context) (*dexapi.Connector, bool, error) {
+	dexConnector, ok, err := r.defineDexConnector(dexServer, connector, ctx)
+	if err != nil || !ok {
+		return nil, ok, err
+	}
+
+	secret, err := getConnectorSecretFromRef(connector, dexServer, r, ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	if connector.Type == authv1alpha1.ConnectorTypeLDAP {
+		dexConnector.Config.BindPW = secret
+	} else {
+		dexConnector.Config.ClientSecret = secret
+	}
+
+	// dex decodes the configuration of a connector created through its API as JSON. It is encoded the way syncConfigMap encodes the
+	// configuration file, so that the connector is configured the same way in both modes.
+	configYaml, err := yaml.Marshal(&dexConnector.Config)
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "failed to marshal the configuration of connector %q", connector.Id)
+	}
+	config, err := yaml.YAMLToJSON(configYaml)
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "failed to convert the configuration of connector %q", connector.Id)
+	}
+	return &dexapi.Connector{
+		Id:     dexConnector.Id,
+		Type:   dexConnector.Type,
+		Name:   dexConnector.Name,
+		Config: config,
+	}, true, nil
+}
+
+// Apply the live connectors of a DexServer through the dex API and delete the ones it no longer manages live. dex
+// picks up the changes on the next login, without a restart. dex serves the connector calls of its API only with
+// DEX_API_CONNECTORS_CRUD set, which syncDeployment sets in Live connector management.
+func (r *DexServerReconciler) syncLiveConnectors(dexServer *authv1alpha1.DexServer, ctx context.Context) error {
+	log := ctrllog.FromContext(ctx)
+
+	desired := []*dexapi.Connector{}
+	for _, connector := range dexServer.Spec.Connectors {
+		if !isLiveConnector(dexServer, connector) {
+			continue
+		}
+		liveConnector, ok, err := r.defineLiveConnector(dexServer, connector, ctx)
+		if err != nil {
+			return err
+		}
+		if ok {
+			desired = append(desired, liveConnector)
+		}
+	}
+	if len(desired) == 0 && len(dexServer.Status.LiveConnectors) == 0 {
+		return nil
+	}
+
+	mTLSSecret, err := r.getMTLSSecret(dexServer, ctx)
+	if err != nil {
+		return errors.Wrap(err, "error getting dex server grpc mtls secret")
+	}
+	dexApiClient, release, err := r.DexConnections.Get(ctx, newDexAPIOptions(dexServer.Namespace, mTLSSecret))
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	current, err := dexApiClient.ListConnectors(ctx)
+	if err != nil {
+		return err
+	}
+	currentByID := map[string]*dexapi.Connector{}
+	for _, connector := range current {
+		currentByID[connector.Id] = connector
+	}
+
+	liveConnectors := sets.NewString()
+	for _, connector := range desired {
+		liveConnectors.Insert(connector.Id)
+		existing, ok := currentByID[connector.Id]
+		if !ok {
+			log.Info("creating live connector", "id", connector.Id)
+			if err := dexApiClient.CreateConnector(ctx, connector); err != nil {
+				return err
+			}
+			continue
+		}
+		if existing.Type != connector.Type || existing.Name != connector.Name || !bytes.Equal(existing.Config, connector.Config) {
+			log.Info("updating live connector", "id", connector.Id)
+			if err := dexApiClient.UpdateConnector(ctx, connector); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, id := range dexServer.Status.LiveConnectors {
+		if liveConnectors.Has(id) {
+			continue
+		}
+		log.Info("deleting live connector", "id", id)
+		if err := dexApiClient.DeleteConnector(ctx, id); err != nil && !dexapi.IsNotFound(err) {
+			return err
+		}
+	}
+
+	if equality.Semantic.DeepEqual(dexServer.Status.LiveConnectors, liveConnectors.List()) {
+		return nil
+	}
+	dexServer.Status.LiveConnectors = liveConnectors.List()
+	return r.Client.Status().Update(ctx, dexServer)
+}
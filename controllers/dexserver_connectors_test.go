@@ -0,0 +1,179 @@
+// Copyright Red Hat
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/ghodss/yaml"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+	dexapi "github.com/identitatem/dex-operator/controllers/dex"
+)
+
+var _ = Describe("Manage DexServer connectors live", func() {
+	DexServerName := "dex-server-live"
+	DexServerNamespace := "dex-server-live-ns"
+	GitHubSecretName := "dex-server-live-github"
+	var fake *fakeDexAPIServer
+	var stop func()
+	var r *DexServerReconciler
+	// the configuration of the connector when it was live
+	var liveConfig map[string]interface{}
+
+	// The manager cannot reach dex in the test environment, the live connectors are applied by a reconciler of
+	// their own calling a fake dex server
+	BeforeEach(func() {
+		var newClient func(opts *dexapi.Options) (*dexapi.APIClient, error)
+		fake, newClient, stop = startFakeDexAPIServer()
+		reconciler := rDexServer
+		reconciler.DexConnections = dexapi.NewConnectionManager(func(ctx context.Context, opts *dexapi.Options) (dexapi.DexAPI, error) {
+			dexApiClient, err := newClient(opts)
+			if err != nil {
+				return nil, err
+			}
+			return dexApiClient, nil
+		})
+		r = &reconciler
+	})
+
+	AfterEach(func() {
+		stop()
+	})
+
+	reconcile := func() *authv1alpha1.DexServer {
+		Eventually(func() error {
+			req := ctrl.Request{}
+			req.Name = DexServerName
+			req.Namespace = DexServerNamespace
+			_, err := r.Reconcile(context.TODO(), req)
+			return err
+		}, 30, 1).Should(Succeed())
+		dexServer := &authv1alpha1.DexServer{}
+		Expect(k8sClient.Get(context.TODO(), client.ObjectKey{Name: DexServerName, Namespace: DexServerNamespace}, dexServer)).To(Succeed())
+		return dexServer
+	}
+
+	getConfig := func() string {
+		dexConfigMap := &corev1.ConfigMap{}
+		Expect(k8sClient.Get(context.TODO(), client.ObjectKey{Name: DexServerName, Namespace: DexServerNamespace}, dexConfigMap)).To(Succeed())
+		return dexConfigMap.Data["config.yaml"]
+	}
+
+	getEnv := func() []corev1.EnvVar {
+		deployment := &appsv1.Deployment{}
+		Expect(k8sClient.Get(context.TODO(), client.ObjectKey{Name: DexServerName, Namespace: DexServerNamespace}, deployment)).To(Succeed())
+		return deployment.Spec.Template.Spec.Containers[0].Env
+	}
+
+	It("should apply the connectors through the dex API", func() {
+		By("creating the DexServer", func() {
+			createDexServer(&authv1alpha1.DexServer{
+				ObjectMeta: metav1.ObjectMeta{Name: DexServerName, Namespace: DexServerNamespace},
+				Spec: authv1alpha1.DexServerSpec{
+					Issuer:              "https://dex-server-live.example.com",
+					ConnectorManagement: authv1alpha1.ConnectorManagementLive,
+					Connectors: []authv1alpha1.ConnectorSpec{
+						{
+							Name: "config-github",
+							Id:   "config-github",
+							Type: authv1alpha1.ConnectorTypeGitHub,
+							GitHub: authv1alpha1.GitHubConfigSpec{
+								ClientID: "config-client-id",
+								ClientSecretRef: corev1.SecretReference{
+									Name:      GitHubSecretName,
+									Namespace: DexServerNamespace,
+								},
+							},
+						},
+						{
+							Name: "live-github",
+							Id:   "live-github",
+							Type: authv1alpha1.ConnectorTypeGitHub,
+							GitHub: authv1alpha1.GitHubConfigSpec{
+								ClientID: "live-client-id",
+								ClientSecretRef: corev1.SecretReference{
+									Name:      GitHubSecretName,
+									Namespace: DexServerNamespace,
+								},
+							},
+						},
+					},
+				},
+			}, &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: GitHubSecretName, Namespace: DexServerNamespace},
+				StringData: map[string]string{"clientSecret": "live-secret"},
+			})
+		})
+		By("reconciling the DexServer", func() {
+			dexServer := reconcile()
+			Expect(dexServer.Status.LiveConnectors).To(Equal([]string{"live-github"}))
+			Expect(getEnv()).To(ContainElement(corev1.EnvVar{Name: "DEX_API_CONNECTORS_CRUD", Value: "true"}))
+
+			connector := fake.getConnector("live-github")
+			Expect(connector).ToNot(BeNil())
+			Expect(connector.Type).To(Equal("github"))
+			Expect(json.Unmarshal(connector.Config, &liveConfig)).To(Succeed())
+			Expect(liveConfig).To(HaveKeyWithValue("ClientID", "live-client-id"))
+			Expect(liveConfig).To(HaveKeyWithValue("ClientSecret", "live-secret"))
+		})
+		By("keeping the first connector in the dex configuration, dex does not start without one", func() {
+			Expect(getConfig()).To(ContainSubstring("config-github"))
+			Expect(getConfig()).ToNot(ContainSubstring("live-github"))
+			Expect(fake.getConnector("config-github")).To(BeNil())
+		})
+		By("updating the connector through the dex API", func() {
+			dexServer := &authv1alpha1.DexServer{}
+			Expect(k8sClient.Get(context.TODO(), client.ObjectKey{Name: DexServerName, Namespace: DexServerNamespace}, dexServer)).To(Succeed())
+			dexServer.Spec.Connectors[1].GitHub.ClientID = "live-client-id-2"
+			Expect(k8sClient.Update(context.TODO(), dexServer)).To(Succeed())
+
+			reconcile()
+			config := map[string]interface{}{}
+			Expect(json.Unmarshal(fake.getConnector("live-github").Config, &config)).To(Succeed())
+			Expect(config).To(HaveKeyWithValue("ClientID", "live-client-id-2"))
+		})
+	})
+	It("should move the connectors back to the dex configuration", func() {
+		// dex still holds the connector the previous test applied
+		fake.connectors["live-github"] = &dexapi.Connector{Id: "live-github", Type: "github", Name: "live-github"}
+
+		dexServer := &authv1alpha1.DexServer{}
+		Expect(k8sClient.Get(context.TODO(), client.ObjectKey{Name: DexServerName, Namespace: DexServerNamespace}, dexServer)).To(Succeed())
+		dexServer.Spec.ConnectorManagement = authv1alpha1.ConnectorManagementConfig
+		Expect(k8sClient.Update(context.TODO(), dexServer)).To(Succeed())
+
+		dexServer = reconcile()
+		Expect(dexServer.Status.LiveConnectors).To(BeEmpty())
+		Expect(fake.getConnector("live-github")).To(BeNil())
+		Expect(getEnv()).ToNot(ContainElement(corev1.EnvVar{Name: "DEX_API_CONNECTORS_CRUD", Value: "true"}))
+
+		By("configuring the connector with the same keys", func() {
+			config := struct {
+				Connectors []struct {
+					ID     string                 `json:"id"`
+					Config map[string]interface{} `json:"config"`
+				} `json:"connectors"`
+			}{}
+			Expect(yaml.Unmarshal([]byte(getConfig()), &config)).To(Succeed())
+			Expect(config.Connectors).To(HaveLen(2))
+			Expect(config.Connectors[1].ID).To(Equal("live-github"))
+			keys := []string{}
+			for key := range liveConfig {
+				keys = append(keys, key)
+			}
+			Expect(config.Connectors[1].Config).To(HaveLen(len(keys)))
+			for _, key := range keys {
+				Expect(config.Connectors[1].Config).To(HaveKey(key))
+			}
+		})
+	})
+})
@@ -5,15 +5,18 @@ package controllers
 import (
 	"context"
 	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"net/url"
 	"os"
+	"path"
 	"strings"
 	"time"
 
 	"github.com/ghodss/yaml"
+	routev1 "github.com/openshift/api/route/v1"
 	deployUtil "github.com/openshift/cluster-resource-override-admission-operator/pkg/deploy"
 	"github.com/pkg/errors"
 	appsv1 "k8s.io/api/apps/v1"
@@ -25,7 +28,9 @@ import (
 	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
@@ -43,6 +48,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+	dexapi "github.com/identitatem/dex-operator/controllers/dex"
 	deploy "github.com/identitatem/dex-operator/deploy"
 )
 
@@ -53,6 +59,7 @@ const (
 	GRPC_SERVICE_NAME           = "grpc"
 	DEX_IMAGE_ENV_NAME          = "RELATED_IMAGE_DEX"
 	MTLS_CERT_EXPIRY_ANNOTATION = "auth.identitatem.io/expiry"
+	MTLS_CA_ROTATION_ANNOTATION = "auth.identitatem.io/ca-rotation-phase"
 	IDP_CREDENTIAL_LABEL        = "auth.identitatem.io/idp-credential"
 	DEXSERVER_FINALIZER         = "auth.identitatem.io/cleanup"
 )
@@ -88,6 +95,12 @@ type DexServerReconciler struct {
 	DynamicClient      dynamic.Interface
 	APIExtensionClient apiextensionsclient.Interface
 	Scheme             *runtime.Scheme
+	// DexConnections are the connections to the dex servers, used to manage live connectors
+	DexConnections *dexapi.ConnectionManager
+	// Platform decides who issues the serving certificate of the dex web endpoint, detected when left empty
+	Platform Platform
+	// GatewayAPI tells whether the cluster serves the Gateway API, detected on setup
+	GatewayAPI bool
 }
 
 //+kubebuilder:rbac:groups=auth.identitatem.io,resources=dexservers,verbs=get;list;watch;create;update;patch;delete
@@ -101,11 +114,14 @@ type DexServerReconciler struct {
 //+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;patch;delete
 //+kubebuilder:rbac:groups=route.openshift.io,resources=routes,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=route.openshift.io,resources=routes/custom-host,verbs=create;patch
+//+kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=httproutes;backendtlspolicies,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups="rbac.authorization.k8s.io",resources={clusterroles},verbs=get;list;watch;create;update;patch;delete;escalate;bind
 //+kubebuilder:rbac:groups="rbac.authorization.k8s.io",resources={clusterrolebindings},verbs=get;list;create;watch;update;patch;delete
 //+kubebuilder:rbac:groups="apiextensions.k8s.io",resources={customresourcedefinitions},verbs=get;list;create;update;patch;delete
 //+kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=dex.coreos.com,resources=connectors,verbs=get;list;create;update;delete
+//+kubebuilder:rbac:groups=cert-manager.io,resources=certificates,verbs=get;list;watch;create;update;delete
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -170,6 +186,21 @@ func (r *DexServerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		return ctrl.Result{}, err
 	}
 
+	if err := r.manageWebTLSSecret(dexServer, ctx); err != nil {
+		log.Error(err, "failed to manage web tls secret")
+		cond := metav1.Condition{
+			Type:   authv1alpha1.DexServerConditionTypeApplied,
+			Status: metav1.ConditionFalse,
+			Reason: "ConfigWebTLSSecretFailed",
+			Message: fmt.Sprintf("failed to configure web TLS secret. error: %s",
+				err.Error()),
+		}
+		if err := updateDexServerStatusConditions(r.Client, dexServer, cond); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, err
+	}
+
 	if err := r.syncConfigMap(dexServer, ctx); err != nil {
 		log.Error(err, "failed to sync ConfigMap")
 		cond := metav1.Condition{
@@ -261,13 +292,28 @@ func (r *DexServerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		return ctrl.Result{}, err
 	}
 
-	if err := r.syncIngress(dexServer, ctx); err != nil {
-		log.Error(err, "failed to sync Ingress")
+	if err := r.syncExposure(dexServer, ctx); err != nil {
+		log.Error(err, "failed to sync exposure")
 		cond := metav1.Condition{
 			Type:   authv1alpha1.DexServerConditionTypeApplied,
 			Status: metav1.ConditionFalse,
-			Reason: "ConfigIngressFailed",
-			Message: fmt.Sprintf("failed to sync Ingress. error: %s",
+			Reason: "ConfigExposureFailed",
+			Message: fmt.Sprintf("failed to sync exposure. error: %s",
+				err.Error()),
+		}
+		if err := updateDexServerStatusConditions(r.Client, dexServer, cond); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, err
+	}
+
+	if err := r.syncLiveConnectors(dexServer, ctx); err != nil {
+		log.Error(err, "failed to sync live connectors")
+		cond := metav1.Condition{
+			Type:   authv1alpha1.DexServerConditionTypeApplied,
+			Status: metav1.ConditionFalse,
+			Reason: "ConfigLiveConnectorsFailed",
+			Message: fmt.Sprintf("failed to sync live connectors. error: %s",
 				err.Error()),
 		}
 		if err := updateDexServerStatusConditions(r.Client, dexServer, cond); err != nil {
@@ -295,6 +341,16 @@ func (r *DexServerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		return ctrl.Result{}, err
 	}
 
+	// Follow the rollouts of a gRPC or web CA rotation
+	if dexServer.Status.MTLS != nil && dexServer.Status.MTLS.RotationPhase != authv1alpha1.MTLSRotationPhaseStable {
+		return ctrl.Result{Requeue: true, RequeueAfter: mtlsRotationRequeuePeriod}, nil
+	}
+	if rotating, err := r.isWebCARotating(dexServer, ctx); err != nil {
+		return ctrl.Result{}, err
+	} else if rotating {
+		return ctrl.Result{Requeue: true, RequeueAfter: mtlsRotationRequeuePeriod}, nil
+	}
+
 	// Reconcile hourly to ensure grpc mtls certs are regenerated before expiry
 	return ctrl.Result{Requeue: true, RequeueAfter: 1 * time.Hour}, nil
 }
@@ -425,6 +481,7 @@ func getConnectorSecretFromRef(connector authv1alpha1.ConnectorSpec, m *authv1al
 }
 
 // Define the secret for grpc Mutual TLS. This secret is volume mounted on the dex instance pod. The client cert should be loaded by the gRPC client code.
+// The certificates are written with their chain, the leaf then the CA signing it.
 func (r *DexServerReconciler) defineMTLSSecret(m *authv1alpha1.DexServer, mtlsCerts *MTLSCerts) *corev1.Secret {
 	labels := map[string]string{
 		"app": m.Name,
@@ -442,9 +499,9 @@ func (r *DexServerReconciler) defineMTLSSecret(m *authv1alpha1.DexServer, mtlsCe
 		Data: map[string][]byte{
 			"ca.crt":     mtlsCerts.caPEM.Bytes(),
 			"ca.key":     mtlsCerts.caPrivKeyPEM.Bytes(),
-			"tls.crt":    append(mtlsCerts.certPEM.Bytes(), mtlsCerts.certPEM.Bytes()...),
+			"tls.crt":    append(append([]byte{}, mtlsCerts.certPEM.Bytes()...), mtlsCerts.caPEM.Bytes()...),
 			"tls.key":    mtlsCerts.certPrivKeyPEM.Bytes(),
-			"client.crt": append(mtlsCerts.clientPEM.Bytes(), mtlsCerts.clientPEM.Bytes()...),
+			"client.crt": append(append([]byte{}, mtlsCerts.clientPEM.Bytes()...), mtlsCerts.caPEM.Bytes()...),
 			"client.key": mtlsCerts.clientPrivKeyPEM.Bytes(),
 		},
 	}
@@ -460,11 +517,102 @@ func (r *DexServerReconciler) getMTLSSecret(m *authv1alpha1.DexServer, ctx conte
 	return resource, nil
 }
 
+// Get the CA referenced by spec.mtls.caSecretRef, nil when the CA is generated by the operator. The secret is read in
+// the namespace of the DexServer only, and left as is: the DexServer is reconciled when it changes through the watch
+// of the secrets referenced as CAs.
+func (r *DexServerReconciler) getProvidedMTLSCA(dexServer *authv1alpha1.DexServer, ctx context.Context) (*mtlsCA, error) {
+	if dexServer.Spec.MTLS == nil || dexServer.Spec.MTLS.CASecretRef == nil {
+		return nil, nil
+	}
+	name := dexServer.Spec.MTLS.CASecretRef.Name
+	namespace := dexServer.Namespace
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, secret); err != nil {
+		return nil, errors.Wrapf(err, "error getting mtls ca secret %s/%s", namespace, name)
+	}
+	ca, err := parseMTLSCA(secret.Data["tls.crt"], secret.Data["tls.key"])
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing mtls ca secret %s/%s", namespace, name)
+	}
+	if err := validateProvidedMTLSCA(ca.cert); err != nil {
+		return nil, errors.Wrapf(err, "invalid mtls ca secret %s/%s", namespace, name)
+	}
+	return ca, nil
+}
+
+// The MTLSCAExpiring condition warns ahead of the expiry of a provided CA, which the operator can not renew
+func getMTLSCAExpiringCondition(ca *mtlsCA) metav1.Condition {
+	expiry := ca.cert.NotAfter.UTC().Format(time.RFC3339)
+	if inCertRenewalWindow(ca.cert.NotAfter, providedCAExpiryWarning) {
+		return metav1.Condition{
+			Type:    authv1alpha1.DexServerConditionTypeMTLSCAExpiring,
+			Status:  metav1.ConditionTrue,
+			Reason:  "CAExpiring",
+			Message: fmt.Sprintf("the provided mtls CA expires on %s, replace it in the secret referenced by spec.mtls.caSecretRef", expiry),
+		}
+	}
+	return metav1.Condition{
+		Type:    authv1alpha1.DexServerConditionTypeMTLSCAExpiring,
+		Status:  metav1.ConditionFalse,
+		Reason:  "CAValid",
+		Message: fmt.Sprintf("the provided mtls CA expires on %s", expiry),
+	}
+}
+
+// Renew the gRPC server and client certificates when they near expiry. The CA is kept as long as it outlives them, so
+// that dex and the DexClient reconciler keep trusting each other across renewals. When the CA itself has to be renewed,
+// the new CA is first trusted next to the previous one, then signs the certificates, and the previous CA is dropped
+// last, each step waiting for dex to be rolled out with the previous one.
+// The certificates of the gRPC clients no longer declared in the DexServer are revoked in the CRL appended to the
+// trust bundle. dex does not read CRLs, so the CA is rotated as well and the revoked certificates are no longer
+// trusted once the previous CA is dropped. A provided CA can not be rotated by the operator, the GRPCClientsRevoked
+// condition reports the certificates dex accepts until it is replaced.
+// A CA provided through spec.mtls.caSecretRef replaces the generated one through the same stages. Its key is read from
+// the referenced secret, it is not copied to the secret mounted by dex.
 func (r *DexServerReconciler) manageMTLSSecret(dexServer *authv1alpha1.DexServer, ctx context.Context) error {
 	log := ctrllog.FromContext(ctx)
 	log.V(1).Info("manageMTLSSecret")
+	config, err := getMTLSConfig(dexServer)
+	if err != nil {
+		return err
+	}
+	if isCertManagerIssued(dexServer) {
+		return r.manageCertManagerMTLSSecret(dexServer, config, ctx)
+	}
+	if err := r.deleteCertificates(dexServer, ctx); err != nil {
+		return err
+	}
+	provided, err := r.getProvidedMTLSCA(dexServer, ctx)
+	if err != nil {
+		return err
+	}
+	if provided != nil {
+		meta.SetStatusCondition(&dexServer.Status.Conditions, getMTLSCAExpiringCondition(provided))
+	} else {
+		meta.RemoveStatusCondition(&dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeMTLSCAExpiring)
+	}
+	isProvided := func(ca *mtlsCA) bool {
+		return provided != nil && ca.cert.Equal(provided.cert)
+	}
 	secretExists := false
 	regenerate := false
+	phase := authv1alpha1.MTLSRotationPhaseStable
+	var ca, nextCA *mtlsCA
+	var caBundle []byte
+	var revoked []pkix.RevokedCertificate
+	var previousCRLs []byte
+	revokedSecrets, err := r.getRevokedGRPCClientSecrets(dexServer, ctx)
+	if err != nil {
+		return err
+	}
+	deletedSecrets, trustedSecrets := splitRevokedGRPCClientSecrets(provided, revokedSecrets)
+	if len(trustedSecrets) > 0 {
+		cond := getGRPCClientsRevokedCondition(trustedSecrets)
+		log.Error(errors.New(cond.Message), "removed grpc clients are still trusted")
+		meta.SetStatusCondition(&dexServer.Status.Conditions, cond)
+	} else {
+		meta.RemoveStatusCondition(&dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeGRPCClientsRevoked)
+	}
 	secret, err := r.getMTLSSecret(dexServer, ctx)
 	if err != nil {
 		if !kubeerrors.IsNotFound(err) {
@@ -472,6 +620,44 @@ func (r *DexServerReconciler) manageMTLSSecret(dexServer *authv1alpha1.DexServer
 		}
 	} else {
 		secretExists = true
+		caBundle = getCertificatesPEM(secret.Data["ca.crt"])
+		previousCRLs = secret.Data["ca.crl"]
+		if len(secret.Data["ca.key"]) > 0 {
+			ca, err = parseMTLSCA(caBundle, secret.Data["ca.key"])
+		} else if ca, err = getIssuerMTLSCA(caBundle, secret.Data["tls.crt"]); err == nil && isProvided(ca) {
+			ca = provided
+		}
+		if err != nil {
+			log.Error(err, "mtls ca could not be parsed")
+			ca = nil
+		} else if ca.cert.NotAfter.Before(time.Now()) {
+			log.Info("mtls ca has expired, the certificates it signed are no longer trusted")
+			ca = nil
+		} else {
+			revoked = revokeGRPCClientCerts(ca, ca.parseCRL(secret.Data["ca.crl"]), revokedSecrets)
+		}
+		if p := authv1alpha1.MTLSRotationPhase(secret.Annotations[MTLS_CA_ROTATION_ANNOTATION]); p != "" {
+			phase = p
+		}
+		if phase == authv1alpha1.MTLSRotationPhaseTrustingNewCA {
+			if len(secret.Data["next-ca.key"]) > 0 {
+				nextCA, err = parseMTLSCA(caBundle, secret.Data["next-ca.key"])
+			} else if provided != nil {
+				nextCA, err = parseMTLSCA(caBundle, provided.privKeyPEM.Bytes())
+			} else {
+				err = fmt.Errorf("next-ca.key is missing")
+			}
+			if err != nil {
+				log.Error(err, "next mtls ca could not be parsed")
+				nextCA = nil
+				phase = authv1alpha1.MTLSRotationPhaseStable
+			}
+		}
+		// certificates written without their chain by earlier versions, or no longer trusted, are reissued
+		if err := verifyMTLSCerts(dexServer.Namespace, secret.Data, caBundle); err != nil {
+			log.Info("mtls certs do not verify, regenerate", "reason", err.Error())
+			regenerate = true
+		}
 		// check if cert is expiring soon...
 		expiry := secret.Annotations[MTLS_CERT_EXPIRY_ANNOTATION]
 		if expiry == "" {
@@ -484,37 +670,192 @@ func (r *DexServerReconciler) manageMTLSSecret(dexServer *authv1alpha1.DexServer
 				log.Error(err, "cert expiry could not be parsed")
 				regenerate = true
 			}
-			if inCertRenewalWindow(expiryTime) {
+			if inCertRenewalWindow(expiryTime, config.renewBefore) {
 				log.V(1).Info("mtls cert is nearing expiration... regenerate")
 				regenerate = true
 			}
 
 		}
 	}
-	if !secretExists || regenerate {
-		mTLSCerts, err := generateMTLSCerts(dexServer.Namespace)
+
+	// a new CA is needed once the CA nears expiry or has another key algorithm, or to switch to or from a provided CA
+	needsNewCA := func(ca *mtlsCA) bool {
+		if provided != nil {
+			return !isProvided(ca)
+		}
+		return !ca.isValidFor(config)
+	}
+	newCA := func() (*mtlsCA, error) {
+		if provided != nil {
+			return provided, nil
+		}
+		return generateMTLSCA(getGRPCCACommonName(dexServer.Namespace), config)
+	}
+	signingCA := ca
+	switch {
+	case ca == nil:
+		// nothing is trusted yet, or no longer, there is no rollout to wait for
+		if ca, err = newCA(); err != nil {
+			return errors.Wrap(err, "error generating mtls ca")
+		}
+		caBundle = ca.pem.Bytes()
+		nextCA = nil
+		phase = authv1alpha1.MTLSRotationPhaseStable
+		regenerate = true
+	case phase == authv1alpha1.MTLSRotationPhaseStable && (needsNewCA(ca) || (provided == nil && len(revoked) > 0)),
+		phase == authv1alpha1.MTLSRotationPhaseTrustingNewCA && needsNewCA(nextCA):
+		log.Info("mtls ca is nearing expiration, has another key algorithm or revoked certificates, or is replaced, trusting a new ca")
+		if nextCA, err = newCA(); err != nil {
+			return errors.Wrap(err, "error generating mtls ca")
+		}
+		caBundle = append(append([]byte{}, ca.pem.Bytes()...), nextCA.pem.Bytes()...)
+		phase = authv1alpha1.MTLSRotationPhaseTrustingNewCA
+	case phase != authv1alpha1.MTLSRotationPhaseStable:
+		rolledOut, err := r.isMTLSSecretRolledOut(dexServer, secret, ctx)
 		if err != nil {
-			return errors.Wrap(err, "error generating mtls certs")
+			return err
 		}
-		spec := r.defineMTLSSecret(dexServer, mTLSCerts)
-		if !secretExists {
-			log.Info("Creating a new MTLS Secret", "Secret.Namespace", spec.Namespace, "Secret.Name", spec.Name)
-			if err := r.Create(ctx, spec); err != nil {
-				return errors.Wrap(err, "error creating mtls secret")
-			}
+		if !rolledOut {
+			log.V(1).Info("waiting for the dex deployment to roll out the mtls secret", "phase", phase)
+		} else if phase == authv1alpha1.MTLSRotationPhaseTrustingNewCA {
+			log.Info("new mtls ca is trusted by dex, signing the certificates with it")
+			ca, nextCA = nextCA, nil
+			phase = authv1alpha1.MTLSRotationPhaseReissuingCerts
+			regenerate = true
 		} else {
-			log.Info("Updating MTLS Secret", "Secret.Namespace", spec.Namespace, "Secret.Name", spec.Name)
-			if err := r.Update(ctx, spec); err != nil {
-				return errors.Wrap(err, "error updating mtls secret")
-			}
+			log.Info("certificates signed by the new mtls ca are loaded by dex, dropping the previous ca")
+			caBundle = ca.pem.Bytes()
+			phase = authv1alpha1.MTLSRotationPhaseStable
 		}
+	}
 
+	// the key of a previous provided CA is no longer known, the next or provided CA signs the certificates right away
+	signer := ca
+	for _, c := range []*mtlsCA{nextCA, provided} {
+		if signer.privKey == nil && c != nil {
+			signer = c
+		}
+	}
+	var spec *corev1.Secret
+	if regenerate {
+		if signer.privKey == nil {
+			return fmt.Errorf("the key of mtls ca %q is not available to renew the certificates", ca.cert.Subject.CommonName)
+		}
+		mTLSCerts, err := generateMTLSCerts(dexServer.Namespace, signer, config)
+		if err != nil {
+			return errors.Wrap(err, "error generating mtls certs")
+		}
+		spec = r.defineMTLSSecret(dexServer, mTLSCerts)
+	} else {
+		spec = secret.DeepCopy()
+	}
+	spec.Data["ca.crt"] = caBundle
+	if ca.privKey != nil && !isProvided(ca) {
+		spec.Data["ca.key"] = ca.privKeyPEM.Bytes()
+	} else {
+		delete(spec.Data, "ca.key")
+	}
+	if nextCA != nil && !isProvided(nextCA) {
+		spec.Data["next-ca.key"] = nextCA.privKeyPEM.Bytes()
+	} else {
+		delete(spec.Data, "next-ca.key")
+	}
+	spec.Annotations[MTLS_CA_ROTATION_ANNOTATION] = string(phase)
+	// The CRL of the CA signing the certificates is signed again with the certificates revoked since. The CRL of the
+	// previous CA of a rotation is kept as is while that CA is trusted, its key is no longer known once the new CA signs
+	// the certificates.
+	var crlsPEM []byte
+	if ca != signingCA {
+		revoked = nil
+	}
+	if len(revoked) > 0 && ca.privKey != nil && ca.cert.KeyUsage&x509.KeyUsageCRLSign != 0 {
+		crl, err := ca.createCRL(revoked)
+		if err != nil {
+			return errors.Wrap(err, "error signing mtls crl")
+		}
+		crlsPEM = append(getBundleCRLsPEM(previousCRLs, caBundle, ca.cert), crl...)
+	} else {
+		crlsPEM = getBundleCRLsPEM(previousCRLs, caBundle, nil)
+	}
+	if len(crlsPEM) > 0 {
+		spec.Data["ca.crl"] = crlsPEM
+		spec.Data["ca.crt"] = append(append([]byte{}, caBundle...), crlsPEM...)
+	} else {
+		delete(spec.Data, "ca.crl")
+	}
+	if err := verifyMTLSCerts(dexServer.Namespace, spec.Data, spec.Data["ca.crt"]); err != nil {
+		return errors.Wrap(err, "error verifying mtls certs")
+	}
+
+	if !secretExists {
+		log.Info("Creating a new MTLS Secret", "Secret.Namespace", spec.Namespace, "Secret.Name", spec.Name)
+		if err := r.Create(ctx, spec); err != nil {
+			return errors.Wrap(err, "error creating mtls secret")
+		}
+	} else if !equality.Semantic.DeepEqual(secret.Data, spec.Data) || !equality.Semantic.DeepEqual(secret.Annotations, spec.Annotations) {
+		log.Info("Updating MTLS Secret", "Secret.Namespace", spec.Namespace, "Secret.Name", spec.Name, "phase", phase)
+		if err := r.Update(ctx, spec); err != nil {
+			return errors.Wrap(err, "error updating mtls secret")
+		}
 	} else {
 		log.V(1).Info("mtls cert found and does not require renewal")
 	}
+	if signer.privKey != nil {
+		if err := r.syncGRPCClientSecrets(dexServer, signer, spec.Data["ca.crt"], config, ctx); err != nil {
+			return err
+		}
+	}
+	if err := r.deleteGRPCClientSecrets(deletedSecrets, ctx); err != nil {
+		return err
+	}
+
+	// the status is written with the conditions of the DexServer
+	mtlsStatus := &authv1alpha1.MTLSStatus{
+		RotationPhase: phase,
+		CAExpiry:      &metav1.Time{Time: ca.cert.NotAfter},
+	}
+	if certExpiry, err := time.Parse(time.RFC3339, spec.Annotations[MTLS_CERT_EXPIRY_ANNOTATION]); err == nil {
+		mtlsStatus.CertExpiry = &metav1.Time{Time: certExpiry}
+	}
+	dexServer.Status.MTLS = mtlsStatus
 	return nil
 }
 
+// Check that every pod of the dex deployment mounts the current content of the mTLS secret
+func (r *DexServerReconciler) isMTLSSecretRolledOut(dexServer *authv1alpha1.DexServer, secret *corev1.Secret, ctx context.Context) (bool, error) {
+	deployment := &appsv1.Deployment{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Name: dexServer.Name, Namespace: dexServer.Namespace}, deployment); err != nil {
+		if kubeerrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, errors.Wrap(err, "error getting dex server deployment")
+	}
+	annotations := deployment.Spec.Template.Annotations
+	if annotations["auth.identitatem.io/grpcMtlsExpiry"] != secret.Annotations[MTLS_CERT_EXPIRY_ANNOTATION] ||
+		annotations["auth.identitatem.io/grpcMtlsCAHash"] != getMTLSCAHash(secret) {
+		return false, nil
+	}
+	return isDeploymentRolledOut(deployment), nil
+}
+
+// Check that every pod of the deployment runs its current template
+func isDeploymentRolledOut(deployment *appsv1.Deployment) bool {
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	status := deployment.Status
+	return status.ObservedGeneration >= deployment.Generation &&
+		status.UpdatedReplicas == replicas &&
+		status.Replicas == replicas &&
+		status.AvailableReplicas == replicas
+}
+
+// The trusted CAs of the mTLS secret are hashed into the dex pod annotations, so that dex is rolled out when they change
+func getMTLSCAHash(secret *corev1.Secret) string {
+	return fmt.Sprintf("%x", sha256.Sum256(secret.Data["ca.crt"]))
+}
+
 func (r *DexServerReconciler) syncServiceAccount(dexServer *authv1alpha1.DexServer, ctx context.Context) error {
 	log := ctrllog.FromContext(ctx)
 	log.Info("syncServiceAccount", "ServiceAccount.Name", SERVICE_ACCOUNT_NAME)
@@ -597,6 +938,11 @@ func (r *DexServerReconciler) syncDeployment(dexServer *authv1alpha1.DexServer,
 	// Update Volume Mounts based on rootCA secret refs for LDAP connectors (Trusted Root CA and optionally client cert and key files)
 	// Iterate over connectors defined in the DexServer to create the dex configuration for connectors
 	for _, connector := range dexServer.Spec.Connectors {
+		// The credentials of live connectors are applied through the dex API, changes to them must not restart dex
+		if isLiveConnector(dexServer, connector) {
+			continue
+		}
+
 		var secretName string
 		switch connector.Type {
 		case authv1alpha1.ConnectorTypeGitHub:
@@ -676,6 +1022,10 @@ func (r *DexServerReconciler) syncDeployment(dexServer *authv1alpha1.DexServer,
 		connectorCredsHash = connectorCredsHash + fmt.Sprintf("%x", h.Sum(nil)) // If there are multiple connectors, the hashes for the credentials will be concatenated
 
 	}
+	if dexServer.Spec.ConnectorManagement == authv1alpha1.ConnectorManagementLive {
+		// dex serves the connector calls of its API only when enabled
+		additionalEnvVariables = append(additionalEnvVariables, corev1.EnvVar{Name: "DEX_API_CONNECTORS_CRUD", Value: "true"})
+	}
 	if len(additionalVolumeMounts) > 0 {
 		// Get yaml representation of additional volumeMounts and volumes
 		additionalVolumeMountsYaml, err = yaml.Marshal(&additionalVolumeMounts)
@@ -716,7 +1066,7 @@ func (r *DexServerReconciler) syncDeployment(dexServer *authv1alpha1.DexServer,
 		dexConfigMapHash = fmt.Sprintf("%x", h.Sum(nil))
 		// log.Info("computed hash", "dexConfigMapHash", dexConfigMapHash)
 	}
-	var mtlsSecretExpiry string
+	var mtlsSecretExpiry, mtlsCAHash string
 	if mtlsSecret, err := r.getMTLSSecret(dexServer, ctx); err != nil {
 		// If mtls secret is not yet found, the annotation will be omitted, and will be added once the secret is created
 		if !kubeerrors.IsNotFound(err) {
@@ -724,6 +1074,11 @@ func (r *DexServerReconciler) syncDeployment(dexServer *authv1alpha1.DexServer,
 		}
 	} else {
 		mtlsSecretExpiry = mtlsSecret.Annotations[MTLS_CERT_EXPIRY_ANNOTATION]
+		mtlsCAHash = getMTLSCAHash(mtlsSecret)
+	}
+	webTLSHash, err := r.getWebTLSHash(dexServer, ctx)
+	if err != nil {
+		return errors.Wrap(err, "error getting dex server web tls secret")
 	}
 
 	values := struct {
@@ -735,6 +1090,9 @@ func (r *DexServerReconciler) syncDeployment(dexServer *authv1alpha1.DexServer,
 		TlsSecretName            string
 		MtlsSecretName           string
 		MtlsSecretExpiry         string
+		MtlsCAHash               string
+		WebTlsHash               string
+		HealthzPath              string
 		DexServer                *authv1alpha1.DexServer
 		AdditionalEnvVariables   string
 		AdditionalVolumeMounts   string
@@ -752,6 +1110,9 @@ func (r *DexServerReconciler) syncDeployment(dexServer *authv1alpha1.DexServer,
 		// service.beta.openshift.io/serving-cert-secret-name: dexServer.Name-mtls-secret
 		MtlsSecretName:         SECRET_MTLS_NAME,
 		MtlsSecretExpiry:       mtlsSecretExpiry,
+		MtlsCAHash:             mtlsCAHash,
+		WebTlsHash:             webTLSHash,
+		HealthzPath:            path.Join(getIssuerPath(dexServer), "healthz"),
 		DexServer:              dexServer,
 		AdditionalEnvVariables: string(additionalEnvVariablesYaml),
 		AdditionalVolumeMounts: string(additionalVolumeMountsYaml),
@@ -879,6 +1240,10 @@ func (r *DexServerReconciler) syncService(dexServer *authv1alpha1.DexServer, ctx
 		ServingCertSecretName: fmt.Sprintf(dexServer.Name + SECRET_WEB_TLS_SUFFIX),
 		DexServer:             dexServer,
 	}
+	// the serving certificate is issued by cert-manager or by the operator instead of the OpenShift service CA
+	if isCertManagerIssued(dexServer) || r.isWebTLSSelfSigned(dexServer) {
+		values.ServingCertSecretName = ""
+	}
 
 	files := []string{
 		"dex-server/service_http.yaml",
@@ -890,6 +1255,20 @@ func (r *DexServerReconciler) syncService(dexServer *authv1alpha1.DexServer, ctx
 		return err
 	}
 
+	// the applier keeps the annotations it no longer sets, remove the one requesting the OpenShift serving certificate
+	if values.ServingCertSecretName == "" {
+		service := &corev1.Service{}
+		if err := r.Client.Get(ctx, client.ObjectKey{Name: dexServer.Name, Namespace: dexServer.Namespace}, service); err != nil {
+			return err
+		}
+		if _, ok := service.Annotations["service.beta.openshift.io/serving-cert-secret-name"]; ok {
+			delete(service.Annotations, "service.beta.openshift.io/serving-cert-secret-name")
+			if err := r.Client.Update(ctx, service); err != nil {
+				return err
+			}
+		}
+	}
+
 	return nil
 }
 
@@ -987,170 +1366,16 @@ func (r *DexServerReconciler) syncConfigMap(dexServer *authv1alpha1.DexServer, c
 	// Iterate over connectors defined in the DexServer to create the dex configuration for connectors
 
 	for _, connector := range dexServer.Spec.Connectors {
-		// get an alphanumeric ID for the connector that can be used as a suffix in the env variable name containing the secret for this connector
-		connectorAlphanumericId := getUniqueAlphanumericIdForConnector(connector)
-
-		var newConnector DexConnectorSpec
-		switch connector.Type {
-		case authv1alpha1.ConnectorTypeGitHub:
-			// The secret copied into the dexserver ns will be referenced by the env variable in the dexserver deployment
-			err := r.copySecretToDexServerNamespace(dexServer, connector.GitHub.ClientSecretRef, ctx)
-			if err != nil {
-				return err
-			}
-
-			// Environment variable that references the GitHub client secret copied into the dexserver ns
-			// The name includes the connector's alphanumeric unique Id as a suffix to distinguish between client secrets for multiple GitHub connectors
-			clientSecretEnvVariable := "$" + envVariableForConnector[connector.Type].EnvVarName + "_" + connectorAlphanumericId
-
-			newConnector = DexConnectorSpec{
-				Type: string(authv1alpha1.ConnectorTypeGitHub),
-				Id:   connector.Id,
-				Name: connector.Name,
-				Config: DexConnectorConfigSpec{
-					ClientID:      connector.GitHub.ClientID,
-					ClientSecret:  clientSecretEnvVariable,
-					RedirectURI:   connector.GitHub.RedirectURI,
-					Org:           connector.GitHub.Org,
-					Orgs:          connector.GitHub.Orgs,
-					LoadAllGroups: connector.GitHub.LoadAllGroups,
-				},
-			}
-		case authv1alpha1.ConnectorTypeMicrosoft:
-			// The secret copied into the dexserver ns will be referenced by the env variable in the dexserver deployment
-			err := r.copySecretToDexServerNamespace(dexServer, connector.Microsoft.ClientSecretRef, ctx)
-			if err != nil {
-				return err
-			}
-
-			// Environment variable that references the Microsoft OAuth client secret copied into the dexserver ns
-			// The name includes the connector's alphanumeric unique Id as a suffix to distinguish between client secrets for multiple Microsoft connectors
-			clientSecretEnvVariable := "$" + envVariableForConnector[connector.Type].EnvVarName + "_" + connectorAlphanumericId
-
-			newConnector = DexConnectorSpec{
-				Type: string(authv1alpha1.ConnectorTypeMicrosoft),
-				Id:   connector.Id,
-				Name: connector.Name,
-				Config: DexConnectorConfigSpec{
-					ClientID:     connector.Microsoft.ClientID,
-					ClientSecret: clientSecretEnvVariable,
-					RedirectURI:  connector.Microsoft.RedirectURI,
-					Tenant:       connector.Microsoft.Tenant,
-				},
-			}
-		case authv1alpha1.ConnectorTypeLDAP:
-			// The secret copied into the dexserver ns will be referenced by the env variable in the dexserver deployment
-			err := r.copySecretToDexServerNamespace(dexServer, connector.LDAP.BindPWRef, ctx)
-			if err != nil {
-				return err
-			}
-
-			// Environment variable that references the LDAP Bind Password secret copied into the dexserver ns
-			// The name includes the connector's alphanumeric unique Id as a suffix to distinguish between bind passwords for multiple connectors
-			bindPWEnvVariable := "$" + envVariableForConnector[connector.Type].EnvVarName + "_" + connectorAlphanumericId
-
-			// If there is a secret reference to the trusted Root CA
-			var rootCAPath, clientCAPath, clientKeyPath string
-			if connector.LDAP.RootCARef.Name != "" {
-				err := r.copySecretToDexServerNamespace(dexServer, connector.LDAP.RootCARef, ctx)
-				if err != nil {
-					return err
-				}
-				// To ensure uniqueness of names for secrets copied into the dex server namespace, the secret name is prefixed with the original namespace
-				secretName := connector.LDAP.RootCARef.Namespace + "-" + connector.LDAP.RootCARef.Name
-				secretNamespace := dexServer.Namespace
-				resource := &corev1.Secret{}
-
-				if err := r.Get(ctx, types.NamespacedName{Name: secretName, Namespace: secretNamespace}, resource); err != nil {
-					// Error getting secret
-					log.Error(err, "Error getting root CA secret in dex server ns")
-					return err
-				}
-
-				if string(resource.Data["ca.crt"]) != "" {
-					rootCAPath = "/etc/dex/ldapcerts/" + connector.Id + "/ca.crt"
-				}
-				if string(resource.Data["tls.crt"]) != "" {
-					clientCAPath = "/etc/dex/ldapcerts/" + connector.Id + "/tls.crt"
-				}
-				if string(resource.Data["tls.key"]) != "" {
-					clientKeyPath = "/etc/dex/ldapcerts/" + connector.Id + "/tls.key"
-				}
-			}
-
-			newConnector = DexConnectorSpec{
-				Type: string(authv1alpha1.ConnectorTypeLDAP),
-				Id:   connector.Id,
-				Name: connector.Name,
-				Config: DexConnectorConfigSpec{
-					Host:               connector.LDAP.Host,
-					InsecureNoSSL:      connector.LDAP.InsecureNoSSL,
-					InsecureSkipVerify: connector.LDAP.InsecureSkipVerify,
-					StartTLS:           connector.LDAP.StartTLS,
-					RootCA:             rootCAPath,
-					ClientCA:           clientCAPath,
-					ClientKey:          clientKeyPath,
-					BindDN:             connector.LDAP.BindDN,
-					BindPW:             bindPWEnvVariable,
-					UsernamePrompt:     connector.LDAP.UsernamePrompt,
-				},
-			}
-
-			if connector.LDAP.UserSearch.BaseDN != "" {
-				newConnector.Config.UserSearch.BaseDN = connector.LDAP.UserSearch.BaseDN
-				newConnector.Config.UserSearch.Filter = connector.LDAP.UserSearch.Filter
-				newConnector.Config.UserSearch.Username = connector.LDAP.UserSearch.Username
-				newConnector.Config.UserSearch.Scope = connector.LDAP.UserSearch.Scope
-				newConnector.Config.UserSearch.IDAttr = connector.LDAP.UserSearch.IDAttr
-				newConnector.Config.UserSearch.EmailAttr = connector.LDAP.UserSearch.EmailAttr
-				newConnector.Config.UserSearch.NameAttr = connector.LDAP.UserSearch.NameAttr
-				newConnector.Config.UserSearch = authv1alpha1.UserSearchSpec{
-					BaseDN:    connector.LDAP.UserSearch.BaseDN,
-					Filter:    connector.LDAP.UserSearch.Filter,
-					Username:  connector.LDAP.UserSearch.Username,
-					Scope:     connector.LDAP.UserSearch.Scope,
-					IDAttr:    connector.LDAP.UserSearch.IDAttr,
-					EmailAttr: connector.LDAP.UserSearch.EmailAttr,
-					NameAttr:  connector.LDAP.UserSearch.NameAttr,
-				}
-			}
-
-			if connector.LDAP.GroupSearch.BaseDN != "" {
-				newConnector.Config.GroupSearch = authv1alpha1.GroupSearchSpec{
-					BaseDN:       connector.LDAP.GroupSearch.BaseDN,
-					Filter:       connector.LDAP.GroupSearch.Filter,
-					Scope:        connector.LDAP.GroupSearch.Scope,
-					UserMatchers: connector.LDAP.GroupSearch.UserMatchers,
-					NameAttr:     connector.LDAP.GroupSearch.NameAttr,
-				}
-			}
-		case authv1alpha1.ConnectorTypeOIDC:
-			// Check if secret is in the dex server namespace and copy it into the dexserver ns
-			// The secret copied into the dexserver ns will be referenced by the env variable in the dexserver deployment
-			if secretNamespace := connector.OIDC.ClientSecretRef.Namespace; secretNamespace != dexServer.Namespace {
-				err := r.copySecretToDexServerNamespace(dexServer, connector.OIDC.ClientSecretRef, ctx)
-				if err != nil {
-					return err
-				}
-			}
+		// Live connectors are applied through the dex API by syncLiveConnectors
+		if isLiveConnector(dexServer, connector) {
+			continue
+		}
 
-			// Environment variable that references the GitHub client secret copied into the dexserver ns
-			// The name includes the connector's alphanumeric unique Id as a suffix to distinguish between client secrets for multiple GitHub connectors
-			clientSecretEnvVariable := "$" + envVariableForConnector[connector.Type].EnvVarName + "_" + connectorAlphanumericId
-
-			newConnector = DexConnectorSpec{
-				Type: string(authv1alpha1.ConnectorTypeOIDC),
-				Id:   connector.Id,
-				Name: connector.Name,
-				Config: DexConnectorConfigSpec{
-					ClientID:     connector.OIDC.ClientID,
-					ClientSecret: clientSecretEnvVariable,
-					RedirectURI:  connector.OIDC.RedirectURI,
-					Issuer:       connector.OIDC.Issuer,
-					ClaimMapping: connector.OIDC.ClaimMapping,
-				},
-			}
-		default:
+		newConnector, ok, err := r.defineDexConnector(dexServer, connector, ctx)
+		if err != nil {
+			return err
+		}
+		if !ok {
 			return nil
 		}
 
@@ -1195,38 +1420,179 @@ func (r *DexServerReconciler) syncConfigMap(dexServer *authv1alpha1.DexServer, c
 	return nil
 }
 
-func (r *DexServerReconciler) syncIngress(dexServer *authv1alpha1.DexServer, ctx context.Context) error {
+// Define the dex configuration of a connector. The credentials of the connector are referenced through environment
+// variables of the dex deployment. Returns false for connector types that are not supported.
+func (r *DexServerReconciler) defineDexConnector(dexServer *authv1alpha1.DexServer, connector authv1alpha1.ConnectorSpec, ctx context.Context) (DexConnectorSpec, bool, error) {
 	log := ctrllog.FromContext(ctx)
-	u, _ := url.Parse(dexServer.Spec.Issuer)
-	routeHost := u.Host
-	log.Info("syncIngress", "Host", routeHost)
 
-	ingressCertificateRefName := dexServer.Spec.IngressCertificateRef.Name
+	// get an alphanumeric ID for the connector that can be used as a suffix in the env variable name containing the secret for this connector
+	connectorAlphanumericId := getUniqueAlphanumericIdForConnector(connector)
 
-	values := struct {
-		Host                   string
-		DexServer              *authv1alpha1.DexServer
-		IngressCertificateName string
-	}{
-		Host:                   routeHost,
-		DexServer:              dexServer,
-		IngressCertificateName: ingressCertificateRefName,
-	}
+	var newConnector DexConnectorSpec
+	switch connector.Type {
+	case authv1alpha1.ConnectorTypeGitHub:
+		// The secret copied into the dexserver ns will be referenced by the env variable in the dexserver deployment
+		err := r.copySecretToDexServerNamespace(dexServer, connector.GitHub.ClientSecretRef, ctx)
+		if err != nil {
+			return DexConnectorSpec{}, false, err
+		}
 
-	files := []string{
-		"dex-server/ingress.yaml",
-	}
+		// Environment variable that references the GitHub client secret copied into the dexserver ns
+		// The name includes the connector's alphanumeric unique Id as a suffix to distinguish between client secrets for multiple GitHub connectors
+		clientSecretEnvVariable := "$" + envVariableForConnector[connector.Type].EnvVarName + "_" + connectorAlphanumericId
+
+		newConnector = DexConnectorSpec{
+			Type: string(authv1alpha1.ConnectorTypeGitHub),
+			Id:   connector.Id,
+			Name: connector.Name,
+			Config: DexConnectorConfigSpec{
+				ClientID:      connector.GitHub.ClientID,
+				ClientSecret:  clientSecretEnvVariable,
+				RedirectURI:   connector.GitHub.RedirectURI,
+				Org:           connector.GitHub.Org,
+				Orgs:          connector.GitHub.Orgs,
+				LoadAllGroups: connector.GitHub.LoadAllGroups,
+			},
+		}
+	case authv1alpha1.ConnectorTypeMicrosoft:
+		// The secret copied into the dexserver ns will be referenced by the env variable in the dexserver deployment
+		err := r.copySecretToDexServerNamespace(dexServer, connector.Microsoft.ClientSecretRef, ctx)
+		if err != nil {
+			return DexConnectorSpec{}, false, err
+		}
 
-	applier, readerDeploy := r.getApplierAndReader(dexServer)
-	// TODO: ApplyCustomResources is a hack... no support currently for applying a route or ingress and this seems to work
-	_, err := applier.ApplyCustomResources(readerDeploy, values, false, "", files...)
+		// Environment variable that references the Microsoft OAuth client secret copied into the dexserver ns
+		// The name includes the connector's alphanumeric unique Id as a suffix to distinguish between client secrets for multiple Microsoft connectors
+		clientSecretEnvVariable := "$" + envVariableForConnector[connector.Type].EnvVarName + "_" + connectorAlphanumericId
+
+		newConnector = DexConnectorSpec{
+			Type: string(authv1alpha1.ConnectorTypeMicrosoft),
+			Id:   connector.Id,
+			Name: connector.Name,
+			Config: DexConnectorConfigSpec{
+				ClientID:     connector.Microsoft.ClientID,
+				ClientSecret: clientSecretEnvVariable,
+				RedirectURI:  connector.Microsoft.RedirectURI,
+				Tenant:       connector.Microsoft.Tenant,
+			},
+		}
+	case authv1alpha1.ConnectorTypeLDAP:
+		// The secret copied into the dexserver ns will be referenced by the env variable in the dexserver deployment
+		err := r.copySecretToDexServerNamespace(dexServer, connector.LDAP.BindPWRef, ctx)
+		if err != nil {
+			return DexConnectorSpec{}, false, err
+		}
 
-	if err != nil {
-		return err
-	}
+		// Environment variable that references the LDAP Bind Password secret copied into the dexserver ns
+		// The name includes the connector's alphanumeric unique Id as a suffix to distinguish between bind passwords for multiple connectors
+		bindPWEnvVariable := "$" + envVariableForConnector[connector.Type].EnvVarName + "_" + connectorAlphanumericId
 
-	return nil
+		// If there is a secret reference to the trusted Root CA
+		var rootCAPath, clientCAPath, clientKeyPath string
+		if connector.LDAP.RootCARef.Name != "" {
+			err := r.copySecretToDexServerNamespace(dexServer, connector.LDAP.RootCARef, ctx)
+			if err != nil {
+				return DexConnectorSpec{}, false, err
+			}
+			// To ensure uniqueness of names for secrets copied into the dex server namespace, the secret name is prefixed with the original namespace
+			secretName := connector.LDAP.RootCARef.Namespace + "-" + connector.LDAP.RootCARef.Name
+			secretNamespace := dexServer.Namespace
+			resource := &corev1.Secret{}
+
+			if err := r.Get(ctx, types.NamespacedName{Name: secretName, Namespace: secretNamespace}, resource); err != nil {
+				// Error getting secret
+				log.Error(err, "Error getting root CA secret in dex server ns")
+				return DexConnectorSpec{}, false, err
+			}
+
+			if string(resource.Data["ca.crt"]) != "" {
+				rootCAPath = "/etc/dex/ldapcerts/" + connector.Id + "/ca.crt"
+			}
+			if string(resource.Data["tls.crt"]) != "" {
+				clientCAPath = "/etc/dex/ldapcerts/" + connector.Id + "/tls.crt"
+			}
+			if string(resource.Data["tls.key"]) != "" {
+				clientKeyPath = "/etc/dex/ldapcerts/" + connector.Id + "/tls.key"
+			}
+		}
+
+		newConnector = DexConnectorSpec{
+			Type: string(authv1alpha1.ConnectorTypeLDAP),
+			Id:   connector.Id,
+			Name: connector.Name,
+			Config: DexConnectorConfigSpec{
+				Host:               connector.LDAP.Host,
+				InsecureNoSSL:      connector.LDAP.InsecureNoSSL,
+				InsecureSkipVerify: connector.LDAP.InsecureSkipVerify,
+				StartTLS:           connector.LDAP.StartTLS,
+				RootCA:             rootCAPath,
+				ClientCA:           clientCAPath,
+				ClientKey:          clientKeyPath,
+				BindDN:             connector.LDAP.BindDN,
+				BindPW:             bindPWEnvVariable,
+				UsernamePrompt:     connector.LDAP.UsernamePrompt,
+			},
+		}
+
+		if connector.LDAP.UserSearch.BaseDN != "" {
+			newConnector.Config.UserSearch.BaseDN = connector.LDAP.UserSearch.BaseDN
+			newConnector.Config.UserSearch.Filter = connector.LDAP.UserSearch.Filter
+			newConnector.Config.UserSearch.Username = connector.LDAP.UserSearch.Username
+			newConnector.Config.UserSearch.Scope = connector.LDAP.UserSearch.Scope
+			newConnector.Config.UserSearch.IDAttr = connector.LDAP.UserSearch.IDAttr
+			newConnector.Config.UserSearch.EmailAttr = connector.LDAP.UserSearch.EmailAttr
+			newConnector.Config.UserSearch.NameAttr = connector.LDAP.UserSearch.NameAttr
+			newConnector.Config.UserSearch = authv1alpha1.UserSearchSpec{
+				BaseDN:    connector.LDAP.UserSearch.BaseDN,
+				Filter:    connector.LDAP.UserSearch.Filter,
+				Username:  connector.LDAP.UserSearch.Username,
+				Scope:     connector.LDAP.UserSearch.Scope,
+				IDAttr:    connector.LDAP.UserSearch.IDAttr,
+				EmailAttr: connector.LDAP.UserSearch.EmailAttr,
+				NameAttr:  connector.LDAP.UserSearch.NameAttr,
+			}
+		}
 
+		if connector.LDAP.GroupSearch.BaseDN != "" {
+			newConnector.Config.GroupSearch = authv1alpha1.GroupSearchSpec{
+				BaseDN:       connector.LDAP.GroupSearch.BaseDN,
+				Filter:       connector.LDAP.GroupSearch.Filter,
+				Scope:        connector.LDAP.GroupSearch.Scope,
+				UserMatchers: connector.LDAP.GroupSearch.UserMatchers,
+				NameAttr:     connector.LDAP.GroupSearch.NameAttr,
+			}
+		}
+	case authv1alpha1.ConnectorTypeOIDC:
+		// Check if secret is in the dex server namespace and copy it into the dexserver ns
+		// The secret copied into the dexserver ns will be referenced by the env variable in the dexserver deployment
+		if secretNamespace := connector.OIDC.ClientSecretRef.Namespace; secretNamespace != dexServer.Namespace {
+			err := r.copySecretToDexServerNamespace(dexServer, connector.OIDC.ClientSecretRef, ctx)
+			if err != nil {
+				return DexConnectorSpec{}, false, err
+			}
+		}
+
+		// Environment variable that references the GitHub client secret copied into the dexserver ns
+		// The name includes the connector's alphanumeric unique Id as a suffix to distinguish between client secrets for multiple GitHub connectors
+		clientSecretEnvVariable := "$" + envVariableForConnector[connector.Type].EnvVarName + "_" + connectorAlphanumericId
+
+		newConnector = DexConnectorSpec{
+			Type: string(authv1alpha1.ConnectorTypeOIDC),
+			Id:   connector.Id,
+			Name: connector.Name,
+			Config: DexConnectorConfigSpec{
+				ClientID:     connector.OIDC.ClientID,
+				ClientSecret: clientSecretEnvVariable,
+				RedirectURI:  connector.OIDC.RedirectURI,
+				Issuer:       connector.OIDC.Issuer,
+				ClaimMapping: connector.OIDC.ClaimMapping,
+			},
+		}
+	default:
+		return DexConnectorSpec{}, false, nil
+	}
+
+	return newConnector, true, nil
 }
 
 // Rolling restarts are accomplished with an annotation on the pod template. Ignore this and resulting updates
@@ -1321,6 +1687,21 @@ func (r *DexServerReconciler) installClusterRole() error {
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *DexServerReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if r.DexConnections == nil {
+		r.DexConnections = dexapi.NewConnectionManager(dexapi.NewDexAPI)
+	}
+	if r.Platform == "" {
+		platform, err := detectPlatform(r.KubeClient.Discovery())
+		if err != nil {
+			return err
+		}
+		r.Platform = platform
+	}
+	gatewayAPI, err := detectGatewayAPI(r.KubeClient.Discovery())
+	if err != nil {
+		return err
+	}
+	r.GatewayAPI = gatewayAPI
 
 	// Set up the Cluster Role
 	if err := r.installClusterRole(); err != nil {
@@ -1357,7 +1738,12 @@ func (r *DexServerReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		},
 	}
 
-	return ctrl.NewControllerManagedBy(mgr).
+	issuedSecretPredicate := predicate.NewPredicateFuncs(func(o client.Object) bool {
+		_, ok := o.GetLabels()[CERTIFICATE_SECRET_LABEL]
+		return ok
+	})
+
+	controllerBuilder := ctrl.NewControllerManagedBy(mgr).
 		For(&authv1alpha1.DexServer{}, builder.WithPredicates(dexServerPredicate)).
 		Owns(&corev1.ConfigMap{}).
 		Owns(&corev1.Service{}).
@@ -1383,7 +1769,50 @@ func (r *DexServerReconciler) SetupWithManager(mgr ctrl.Manager) error {
 				return requests // Events from the watched secrets mapped to the DexServer resource
 			}),
 			builder.WithPredicates(secretPredicate)). // Predicate to ensure we're only watching secrets that have the label "auth.identitatem.io/idp-credential" on them
-		Complete(r)
+		// The secrets issued by cert-manager are owned by their Certificate, they are labelled with the DexServer instead
+		Watches(&source.Kind{Type: &corev1.Secret{}},
+			handler.EnqueueRequestsFromMapFunc(func(a client.Object) []reconcile.Request {
+				return []reconcile.Request{{
+					NamespacedName: types.NamespacedName{
+						Name:      a.GetLabels()[CERTIFICATE_SECRET_LABEL],
+						Namespace: a.GetNamespace(),
+					},
+				}}
+			}),
+			builder.WithPredicates(issuedSecretPredicate)).
+		// The CA secrets referenced by spec.mtls.caSecretRef are mapped to the DexServers of their namespace referencing
+		// them, so that replacing the CA starts its rotation
+		Watches(&source.Kind{Type: &corev1.Secret{}},
+			handler.EnqueueRequestsFromMapFunc(func(a client.Object) []reconcile.Request {
+				var dexServerList authv1alpha1.DexServerList
+				_ = mgr.GetClient().List(context.TODO(), &dexServerList, client.InNamespace(a.GetNamespace()))
+
+				var requests = []reconcile.Request{}
+				for _, dexServer := range dexServerList.Items {
+					if mtls := dexServer.Spec.MTLS; mtls != nil && mtls.CASecretRef != nil && mtls.CASecretRef.Name == a.GetName() {
+						requests = append(requests, reconcile.Request{
+							NamespacedName: types.NamespacedName{
+								Name:      dexServer.Name,
+								Namespace: dexServer.Namespace,
+							},
+						})
+					}
+				}
+				return requests
+			}))
+	// the Route API is only served on OpenShift
+	if r.Platform == PlatformOpenShift {
+		controllerBuilder = controllerBuilder.Owns(&routev1.Route{})
+	}
+	// follow the status the gateway controllers report in the Gateway API objects
+	if r.GatewayAPI {
+		for _, gvk := range []schema.GroupVersionKind{httpRouteGVK, backendTLSPolicyGVK} {
+			obj := &unstructured.Unstructured{}
+			obj.SetGroupVersionKind(gvk)
+			controllerBuilder = controllerBuilder.Owns(obj)
+		}
+	}
+	return controllerBuilder.Complete(r)
 }
 
 // func (r *DexServerReconciler) startdexServer(ctx context.Context, ds *v1alpha1.DexServer, c client.Client) (*v1alpha1.DexServer, error) {
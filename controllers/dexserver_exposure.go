@@ -0,0 +1,400 @@
+// Copyright Red Hat
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/url"
+	"strings"
+
+	routev1 "github.com/openshift/api/route/v1"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+)
+
+func getExposure(dexServer *authv1alpha1.DexServer) authv1alpha1.ExposureType {
+	if dexServer.Spec.Exposure == "" {
+		return authv1alpha1.ExposureTypeIngress
+	}
+	return dexServer.Spec.Exposure
+}
+
+func getRouteTermination(dexServer *authv1alpha1.DexServer) authv1alpha1.RouteTermination {
+	if dexServer.Spec.Route == nil || dexServer.Spec.Route.Termination == "" {
+		return authv1alpha1.RouteTerminationReencrypt
+	}
+	return dexServer.Spec.Route.Termination
+}
+
+// The additional hosts of the DexServer, then the deprecated extra hosts of the Ingress, without the host of the issuer
+// and the duplicates
+func getAdditionalHosts(dexServer *authv1alpha1.DexServer) []authv1alpha1.AdditionalHostSpec {
+	seen := map[string]bool{}
+	if u, err := url.Parse(dexServer.Spec.Issuer); err == nil {
+		seen[u.Hostname()] = true
+	}
+	hosts := []authv1alpha1.AdditionalHostSpec{}
+	for _, host := range dexServer.Spec.AdditionalHosts {
+		if !seen[host.Host] {
+			seen[host.Host] = true
+			hosts = append(hosts, host)
+		}
+	}
+	if dexServer.Spec.Ingress != nil {
+		for _, host := range dexServer.Spec.Ingress.ExtraHosts {
+			if !seen[host] {
+				seen[host] = true
+				hosts = append(hosts, authv1alpha1.AdditionalHostSpec{Host: host})
+			}
+		}
+	}
+	return hosts
+}
+
+// The name of the Route exposing dex on an additional host, suffixed with a short hash of the host so that it is
+// unique and short whatever the host
+func getAdditionalHostRouteName(dexServer *authv1alpha1.DexServer, host string) string {
+	hash := sha256.Sum256([]byte(host))
+	return fmt.Sprintf("%s-%x", dexServer.Name, hash[:4])
+}
+
+// The status of the exposure, stating the issuer the tokens are issued under whichever host dex is reached on
+func getExposureStatus(dexServer *authv1alpha1.DexServer) *authv1alpha1.ExposureStatus {
+	status := &authv1alpha1.ExposureStatus{
+		Type:   getExposure(dexServer),
+		Issuer: dexServer.Spec.Issuer,
+	}
+	for _, host := range getAdditionalHosts(dexServer) {
+		status.AdditionalHosts = append(status.AdditionalHosts, host.Host)
+	}
+	if len(status.AdditionalHosts) > 0 {
+		status.Message = fmt.Sprintf("dex is also reachable on %s, the tokens are still issued under the canonical issuer %s",
+			strings.Join(status.AdditionalHosts, ", "), dexServer.Spec.Issuer)
+	}
+	return status
+}
+
+// Expose the dex web endpoint as selected by spec.exposure. The objects of the other exposures are deleted first, so
+// that the host of the issuer is released before it is claimed again.
+func (r *DexServerReconciler) syncExposure(dexServer *authv1alpha1.DexServer, ctx context.Context) error {
+	exposure := getExposure(dexServer)
+	if exposure != authv1alpha1.ExposureTypeIngress {
+		if err := r.deleteExposureObject(dexServer, &networkingv1.Ingress{}, dexServer.Name, ctx); err != nil {
+			return errors.Wrap(err, "error deleting ingress")
+		}
+	}
+	// the Route API is only served on OpenShift
+	if exposure != authv1alpha1.ExposureTypeRoute && r.Platform == PlatformOpenShift {
+		if err := r.deleteRoutes(dexServer, nil, ctx); err != nil {
+			return err
+		}
+	}
+	if exposure != authv1alpha1.ExposureTypeGatewayAPI {
+		if err := r.deleteGatewayAPIObjects(dexServer, ctx); err != nil {
+			return err
+		}
+	}
+
+	status := getExposureStatus(dexServer)
+	var accepted *metav1.Condition
+	switch exposure {
+	case authv1alpha1.ExposureTypeIngress:
+		if err := r.syncIngress(dexServer, ctx); err != nil {
+			return err
+		}
+	case authv1alpha1.ExposureTypeRoute:
+		routes, err := r.syncRoutes(dexServer, ctx)
+		if err != nil {
+			return err
+		}
+		status.Host = getAdmittedRouteHost(routes[0])
+		condition := getRouteAdmittedCondition(routes[0])
+		// the condition reports the first Route of an additional host not admitted yet
+		for _, route := range routes[1:] {
+			if condition.Status != metav1.ConditionTrue {
+				break
+			}
+			if c := getRouteAdmittedCondition(route); c.Status != metav1.ConditionTrue {
+				c.Message = fmt.Sprintf("the Route of the additional host %s: %s", route.Spec.Host, c.Message)
+				condition = c
+			}
+		}
+		accepted = &condition
+	case authv1alpha1.ExposureTypeGatewayAPI:
+		httpRoute, policy, err := r.syncGatewayAPI(dexServer, ctx)
+		if err != nil {
+			return err
+		}
+		condition := getGatewayRouteAcceptedCondition(httpRoute, policy, dexServer)
+		if condition.Status == metav1.ConditionTrue {
+			hostnames, _, _ := unstructured.NestedStringSlice(httpRoute.Object, "spec", "hostnames")
+			if len(hostnames) > 0 {
+				status.Host = hostnames[0]
+			}
+		}
+		accepted = &condition
+	}
+	dexServer.Status.Exposure = status
+	if accepted != nil {
+		meta.SetStatusCondition(&dexServer.Status.Conditions, *accepted)
+	} else {
+		meta.RemoveStatusCondition(&dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeRouteAccepted)
+	}
+	return nil
+}
+
+// Delete an object of a previous exposure when the DexServer controls it
+func (r *DexServerReconciler) deleteExposureObject(dexServer *authv1alpha1.DexServer, obj client.Object, name string, ctx context.Context) error {
+	log := ctrllog.FromContext(ctx)
+	if err := r.Client.Get(ctx, client.ObjectKey{Name: name, Namespace: dexServer.Namespace}, obj); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if !metav1.IsControlledBy(obj, dexServer) {
+		return nil
+	}
+	gvk, err := apiutil.GVKForObject(obj, r.Scheme)
+	if err != nil {
+		return err
+	}
+	log.Info("deleting the object of a previous exposure", "kind", gvk.Kind, "name", obj.GetName())
+	if err := r.Client.Delete(ctx, obj); err != nil && !kubeerrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// The CA of a serving certificate issued by cert-manager or by the operator, from the web TLS secret
+func (r *DexServerReconciler) getWebTLSCA(dexServer *authv1alpha1.DexServer, ctx context.Context) (string, error) {
+	secret := &corev1.Secret{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Name: dexServer.Name + SECRET_WEB_TLS_SUFFIX, Namespace: dexServer.Namespace}, secret); err != nil {
+		// the secret is not issued yet, the route is updated once it is
+		return "", client.IgnoreNotFound(err)
+	}
+	return string(secret.Data["ca.crt"]), nil
+}
+
+// The CA the router trusts when reencrypting to dex. The router already trusts the OpenShift service CA.
+func (r *DexServerReconciler) getRouteDestinationCA(dexServer *authv1alpha1.DexServer, ctx context.Context) (string, error) {
+	if !isCertManagerIssued(dexServer) && !r.isWebTLSSelfSigned(dexServer) {
+		return "", nil
+	}
+	return r.getWebTLSCA(dexServer, ctx)
+}
+
+// Define an OpenShift Route exposing the dex web endpoint on a host, presenting the certificate of the secret when
+// reencrypting. The spec sets the fields defaulted by the API server, so that it compares equal to the stored Route.
+func (r *DexServerReconciler) defineRoute(dexServer *authv1alpha1.DexServer, name string, host string, certificateRef string, ctx context.Context) (*routev1.Route, error) {
+	var err error
+	weight := int32(100)
+	route := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: dexServer.Namespace,
+			Labels: map[string]string{
+				"app":                 dexServer.Name,
+				"dexconfig_name":      dexServer.Name,
+				"dexconfig_namespace": dexServer.Namespace,
+			},
+		},
+		Spec: routev1.RouteSpec{
+			Host: host,
+			To: routev1.RouteTargetReference{
+				Kind:   "Service",
+				Name:   dexServer.Name,
+				Weight: &weight,
+			},
+			Port: &routev1.RoutePort{
+				TargetPort: intstr.FromString("http"),
+			},
+			TLS: &routev1.TLSConfig{
+				InsecureEdgeTerminationPolicy: routev1.InsecureEdgeTerminationPolicyRedirect,
+			},
+			WildcardPolicy: routev1.WildcardPolicyNone,
+		},
+	}
+
+	switch getRouteTermination(dexServer) {
+	case authv1alpha1.RouteTerminationPassthrough:
+		if !isCertManagerIssued(dexServer) && !r.isWebTLSSelfSigned(dexServer) {
+			return nil, errors.New("passthrough termination requires the certificate of the dex web endpoint to be issued by cert-manager")
+		}
+		route.Spec.TLS.Termination = routev1.TLSTerminationPassthrough
+	default:
+		route.Spec.TLS.Termination = routev1.TLSTerminationReencrypt
+		// passthrough Routes can not select a path, the router does not see the requests
+		if path := getIssuerPath(dexServer); path != "/" {
+			route.Spec.Path = path
+		}
+		if certificateRef != "" {
+			secret := &corev1.Secret{}
+			if err := r.Client.Get(ctx, client.ObjectKey{Name: certificateRef, Namespace: dexServer.Namespace}, secret); err != nil {
+				return nil, errors.Wrapf(err, "error getting certificate secret %s", certificateRef)
+			}
+			// watch the secret, the route embeds the certificate
+			checkAndAddLabelToSecret(secret, r, ctx)
+			route.Spec.TLS.Certificate = string(secret.Data["tls.crt"])
+			route.Spec.TLS.Key = string(secret.Data["tls.key"])
+			route.Spec.TLS.CACertificate = string(secret.Data["ca.crt"])
+		}
+		if route.Spec.TLS.DestinationCACertificate, err = r.getRouteDestinationCA(dexServer, ctx); err != nil {
+			return nil, errors.Wrap(err, "error getting web tls secret")
+		}
+	}
+
+	if err := ctrl.SetControllerReference(dexServer, route, r.Scheme); err != nil {
+		return nil, err
+	}
+	return route, nil
+}
+
+// The host of the Route once admitted by a router
+func getAdmittedRouteHost(route *routev1.Route) string {
+	for _, ingress := range route.Status.Ingress {
+		for _, condition := range ingress.Conditions {
+			if condition.Type == routev1.RouteAdmitted && condition.Status == corev1.ConditionTrue {
+				return ingress.Host
+			}
+		}
+	}
+	return ""
+}
+
+// The RouteAccepted condition in Route exposure, from the Admitted condition reported by the routers
+func getRouteAdmittedCondition(route *routev1.Route) metav1.Condition {
+	var rejected *routev1.RouteIngressCondition
+	for _, ingress := range route.Status.Ingress {
+		for i, condition := range ingress.Conditions {
+			if condition.Type != routev1.RouteAdmitted {
+				continue
+			}
+			if condition.Status == corev1.ConditionTrue {
+				return metav1.Condition{
+					Type:    authv1alpha1.DexServerConditionTypeRouteAccepted,
+					Status:  metav1.ConditionTrue,
+					Reason:  "Admitted",
+					Message: fmt.Sprintf("the Route is admitted by the router %s", ingress.RouterName),
+				}
+			}
+			rejected = &ingress.Conditions[i]
+		}
+	}
+	if rejected != nil {
+		reason := rejected.Reason
+		if reason == "" {
+			reason = "NotAdmitted"
+		}
+		return metav1.Condition{
+			Type:    authv1alpha1.DexServerConditionTypeRouteAccepted,
+			Status:  metav1.ConditionFalse,
+			Reason:  reason,
+			Message: rejected.Message,
+		}
+	}
+	return metav1.Condition{
+		Type:    authv1alpha1.DexServerConditionTypeRouteAccepted,
+		Status:  metav1.ConditionUnknown,
+		Reason:  "Pending",
+		Message: "the Route is not admitted by a router yet",
+	}
+}
+
+// Create or update the OpenShift Routes of the dex web endpoint, the one of the host of the issuer first, then one per
+// additional host, and return them with the status reported by the routers. The Routes of removed hosts are deleted.
+func (r *DexServerReconciler) syncRoutes(dexServer *authv1alpha1.DexServer, ctx context.Context) ([]*routev1.Route, error) {
+	if r.Platform != PlatformOpenShift {
+		return nil, errors.New("exposure Route is only supported on OpenShift")
+	}
+	u, err := url.Parse(dexServer.Spec.Issuer)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing issuer")
+	}
+	if u.Hostname() == "" {
+		return nil, errors.Errorf("issuer %q has no host to route", dexServer.Spec.Issuer)
+	}
+	desired, err := r.defineRoute(dexServer, dexServer.Name, u.Hostname(), dexServer.Spec.IngressCertificateRef.Name, ctx)
+	if err != nil {
+		return nil, err
+	}
+	routes := []*routev1.Route{desired}
+	for _, host := range getAdditionalHosts(dexServer) {
+		desired, err := r.defineRoute(dexServer, getAdditionalHostRouteName(dexServer, host.Host), host.Host, host.CertificateRef.Name, ctx)
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, desired)
+	}
+
+	keep := map[string]bool{}
+	for i, desired := range routes {
+		if routes[i], err = r.syncRoute(desired, ctx); err != nil {
+			return nil, err
+		}
+		keep[desired.Name] = true
+	}
+	if err := r.deleteRoutes(dexServer, keep, ctx); err != nil {
+		return nil, err
+	}
+	return routes, nil
+}
+
+// Delete the Routes of the DexServer but the kept ones
+func (r *DexServerReconciler) deleteRoutes(dexServer *authv1alpha1.DexServer, keep map[string]bool, ctx context.Context) error {
+	log := ctrllog.FromContext(ctx)
+	routes := &routev1.RouteList{}
+	if err := r.Client.List(ctx, routes, client.InNamespace(dexServer.Namespace), client.MatchingLabels{"app": dexServer.Name}); err != nil {
+		return errors.Wrap(err, "error listing routes")
+	}
+	for i := range routes.Items {
+		route := &routes.Items[i]
+		if keep[route.Name] || !metav1.IsControlledBy(route, dexServer) {
+			continue
+		}
+		log.Info("Deleting Route", "Route.Namespace", route.Namespace, "Route.Name", route.Name, "Host", route.Spec.Host)
+		if err := r.Client.Delete(ctx, route); err != nil && !kubeerrors.IsNotFound(err) {
+			return errors.Wrap(err, "error deleting route")
+		}
+	}
+	return nil
+}
+
+// Create or update an OpenShift Route of the dex web endpoint, and return it with the status reported by the routers
+func (r *DexServerReconciler) syncRoute(desired *routev1.Route, ctx context.Context) (*routev1.Route, error) {
+	log := ctrllog.FromContext(ctx)
+	log.Info("syncRoute", "Host", desired.Spec.Host, "Termination", desired.Spec.TLS.Termination)
+
+	route := &routev1.Route{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Name: desired.Name, Namespace: desired.Namespace}, route); err != nil {
+		if !kubeerrors.IsNotFound(err) {
+			return nil, errors.Wrap(err, "error getting route")
+		}
+		log.Info("Creating a new Route", "Route.Namespace", desired.Namespace, "Route.Name", desired.Name)
+		if err := r.Client.Create(ctx, desired); err != nil {
+			return nil, errors.Wrap(err, "error creating route")
+		}
+		return desired, nil
+	}
+	if !equality.Semantic.DeepEqual(route.Spec, desired.Spec) || !equality.Semantic.DeepEqual(route.Labels, desired.Labels) {
+		log.Info("Updating Route", "Route.Namespace", route.Namespace, "Route.Name", route.Name)
+		route.Labels = desired.Labels
+		route.Spec = desired.Spec
+		if err := r.Client.Update(ctx, route); err != nil {
+			return nil, errors.Wrap(err, "error updating route")
+		}
+	}
+	return route, nil
+}
@@ -0,0 +1,122 @@
+// Copyright Red Hat
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	routev1 "github.com/openshift/api/route/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+)
+
+var _ = Describe("Expose the dex web endpoint of a DexServer", func() {
+	DexServerName := "dex-server-exposure"
+	DexServerNamespace := "dex-server-exposure-ns"
+	DexServerHost := "dex-server-exposure.example.com"
+
+	getDexServer := func() *authv1alpha1.DexServer {
+		dexServer := &authv1alpha1.DexServer{}
+		Expect(k8sClient.Get(context.TODO(), client.ObjectKey{Name: DexServerName, Namespace: DexServerNamespace}, dexServer)).To(Succeed())
+		return dexServer
+	}
+
+	updateDexServer := func(update func(dexServer *authv1alpha1.DexServer)) {
+		dexServer := getDexServer()
+		update(dexServer)
+		Expect(k8sClient.Update(context.TODO(), dexServer)).To(Succeed())
+	}
+
+	getRoute := func() (*routev1.Route, error) {
+		route := &routev1.Route{}
+		err := k8sClient.Get(context.TODO(), client.ObjectKey{Name: DexServerName, Namespace: DexServerNamespace}, route)
+		return route, err
+	}
+
+	It("should expose dex through a reencrypt Route", func() {
+		createDexServer(&authv1alpha1.DexServer{
+			ObjectMeta: metav1.ObjectMeta{Name: DexServerName, Namespace: DexServerNamespace},
+			Spec: authv1alpha1.DexServerSpec{
+				Issuer:                "https://" + DexServerHost,
+				IngressCertificateRef: corev1.LocalObjectReference{Name: "dex-server-exposure-cert"},
+				Exposure:              authv1alpha1.ExposureTypeRoute,
+			},
+		}, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "dex-server-exposure-cert", Namespace: DexServerNamespace},
+			Data: map[string][]byte{
+				"tls.crt": []byte("certificate"),
+				"tls.key": []byte("key"),
+			},
+		})
+		reconcileDexServer(DexServerName, DexServerNamespace)
+
+		route, err := getRoute()
+		Expect(err).To(BeNil())
+		Expect(route.Spec.Host).To(Equal(DexServerHost))
+		Expect(route.Spec.To.Name).To(Equal(DexServerName))
+		Expect(route.Spec.TLS.Termination).To(Equal(routev1.TLSTerminationReencrypt))
+		Expect(route.Spec.TLS.Certificate).To(Equal("certificate"))
+		Expect(route.Spec.TLS.Key).To(Equal("key"))
+		// the router trusts the OpenShift service CA
+		Expect(route.Spec.TLS.DestinationCACertificate).To(BeEmpty())
+		Expect(metav1.IsControlledBy(route, getDexServer())).To(BeTrue())
+
+		err = k8sClient.Get(context.TODO(), client.ObjectKey{Name: DexServerName, Namespace: DexServerNamespace}, &networkingv1.Ingress{})
+		Expect(kubeerrors.IsNotFound(err)).To(BeTrue())
+	})
+	It("should report the host admitted by the router", func() {
+		Expect(getDexServer().Status.Exposure.Host).To(BeEmpty())
+
+		route, err := getRoute()
+		Expect(err).To(BeNil())
+		route.Status.Ingress = []routev1.RouteIngress{{
+			Host:       DexServerHost,
+			RouterName: "default",
+			Conditions: []routev1.RouteIngressCondition{{
+				Type:   routev1.RouteAdmitted,
+				Status: corev1.ConditionTrue,
+			}},
+		}}
+		Expect(k8sClient.Status().Update(context.TODO(), route)).To(Succeed())
+		reconcileDexServer(DexServerName, DexServerNamespace)
+
+		status := getDexServer().Status.Exposure
+		Expect(status.Type).To(Equal(authv1alpha1.ExposureTypeRoute))
+		Expect(status.Host).To(Equal(DexServerHost))
+	})
+	It("should refuse passthrough with the certificate of the OpenShift service CA", func() {
+		updateDexServer(func(dexServer *authv1alpha1.DexServer) {
+			dexServer.Spec.Route = &authv1alpha1.RouteSpec{Termination: authv1alpha1.RouteTerminationPassthrough}
+		})
+		Expect(reconcileDexServerOnce(DexServerName, DexServerNamespace)).ToNot(Succeed())
+		Expect(getDexServer().Status.Conditions).To(ContainElement(HaveField("Reason", "ConfigExposureFailed")))
+	})
+	It("should replace the Route with an Ingress", func() {
+		updateDexServer(func(dexServer *authv1alpha1.DexServer) {
+			dexServer.Spec.Route = nil
+			dexServer.Spec.Exposure = authv1alpha1.ExposureTypeIngress
+		})
+		reconcileDexServer(DexServerName, DexServerNamespace)
+
+		_, err := getRoute()
+		Expect(kubeerrors.IsNotFound(err)).To(BeTrue())
+		Expect(k8sClient.Get(context.TODO(), client.ObjectKey{Name: DexServerName, Namespace: DexServerNamespace}, &networkingv1.Ingress{})).To(Succeed())
+	})
+	It("should not expose dex", func() {
+		updateDexServer(func(dexServer *authv1alpha1.DexServer) {
+			dexServer.Spec.Exposure = authv1alpha1.ExposureTypeNone
+		})
+		reconcileDexServer(DexServerName, DexServerNamespace)
+
+		err := k8sClient.Get(context.TODO(), client.ObjectKey{Name: DexServerName, Namespace: DexServerNamespace}, &networkingv1.Ingress{})
+		Expect(kubeerrors.IsNotFound(err)).To(BeTrue())
+		Expect(getDexServer().Status.Exposure.Type).To(Equal(authv1alpha1.ExposureTypeNone))
+	})
+})
@@ -0,0 +1,370 @@
+// Copyright Red Hat
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+)
+
+const (
+	GATEWAY_API_GROUP              = "gateway.networking.k8s.io"
+	CONFIGMAP_WEB_CA_SUFFIX        = "-web-ca"
+	OPENSHIFT_SERVICE_CA_CONFIGMAP = "openshift-service-ca.crt"
+	WEB_SERVICE_PORT               = 5556
+)
+
+// The Gateway API is not a dependency of the operator, its objects are handled as unstructured objects
+var (
+	httpRouteGVK        = schema.GroupVersionKind{Group: GATEWAY_API_GROUP, Version: "v1", Kind: "HTTPRoute"}
+	backendTLSPolicyGVK = schema.GroupVersionKind{Group: GATEWAY_API_GROUP, Version: "v1", Kind: "BackendTLSPolicy"}
+)
+
+// The status reported by a gateway controller for a parent Gateway, in the parents of an HTTPRoute or the ancestors
+// of a BackendTLSPolicy
+type gatewayParentStatus struct {
+	ParentRef   gatewayParentReference `json:"parentRef,omitempty"`
+	AncestorRef gatewayParentReference `json:"ancestorRef,omitempty"`
+	Conditions  []metav1.Condition     `json:"conditions,omitempty"`
+}
+
+type gatewayParentReference struct {
+	Name      string `json:"name,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+func getGatewayNamespace(dexServer *authv1alpha1.DexServer) string {
+	if dexServer.Spec.Gateway.Namespace == "" {
+		return dexServer.Namespace
+	}
+	return dexServer.Spec.Gateway.Namespace
+}
+
+// The name of the dex http service, validated by the Gateway against the serving certificate of dex
+func getWebServiceHostname(dexServer *authv1alpha1.DexServer) string {
+	return fmt.Sprintf("%s.%s.svc", dexServer.Name, dexServer.Namespace)
+}
+
+// The CA of the dex serving certificate, trusted by the Gateway through the BackendTLSPolicy: the OpenShift service CA
+// published in every namespace, or the CA of the certificate issued by cert-manager or by the operator
+func (r *DexServerReconciler) getBackendCA(dexServer *authv1alpha1.DexServer, ctx context.Context) (string, error) {
+	if !isCertManagerIssued(dexServer) && !r.isWebTLSSelfSigned(dexServer) {
+		configMap := &corev1.ConfigMap{}
+		if err := r.Client.Get(ctx, client.ObjectKey{Name: OPENSHIFT_SERVICE_CA_CONFIGMAP, Namespace: dexServer.Namespace}, configMap); err != nil {
+			return "", errors.Wrap(err, "error getting the openshift service ca")
+		}
+		return configMap.Data["service-ca.crt"], nil
+	}
+	return r.getWebTLSCA(dexServer, ctx)
+}
+
+// Write the CA of the dex serving certificate to the <name>-web-ca ConfigMap referenced by the BackendTLSPolicy
+func (r *DexServerReconciler) syncBackendCAConfigMap(dexServer *authv1alpha1.DexServer, ctx context.Context) error {
+	log := ctrllog.FromContext(ctx)
+	ca, err := r.getBackendCA(dexServer, ctx)
+	if err != nil {
+		return err
+	}
+	if ca == "" {
+		return errors.New("the CA of the dex serving certificate is not issued yet")
+	}
+	spec := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      dexServer.Name + CONFIGMAP_WEB_CA_SUFFIX,
+			Namespace: dexServer.Namespace,
+			Labels: map[string]string{
+				"app": dexServer.Name,
+			},
+		},
+		Data: map[string]string{
+			"ca.crt": ca,
+		},
+	}
+	if err := ctrl.SetControllerReference(dexServer, spec, r.Scheme); err != nil {
+		return err
+	}
+	configMap := &corev1.ConfigMap{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Name: spec.Name, Namespace: spec.Namespace}, configMap); err != nil {
+		if !kubeerrors.IsNotFound(err) {
+			return errors.Wrap(err, "error getting web ca configmap")
+		}
+		log.Info("Creating a new ConfigMap", "ConfigMap.Namespace", spec.Namespace, "ConfigMap.Name", spec.Name)
+		if err := r.Client.Create(ctx, spec); err != nil {
+			return errors.Wrap(err, "error creating web ca configmap")
+		}
+		return nil
+	}
+	if !equality.Semantic.DeepEqual(configMap.Data, spec.Data) {
+		log.Info("Updating ConfigMap", "ConfigMap.Namespace", spec.Namespace, "ConfigMap.Name", spec.Name)
+		configMap.Data = spec.Data
+		if err := r.Client.Update(ctx, configMap); err != nil {
+			return errors.Wrap(err, "error updating web ca configmap")
+		}
+	}
+	return nil
+}
+
+// Define the HTTPRoute attaching the host of the issuer to the parent Gateway. The spec sets the fields defaulted by
+// the API server, so that it compares equal to the stored HTTPRoute.
+func (r *DexServerReconciler) defineHTTPRoute(dexServer *authv1alpha1.DexServer) (*unstructured.Unstructured, error) {
+	u, err := url.Parse(dexServer.Spec.Issuer)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing issuer")
+	}
+	if u.Hostname() == "" {
+		return nil, errors.Errorf("issuer %q has no host to route", dexServer.Spec.Issuer)
+	}
+	gateway := dexServer.Spec.Gateway
+	parentRef := map[string]interface{}{
+		"group":     GATEWAY_API_GROUP,
+		"kind":      "Gateway",
+		"name":      gateway.Name,
+		"namespace": getGatewayNamespace(dexServer),
+	}
+	if gateway.SectionName != "" {
+		parentRef["sectionName"] = gateway.SectionName
+	}
+	if gateway.Port != nil {
+		parentRef["port"] = int64(*gateway.Port)
+	}
+	// the host of the issuer first, it is the one reported once the HTTPRoute is accepted
+	hostnames := []interface{}{u.Hostname()}
+	for _, host := range getAdditionalHosts(dexServer) {
+		hostnames = append(hostnames, host.Host)
+	}
+	spec := map[string]interface{}{
+		"parentRefs": []interface{}{parentRef},
+		"hostnames":  hostnames,
+		"rules": []interface{}{
+			map[string]interface{}{
+				"matches": []interface{}{
+					map[string]interface{}{
+						"path": map[string]interface{}{
+							"type":  "PathPrefix",
+							"value": getIssuerPath(dexServer),
+						},
+					},
+				},
+				"backendRefs": []interface{}{
+					map[string]interface{}{
+						"group":  "",
+						"kind":   "Service",
+						"name":   dexServer.Name,
+						"port":   int64(WEB_SERVICE_PORT),
+						"weight": int64(1),
+					},
+				},
+			},
+		},
+	}
+	return r.defineGatewayObject(dexServer, httpRouteGVK, spec)
+}
+
+// Define the BackendTLSPolicy having the Gateway reencrypt to dex, trusting the CA of the dex serving certificate
+func (r *DexServerReconciler) defineBackendTLSPolicy(dexServer *authv1alpha1.DexServer) (*unstructured.Unstructured, error) {
+	spec := map[string]interface{}{
+		"targetRefs": []interface{}{
+			map[string]interface{}{
+				"group":       "",
+				"kind":        "Service",
+				"name":        dexServer.Name,
+				"sectionName": "http",
+			},
+		},
+		"validation": map[string]interface{}{
+			"caCertificateRefs": []interface{}{
+				map[string]interface{}{
+					"group": "",
+					"kind":  "ConfigMap",
+					"name":  dexServer.Name + CONFIGMAP_WEB_CA_SUFFIX,
+				},
+			},
+			"hostname": getWebServiceHostname(dexServer),
+		},
+	}
+	return r.defineGatewayObject(dexServer, backendTLSPolicyGVK, spec)
+}
+
+func (r *DexServerReconciler) defineGatewayObject(dexServer *authv1alpha1.DexServer, gvk schema.GroupVersionKind, spec map[string]interface{}) (*unstructured.Unstructured, error) {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(gvk)
+	obj.SetName(dexServer.Name)
+	obj.SetNamespace(dexServer.Namespace)
+	obj.SetLabels(map[string]string{"app": dexServer.Name})
+	if err := unstructured.SetNestedField(obj.Object, spec, "spec"); err != nil {
+		return nil, err
+	}
+	if err := ctrl.SetControllerReference(dexServer, obj, r.Scheme); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// Create or update a Gateway API object, and return it with the status reported by the gateway controllers
+func (r *DexServerReconciler) applyGatewayObject(desired *unstructured.Unstructured, ctx context.Context) (*unstructured.Unstructured, error) {
+	log := ctrllog.FromContext(ctx)
+	kind := desired.GetKind()
+	current := &unstructured.Unstructured{}
+	current.SetGroupVersionKind(desired.GroupVersionKind())
+	err := r.Client.Get(ctx, client.ObjectKey{Name: desired.GetName(), Namespace: desired.GetNamespace()}, current)
+	switch {
+	case kubeerrors.IsNotFound(err):
+		log.Info("creating "+kind, "name", desired.GetName())
+		if err := r.Client.Create(ctx, desired); err != nil {
+			return nil, errors.Wrapf(err, "error creating %s", kind)
+		}
+		return desired, nil
+	case err != nil:
+		return nil, errors.Wrapf(err, "error getting %s", kind)
+	case !equality.Semantic.DeepEqual(current.Object["spec"], desired.Object["spec"]):
+		log.Info("updating "+kind, "name", desired.GetName())
+		current.Object["spec"] = desired.Object["spec"]
+		if err := r.Client.Update(ctx, current); err != nil {
+			return nil, errors.Wrapf(err, "error updating %s", kind)
+		}
+	}
+	return current, nil
+}
+
+// Expose the dex web endpoint through an HTTPRoute attached to the parent Gateway, with a BackendTLSPolicy for the TLS
+// connection from the Gateway to dex
+func (r *DexServerReconciler) syncGatewayAPI(dexServer *authv1alpha1.DexServer, ctx context.Context) (*unstructured.Unstructured, *unstructured.Unstructured, error) {
+	if !r.GatewayAPI {
+		return nil, nil, errors.New("exposure GatewayAPI requires the HTTPRoute and BackendTLSPolicy kinds of the Gateway API v1")
+	}
+	if dexServer.Spec.Gateway == nil || dexServer.Spec.Gateway.Name == "" {
+		return nil, nil, errors.New("gateway.name is required in GatewayAPI exposure")
+	}
+	if err := r.syncBackendCAConfigMap(dexServer, ctx); err != nil {
+		return nil, nil, err
+	}
+	desiredPolicy, err := r.defineBackendTLSPolicy(dexServer)
+	if err != nil {
+		return nil, nil, err
+	}
+	policy, err := r.applyGatewayObject(desiredPolicy, ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	desiredHTTPRoute, err := r.defineHTTPRoute(dexServer)
+	if err != nil {
+		return nil, nil, err
+	}
+	httpRoute, err := r.applyGatewayObject(desiredHTTPRoute, ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return httpRoute, policy, nil
+}
+
+// Delete the Gateway API objects of a previous GatewayAPI exposure
+func (r *DexServerReconciler) deleteGatewayAPIObjects(dexServer *authv1alpha1.DexServer, ctx context.Context) error {
+	if r.GatewayAPI {
+		for _, gvk := range []schema.GroupVersionKind{httpRouteGVK, backendTLSPolicyGVK} {
+			obj := &unstructured.Unstructured{}
+			obj.SetGroupVersionKind(gvk)
+			if err := r.deleteExposureObject(dexServer, obj, dexServer.Name, ctx); err != nil {
+				return errors.Wrapf(err, "error deleting %s", gvk.Kind)
+			}
+		}
+	}
+	if err := r.deleteExposureObject(dexServer, &corev1.ConfigMap{}, dexServer.Name+CONFIGMAP_WEB_CA_SUFFIX, ctx); err != nil {
+		return errors.Wrap(err, "error deleting web ca configmap")
+	}
+	return nil
+}
+
+// The conditions reported for the parent Gateway in the status of an HTTPRoute (parents) or a BackendTLSPolicy
+// (ancestors). Conditions observing a previous generation of the object are left out.
+func getGatewayParentConditions(obj *unstructured.Unstructured, field string, dexServer *authv1alpha1.DexServer) []metav1.Condition {
+	items, _, _ := unstructured.NestedSlice(obj.Object, "status", field)
+	for _, item := range items {
+		content, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		status := gatewayParentStatus{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(content, &status); err != nil {
+			continue
+		}
+		ref := status.ParentRef
+		if field == "ancestors" {
+			ref = status.AncestorRef
+		}
+		namespace := ref.Namespace
+		if namespace == "" {
+			namespace = obj.GetNamespace()
+		}
+		if ref.Name != dexServer.Spec.Gateway.Name || namespace != getGatewayNamespace(dexServer) {
+			continue
+		}
+		conditions := []metav1.Condition{}
+		for _, condition := range status.Conditions {
+			if condition.ObservedGeneration >= obj.GetGeneration() {
+				conditions = append(conditions, condition)
+			}
+		}
+		return conditions
+	}
+	return nil
+}
+
+// The RouteAccepted condition in GatewayAPI exposure: the parent Gateway has to accept the HTTPRoute, resolve its
+// references, and accept the BackendTLSPolicy
+func getGatewayRouteAcceptedCondition(httpRoute *unstructured.Unstructured, policy *unstructured.Unstructured, dexServer *authv1alpha1.DexServer) metav1.Condition {
+	gateway := fmt.Sprintf("%s/%s", getGatewayNamespace(dexServer), dexServer.Spec.Gateway.Name)
+	checks := []struct {
+		kind          string
+		conditions    []metav1.Condition
+		conditionType string
+	}{
+		{httpRoute.GetKind(), getGatewayParentConditions(httpRoute, "parents", dexServer), "Accepted"},
+		{httpRoute.GetKind(), getGatewayParentConditions(httpRoute, "parents", dexServer), "ResolvedRefs"},
+		{policy.GetKind(), getGatewayParentConditions(policy, "ancestors", dexServer), "Accepted"},
+	}
+	for _, check := range checks {
+		condition := meta.FindStatusCondition(check.conditions, check.conditionType)
+		if condition == nil {
+			return metav1.Condition{
+				Type:    authv1alpha1.DexServerConditionTypeRouteAccepted,
+				Status:  metav1.ConditionUnknown,
+				Reason:  "Pending",
+				Message: fmt.Sprintf("the Gateway %s has not reported the %s condition of the %s yet", gateway, check.conditionType, check.kind),
+			}
+		}
+		if condition.Status != metav1.ConditionTrue {
+			reason := condition.Reason
+			if reason == "" {
+				reason = "NotAccepted"
+			}
+			return metav1.Condition{
+				Type:    authv1alpha1.DexServerConditionTypeRouteAccepted,
+				Status:  metav1.ConditionFalse,
+				Reason:  reason,
+				Message: fmt.Sprintf("%s %s is %s in the Gateway %s: %s", check.kind, check.conditionType, condition.Status, gateway, condition.Message),
+			}
+		}
+	}
+	return metav1.Condition{
+		Type:    authv1alpha1.DexServerConditionTypeRouteAccepted,
+		Status:  metav1.ConditionTrue,
+		Reason:  "Accepted",
+		Message: fmt.Sprintf("the HTTPRoute is accepted by the Gateway %s", gateway),
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright Red Hat
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+)
+
+var _ = Describe("Expose the dex web endpoint of a DexServer through the Gateway API", func() {
+	DexServerName := "dex-server-gateway"
+	DexServerNamespace := "dex-server-gateway-ns"
+	DexServerHost := "dex-server-gateway.example.com"
+
+	getDexServer := func() *authv1alpha1.DexServer {
+		dexServer := &authv1alpha1.DexServer{}
+		Expect(k8sClient.Get(context.TODO(), client.ObjectKey{Name: DexServerName, Namespace: DexServerNamespace}, dexServer)).To(Succeed())
+		return dexServer
+	}
+
+	getGatewayObject := func(gvk schema.GroupVersionKind) (*unstructured.Unstructured, error) {
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(gvk)
+		err := k8sClient.Get(context.TODO(), client.ObjectKey{Name: DexServerName, Namespace: DexServerNamespace}, obj)
+		return obj, err
+	}
+
+	// There is no gateway controller in the test environment, report the conditions of the parent Gateway
+	reportConditions := func(gvk schema.GroupVersionKind, field string, refField string, conditions ...map[string]interface{}) {
+		obj, err := getGatewayObject(gvk)
+		Expect(err).To(BeNil())
+		items := []interface{}{}
+		for _, condition := range conditions {
+			condition["observedGeneration"] = obj.GetGeneration()
+			condition["lastTransitionTime"] = metav1.Now().UTC().Format("2006-01-02T15:04:05Z")
+			items = append(items, condition)
+		}
+		Expect(unstructured.SetNestedSlice(obj.Object, []interface{}{
+			map[string]interface{}{
+				refField: map[string]interface{}{
+					"name":      "public",
+					"namespace": "gateways",
+				},
+				"controllerName": "example.com/gateway-controller",
+				"conditions":     items,
+			},
+		}, "status", field)).To(Succeed())
+		Expect(k8sClient.Status().Update(context.TODO(), obj)).To(Succeed())
+	}
+
+	condition := func(conditionType string, status string, reason string) map[string]interface{} {
+		return map[string]interface{}{
+			"type":    conditionType,
+			"status":  status,
+			"reason":  reason,
+			"message": conditionType + " " + status,
+		}
+	}
+
+	It("should attach an HTTPRoute to the parent Gateway", func() {
+		port := int32(443)
+		// OpenShift publishes its service CA in every namespace, in the ConfigMap created with the DexServer
+		createDexServer(&authv1alpha1.DexServer{
+			ObjectMeta: metav1.ObjectMeta{Name: DexServerName, Namespace: DexServerNamespace},
+			Spec: authv1alpha1.DexServerSpec{
+				Issuer:   "https://" + DexServerHost,
+				Exposure: authv1alpha1.ExposureTypeGatewayAPI,
+				Gateway: &authv1alpha1.GatewaySpec{
+					Name:        "public",
+					Namespace:   "gateways",
+					SectionName: "https",
+					Port:        &port,
+				},
+			},
+		}, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: OPENSHIFT_SERVICE_CA_CONFIGMAP, Namespace: DexServerNamespace},
+			Data:       map[string]string{"service-ca.crt": "service ca"},
+		})
+		reconcileDexServer(DexServerName, DexServerNamespace)
+
+		httpRoute, err := getGatewayObject(httpRouteGVK)
+		Expect(err).To(BeNil())
+		Expect(unstructured.NestedStringSlice(httpRoute.Object, "spec", "hostnames")).To(Equal([]string{DexServerHost}))
+		parentRefs, _, _ := unstructured.NestedSlice(httpRoute.Object, "spec", "parentRefs")
+		Expect(parentRefs).To(HaveLen(1))
+		Expect(parentRefs[0]).To(HaveKeyWithValue("name", "public"))
+		Expect(parentRefs[0]).To(HaveKeyWithValue("namespace", "gateways"))
+		Expect(parentRefs[0]).To(HaveKeyWithValue("sectionName", "https"))
+		Expect(parentRefs[0]).To(HaveKeyWithValue("port", int64(443)))
+
+		policy, err := getGatewayObject(backendTLSPolicyGVK)
+		Expect(err).To(BeNil())
+		Expect(unstructured.NestedString(policy.Object, "spec", "validation", "hostname")).To(Equal("dex-server-gateway.dex-server-gateway-ns.svc"))
+		configMap := &corev1.ConfigMap{}
+		Expect(k8sClient.Get(context.TODO(), client.ObjectKey{Name: DexServerName + CONFIGMAP_WEB_CA_SUFFIX, Namespace: DexServerNamespace}, configMap)).To(Succeed())
+		Expect(configMap.Data).To(HaveKeyWithValue("ca.crt", "service ca"))
+
+		accepted := meta.FindStatusCondition(getDexServer().Status.Conditions, authv1alpha1.DexServerConditionTypeRouteAccepted)
+		Expect(accepted).ToNot(BeNil())
+		Expect(accepted.Status).To(Equal(metav1.ConditionUnknown))
+	})
+	It("should report the HTTPRoute accepted by the parent Gateway", func() {
+		reportConditions(httpRouteGVK, "parents", "parentRef",
+			condition("Accepted", "True", "Accepted"), condition("ResolvedRefs", "True", "ResolvedRefs"))
+		reportConditions(backendTLSPolicyGVK, "ancestors", "ancestorRef", condition("Accepted", "True", "Accepted"))
+		reconcileDexServer(DexServerName, DexServerNamespace)
+
+		dexServer := getDexServer()
+		Expect(meta.IsStatusConditionTrue(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeRouteAccepted)).To(BeTrue())
+		Expect(dexServer.Status.Exposure.Type).To(Equal(authv1alpha1.ExposureTypeGatewayAPI))
+		Expect(dexServer.Status.Exposure.Host).To(Equal(DexServerHost))
+	})
+	It("should report the HTTPRoute rejected by the parent Gateway", func() {
+		reportConditions(httpRouteGVK, "parents", "parentRef",
+			condition("Accepted", "False", "NotAllowedByListeners"), condition("ResolvedRefs", "True", "ResolvedRefs"))
+		reconcileDexServer(DexServerName, DexServerNamespace)
+
+		dexServer := getDexServer()
+		accepted := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeRouteAccepted)
+		Expect(accepted).ToNot(BeNil())
+		Expect(accepted.Status).To(Equal(metav1.ConditionFalse))
+		Expect(accepted.Reason).To(Equal("NotAllowedByListeners"))
+		Expect(dexServer.Status.Exposure.Host).To(BeEmpty())
+	})
+	It("should delete the Gateway API objects when no longer exposed through them", func() {
+		dexServer := getDexServer()
+		dexServer.Spec.Exposure = authv1alpha1.ExposureTypeNone
+		Expect(k8sClient.Update(context.TODO(), dexServer)).To(Succeed())
+		reconcileDexServer(DexServerName, DexServerNamespace)
+
+		for _, gvk := range []schema.GroupVersionKind{httpRouteGVK, backendTLSPolicyGVK} {
+			_, err := getGatewayObject(gvk)
+			Expect(kubeerrors.IsNotFound(err)).To(BeTrue())
+		}
+		err := k8sClient.Get(context.TODO(), client.ObjectKey{Name: DexServerName + CONFIGMAP_WEB_CA_SUFFIX, Namespace: DexServerNamespace}, &corev1.ConfigMap{})
+		Expect(kubeerrors.IsNotFound(err)).To(BeTrue())
+		Expect(meta.FindStatusCondition(getDexServer().Status.Conditions, authv1alpha1.DexServerConditionTypeRouteAccepted)).To(BeNil())
+	})
+})
@@ -0,0 +1,212 @@
+// Copyright Red Hat
+
+package controllers
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+)
+
+const (
+	SECRET_GRPC_CLIENT_PREFIX = "grpc-client-"
+	GRPC_CLIENT_LABEL         = "auth.identitatem.io/grpc-client"
+)
+
+func getGRPCClientSecretName(name string) string {
+	return SECRET_GRPC_CLIENT_PREFIX + name
+}
+
+func getGRPCClients(dexServer *authv1alpha1.DexServer) []authv1alpha1.GRPCClientSpec {
+	if dexServer.Spec.MTLS == nil {
+		return nil
+	}
+	return dexServer.Spec.MTLS.GRPCClients
+}
+
+// Get the secrets of the gRPC clients which are no longer declared in the DexServer, their certificates are revoked
+func (r *DexServerReconciler) getRevokedGRPCClientSecrets(dexServer *authv1alpha1.DexServer, ctx context.Context) ([]corev1.Secret, error) {
+	secrets := &corev1.SecretList{}
+	if err := r.Client.List(ctx, secrets, client.InNamespace(dexServer.Namespace),
+		client.MatchingLabels{"app": dexServer.Name}, client.HasLabels{GRPC_CLIENT_LABEL}); err != nil {
+		return nil, errors.Wrap(err, "error listing grpc client secrets")
+	}
+	declared := map[string]bool{}
+	for _, grpcClient := range getGRPCClients(dexServer) {
+		declared[grpcClient.Name] = true
+	}
+	revoked := []corev1.Secret{}
+	for _, secret := range secrets.Items {
+		if !declared[secret.Labels[GRPC_CLIENT_LABEL]] {
+			revoked = append(revoked, secret)
+		}
+	}
+	return revoked, nil
+}
+
+// Tell apart the revoked gRPC client secrets whose certificate is signed by the provided CA. dex does not read CRLs,
+// and a provided CA is not rotated on revocation, so dex accepts these certificates until the CA is replaced. Their
+// secrets are kept until then, and the other ones are deleted.
+func splitRevokedGRPCClientSecrets(provided *mtlsCA, secrets []corev1.Secret) ([]corev1.Secret, []corev1.Secret) {
+	if provided == nil {
+		return secrets, nil
+	}
+	deleted := []corev1.Secret{}
+	trusted := []corev1.Secret{}
+	for _, secret := range secrets {
+		if block, _ := pem.Decode(secret.Data["tls.crt"]); block != nil {
+			if cert, err := x509.ParseCertificate(block.Bytes); err == nil && cert.CheckSignatureFrom(provided.cert) == nil {
+				trusted = append(trusted, secret)
+				continue
+			}
+		}
+		deleted = append(deleted, secret)
+	}
+	return deleted, trusted
+}
+
+// The GRPCClientsRevoked condition reports the removed gRPC clients whose certificate dex still accepts
+func getGRPCClientsRevokedCondition(trusted []corev1.Secret) metav1.Condition {
+	names := []string{}
+	for _, secret := range trusted {
+		names = append(names, secret.Labels[GRPC_CLIENT_LABEL])
+	}
+	return metav1.Condition{
+		Type:   authv1alpha1.DexServerConditionTypeGRPCClientsRevoked,
+		Status: metav1.ConditionFalse,
+		Reason: "ProvidedCANotReplaced",
+		Message: fmt.Sprintf("dex does not read CRLs and accepts the certificates of the removed grpc clients %s until "+
+			"the CA in the secret referenced by spec.mtls.caSecretRef is replaced", strings.Join(names, ", ")),
+	}
+}
+
+// Add the certificates of the revoked gRPC client secrets to the ones already revoked by the CA. The certificates
+// signed by another CA are left out, they are no longer trusted once it is dropped.
+func revokeGRPCClientCerts(ca *mtlsCA, revoked []pkix.RevokedCertificate, secrets []corev1.Secret) []pkix.RevokedCertificate {
+	serials := map[string]bool{}
+	for _, revokedCert := range revoked {
+		serials[revokedCert.SerialNumber.String()] = true
+	}
+	now := time.Now()
+	for _, secret := range secrets {
+		block, _ := pem.Decode(secret.Data["tls.crt"])
+		if block == nil {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil || cert.CheckSignatureFrom(ca.cert) != nil || serials[cert.SerialNumber.String()] {
+			continue
+		}
+		serials[cert.SerialNumber.String()] = true
+		revoked = append(revoked, pkix.RevokedCertificate{
+			SerialNumber:   cert.SerialNumber,
+			RevocationTime: now,
+		})
+	}
+	return revoked
+}
+
+// Check that the certificate chain of a gRPC client secret is signed by the CA and is not yet to be renewed
+func isGRPCClientCertValid(secret *corev1.Secret, ca *mtlsCA, config *mtlsConfig) bool {
+	if verifyMTLSChain(secret.Data["tls.crt"], secret.Data["tls.key"], ca.pem.Bytes(), x509.ExtKeyUsageClientAuth, "") != nil {
+		return false
+	}
+	block, _ := pem.Decode(secret.Data["tls.crt"])
+	if block == nil {
+		return false
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return false
+	}
+	return !inCertRenewalWindow(cert.NotAfter, config.renewBefore)
+}
+
+// Issue a client certificate to each gRPC client declared in the DexServer, in its own secret with its chain and the
+// trusted CAs. The certificates are reissued when they near expiry or once the CA signing them changes.
+func (r *DexServerReconciler) syncGRPCClientSecrets(dexServer *authv1alpha1.DexServer, ca *mtlsCA, caBundle []byte, config *mtlsConfig, ctx context.Context) error {
+	log := ctrllog.FromContext(ctx)
+	for _, grpcClient := range getGRPCClients(dexServer) {
+		name := getGRPCClientSecretName(grpcClient.Name)
+		secretExists := true
+		secret := &corev1.Secret{}
+		if err := r.Client.Get(ctx, client.ObjectKey{Name: name, Namespace: dexServer.Namespace}, secret); err != nil {
+			if !kubeerrors.IsNotFound(err) {
+				return errors.Wrapf(err, "error getting grpc client secret %s", name)
+			}
+			secretExists = false
+		}
+		spec := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: dexServer.Namespace,
+				Labels: map[string]string{
+					"app":             dexServer.Name,
+					GRPC_CLIENT_LABEL: grpcClient.Name,
+				},
+			},
+			Data: map[string][]byte{
+				"ca.crt":  caBundle,
+				"tls.crt": secret.Data["tls.crt"],
+				"tls.key": secret.Data["tls.key"],
+			},
+		}
+		if !secretExists || !isGRPCClientCertValid(secret, ca, config) {
+			log.Info("issuing grpc client certificate", "name", grpcClient.Name)
+			certPEM, privKeyPEM, err := generateGRPCClientCert(grpcClient.Name, ca, config)
+			if err != nil {
+				return errors.Wrapf(err, "error generating grpc client certificate %s", grpcClient.Name)
+			}
+			spec.Data["tls.crt"] = append(certPEM.Bytes(), ca.pem.Bytes()...)
+			spec.Data["tls.key"] = privKeyPEM.Bytes()
+			if err := verifyMTLSChain(spec.Data["tls.crt"], spec.Data["tls.key"], caBundle, x509.ExtKeyUsageClientAuth, ""); err != nil {
+				return errors.Wrapf(err, "error verifying grpc client certificate %s", grpcClient.Name)
+			}
+		}
+		if err := ctrl.SetControllerReference(dexServer, spec, r.Scheme); err != nil {
+			return err
+		}
+		if !secretExists {
+			if err := r.Client.Create(ctx, spec); err != nil {
+				return errors.Wrapf(err, "error creating grpc client secret %s", name)
+			}
+			continue
+		}
+		if equality.Semantic.DeepEqual(secret.Data, spec.Data) && equality.Semantic.DeepEqual(secret.Labels, spec.Labels) {
+			continue
+		}
+		secret.Labels = spec.Labels
+		secret.Data = spec.Data
+		if err := r.Client.Update(ctx, secret); err != nil {
+			return errors.Wrapf(err, "error updating grpc client secret %s", name)
+		}
+	}
+	return nil
+}
+
+// Delete the secrets of the revoked gRPC clients, once their certificates are in the CRL of the mTLS secret
+func (r *DexServerReconciler) deleteGRPCClientSecrets(secrets []corev1.Secret, ctx context.Context) error {
+	log := ctrllog.FromContext(ctx)
+	for i := range secrets {
+		log.Info("deleting revoked grpc client secret", "name", secrets[i].Name)
+		if err := r.Client.Delete(ctx, &secrets[i]); err != nil && !kubeerrors.IsNotFound(err) {
+			return errors.Wrapf(err, "error deleting grpc client secret %s", secrets[i].Name)
+		}
+	}
+	return nil
+}
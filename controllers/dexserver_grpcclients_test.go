@@ -0,0 +1,124 @@
+// Copyright Red Hat
+
+package controllers
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+)
+
+var _ = Describe("Issue the gRPC client certificates of a DexServer", func() {
+	DexServerName := "dex-server-grpc-clients"
+	DexServerNamespace := "dex-server-grpc-clients-ns"
+
+	getSecret := func(name string) *corev1.Secret {
+		secret := &corev1.Secret{}
+		Expect(k8sClient.Get(context.TODO(), client.ObjectKey{Name: name, Namespace: DexServerNamespace}, secret)).To(Succeed())
+		return secret
+	}
+
+	// There is no deployment controller in the test environment, report the dex deployment as rolled out
+	rollOutDeployment := func() {
+		Eventually(func() error {
+			deployment := &appsv1.Deployment{}
+			if err := k8sClient.Get(context.TODO(), client.ObjectKey{Name: DexServerName, Namespace: DexServerNamespace}, deployment); err != nil {
+				return err
+			}
+			deployment.Status.ObservedGeneration = deployment.Generation
+			deployment.Status.Replicas = 1
+			deployment.Status.UpdatedReplicas = 1
+			deployment.Status.ReadyReplicas = 1
+			deployment.Status.AvailableReplicas = 1
+			return k8sClient.Status().Update(context.TODO(), deployment)
+		}, 30, 1).Should(Succeed())
+	}
+
+	var revokedCert *x509.Certificate
+
+	It("should issue a client certificate to each consumer", func() {
+		createDexServer(&authv1alpha1.DexServer{
+			ObjectMeta: metav1.ObjectMeta{Name: DexServerName, Namespace: DexServerNamespace},
+			Spec: authv1alpha1.DexServerSpec{
+				Issuer: "https://dex-server-grpc-clients.example.com",
+				MTLS: &authv1alpha1.MTLSSpec{
+					GRPCClients: []authv1alpha1.GRPCClientSpec{{Name: "console"}, {Name: "audit"}},
+				},
+			},
+		})
+		reconcileDexServer(DexServerName, DexServerNamespace)
+
+		mtls := getSecret(SECRET_MTLS_NAME)
+		ca := parsePEMCertificate(mtls.Data["ca.crt"])
+		Expect(parsePEMCertificate(mtls.Data["client.crt"]).Subject.CommonName).To(Equal(GRPC_OPERATOR_CLIENT_NAME))
+		for _, name := range []string{"console", "audit"} {
+			secret := getSecret(getGRPCClientSecretName(name))
+			cert := parsePEMCertificate(secret.Data["tls.crt"])
+			Expect(cert.Subject.CommonName).To(Equal(name))
+			Expect(cert.ExtKeyUsage).To(Equal([]x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}))
+			Expect(cert.CheckSignatureFrom(ca)).To(Succeed())
+			Expect(secret.Data["ca.crt"]).To(Equal(mtls.Data["ca.crt"]))
+		}
+		revokedCert = parsePEMCertificate(getSecret(getGRPCClientSecretName("audit")).Data["tls.crt"])
+	})
+	It("should revoke the certificate of a removed consumer", func() {
+		dexServer := reconcileDexServer(DexServerName, DexServerNamespace)
+		previousCA := parsePEMCertificate(getSecret(SECRET_MTLS_NAME).Data["ca.crt"])
+		dexServer.Spec.MTLS.GRPCClients = []authv1alpha1.GRPCClientSpec{{Name: "console"}}
+		Expect(k8sClient.Update(context.TODO(), dexServer)).To(Succeed())
+
+		By("publishing the revoked certificate in the trust bundle", func() {
+			dexServer := reconcileDexServer(DexServerName, DexServerNamespace)
+			Expect(dexServer.Status.MTLS.RotationPhase).To(Equal(authv1alpha1.MTLSRotationPhaseTrustingNewCA))
+			Expect(k8sClient.Get(context.TODO(), client.ObjectKey{Name: getGRPCClientSecretName("audit"), Namespace: DexServerNamespace}, &corev1.Secret{})).ToNot(Succeed())
+
+			mtls := getSecret(SECRET_MTLS_NAME)
+			Expect(mtls.Data["ca.crt"]).To(ContainSubstring("X509 CRL"))
+			block, _ := pem.Decode(mtls.Data["ca.crl"])
+			Expect(block).ToNot(BeNil())
+			crl, err := x509.ParseCRL(block.Bytes)
+			Expect(err).To(BeNil())
+			Expect(previousCA.CheckCRLSignature(crl)).To(Succeed())
+			Expect(crl.TBSCertList.RevokedCertificates).To(HaveLen(1))
+			Expect(crl.TBSCertList.RevokedCertificates[0].SerialNumber).To(Equal(revokedCert.SerialNumber))
+			Expect(getSecret(getGRPCClientSecretName("console")).Data["ca.crt"]).To(Equal(mtls.Data["ca.crt"]))
+		})
+		By("no longer trusting the CA which signed it", func() {
+			rollOutDeployment()
+			Eventually(func() authv1alpha1.MTLSRotationPhase {
+				return reconcileDexServer(DexServerName, DexServerNamespace).Status.MTLS.RotationPhase
+			}, 30, 1).Should(Equal(authv1alpha1.MTLSRotationPhaseReissuingCerts))
+			// the previous CA is still trusted, and so is its CRL
+			mtls := getSecret(SECRET_MTLS_NAME)
+			Expect(parsePEMCertificates(getCertificatesPEM(mtls.Data["ca.crt"]))).To(HaveLen(2))
+			block, _ := pem.Decode(mtls.Data["ca.crl"])
+			Expect(block).ToNot(BeNil())
+			crl, err := x509.ParseCRL(block.Bytes)
+			Expect(err).To(BeNil())
+			Expect(previousCA.CheckCRLSignature(crl)).To(Succeed())
+			Expect(mtls.Data["ca.crt"]).To(ContainSubstring("X509 CRL"))
+
+			rollOutDeployment()
+			Eventually(func() authv1alpha1.MTLSRotationPhase {
+				return reconcileDexServer(DexServerName, DexServerNamespace).Status.MTLS.RotationPhase
+			}, 30, 1).Should(Equal(authv1alpha1.MTLSRotationPhaseStable))
+
+			mtls = getSecret(SECRET_MTLS_NAME)
+			Expect(mtls.Data).ToNot(HaveKey("ca.crl"))
+			cas := parsePEMCertificates(mtls.Data["ca.crt"])
+			Expect(cas).To(HaveLen(1))
+			Expect(revokedCert.CheckSignatureFrom(cas[0])).ToNot(Succeed())
+			console := parsePEMCertificate(getSecret(getGRPCClientSecretName("console")).Data["tls.crt"])
+			Expect(console.CheckSignatureFrom(cas[0])).To(Succeed())
+		})
+	})
+})
@@ -0,0 +1,203 @@
+// Copyright Red Hat
+
+package controllers
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+)
+
+// The annotations of the Ingress set from the DexServer, so that the ones removed from it are removed from the Ingress
+// while the ones set by the ingress controllers are kept
+const MANAGED_ANNOTATIONS_ANNOTATION = "auth.identitatem.io/managed-annotations"
+
+// The path dex serves its endpoints under, the one of the issuer. Defaults to /.
+func getIssuerPath(dexServer *authv1alpha1.DexServer) string {
+	u, err := url.Parse(dexServer.Spec.Issuer)
+	if err != nil || strings.TrimSuffix(u.Path, "/") == "" {
+		return "/"
+	}
+	return strings.TrimSuffix(u.Path, "/")
+}
+
+// The hosts presenting the default TLS of the Ingress: the host of the issuer, then the additional hosts without a
+// certificate of their own
+func getIngressDefaultTLSHosts(dexServer *authv1alpha1.DexServer, issuerHost string) []string {
+	hosts := []string{issuerHost}
+	for _, host := range getAdditionalHosts(dexServer) {
+		if host.CertificateRef.Name == "" {
+			hosts = append(hosts, host.Host)
+		}
+	}
+	return hosts
+}
+
+// Define the Ingress routing the hosts of the DexServer to the dex web endpoint
+func (r *DexServerReconciler) defineIngress(dexServer *authv1alpha1.DexServer) (*networkingv1.Ingress, error) {
+	u, err := url.Parse(dexServer.Spec.Issuer)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing issuer")
+	}
+	if u.Hostname() == "" {
+		return nil, errors.Errorf("issuer %q has no host to route", dexServer.Spec.Issuer)
+	}
+	spec := dexServer.Spec.Ingress
+	if spec == nil {
+		spec = &authv1alpha1.IngressSpec{}
+	}
+
+	annotations := map[string]string{
+		// OpenShift turns the Ingress into a Route reencrypting to dex
+		"route.openshift.io/termination": "reencrypt",
+	}
+	for key, value := range spec.Annotations {
+		annotations[key] = value
+	}
+
+	pathPrefix := spec.PathPrefix
+	if pathPrefix == "" {
+		pathPrefix = getIssuerPath(dexServer)
+	}
+	pathType := networkingv1.PathTypePrefix
+	ruleHosts := []string{u.Hostname()}
+	for _, host := range getAdditionalHosts(dexServer) {
+		ruleHosts = append(ruleHosts, host.Host)
+	}
+	rules := []networkingv1.IngressRule{}
+	for _, host := range ruleHosts {
+		rules = append(rules, networkingv1.IngressRule{
+			Host: host,
+			IngressRuleValue: networkingv1.IngressRuleValue{
+				HTTP: &networkingv1.HTTPIngressRuleValue{
+					Paths: []networkingv1.HTTPIngressPath{{
+						Path:     pathPrefix,
+						PathType: &pathType,
+						Backend: networkingv1.IngressBackend{
+							Service: &networkingv1.IngressServiceBackend{
+								Name: dexServer.Name,
+								Port: networkingv1.ServiceBackendPort{
+									Number: WEB_SERVICE_PORT,
+								},
+							},
+						},
+					}},
+				},
+			},
+		})
+	}
+
+	// copied, the TLS of the additional hosts are appended to it
+	tls := append([]networkingv1.IngressTLS(nil), spec.TLS...)
+	if len(tls) == 0 && dexServer.Spec.IngressCertificateRef.Name != "" {
+		tls = []networkingv1.IngressTLS{{
+			Hosts:      getIngressDefaultTLSHosts(dexServer, u.Hostname()),
+			SecretName: dexServer.Spec.IngressCertificateRef.Name,
+		}}
+	}
+	// the additional hosts present certificates of their own
+	for _, host := range getAdditionalHosts(dexServer) {
+		if host.CertificateRef.Name != "" {
+			tls = append(tls, networkingv1.IngressTLS{
+				Hosts:      []string{host.Host},
+				SecretName: host.CertificateRef.Name,
+			})
+		}
+	}
+
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      dexServer.Name,
+			Namespace: dexServer.Namespace,
+			Labels: map[string]string{
+				"app":                 dexServer.Name,
+				"dexconfig_name":      dexServer.Name,
+				"dexconfig_namespace": dexServer.Namespace,
+			},
+			Annotations: annotations,
+		},
+		Spec: networkingv1.IngressSpec{
+			IngressClassName: spec.IngressClassName,
+			TLS:              tls,
+			Rules:            rules,
+		},
+	}
+	if err := ctrl.SetControllerReference(dexServer, ingress, r.Scheme); err != nil {
+		return nil, err
+	}
+	return ingress, nil
+}
+
+// Set the annotations defined for the Ingress, and remove the ones it no longer defines
+func mergeIngressAnnotations(current map[string]string, desired map[string]string) map[string]string {
+	annotations := map[string]string{}
+	for key, value := range current {
+		annotations[key] = value
+	}
+	for _, key := range strings.Split(current[MANAGED_ANNOTATIONS_ANNOTATION], ",") {
+		if _, ok := desired[key]; !ok {
+			delete(annotations, key)
+		}
+	}
+	keys := []string{}
+	for key, value := range desired {
+		annotations[key] = value
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	annotations[MANAGED_ANNOTATIONS_ANNOTATION] = strings.Join(keys, ",")
+	return annotations
+}
+
+// Create or update the Ingress of the dex web endpoint
+func (r *DexServerReconciler) syncIngress(dexServer *authv1alpha1.DexServer, ctx context.Context) error {
+	log := ctrllog.FromContext(ctx)
+	desired, err := r.defineIngress(dexServer)
+	if err != nil {
+		return err
+	}
+	log.Info("syncIngress", "Host", desired.Spec.Rules[0].Host)
+
+	ingress := &networkingv1.Ingress{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Name: dexServer.Name, Namespace: dexServer.Namespace}, ingress); err != nil {
+		if !kubeerrors.IsNotFound(err) {
+			return errors.Wrap(err, "error getting ingress")
+		}
+		desired.Annotations = mergeIngressAnnotations(nil, desired.Annotations)
+		log.Info("Creating a new Ingress", "Ingress.Namespace", desired.Namespace, "Ingress.Name", desired.Name)
+		if err := r.Client.Create(ctx, desired); err != nil {
+			return errors.Wrap(err, "error creating ingress")
+		}
+		return nil
+	}
+
+	// the class set by the cluster on creation is kept when the DexServer does not set one
+	if desired.Spec.IngressClassName == nil {
+		desired.Spec.IngressClassName = ingress.Spec.IngressClassName
+	}
+	annotations := mergeIngressAnnotations(ingress.Annotations, desired.Annotations)
+	if !equality.Semantic.DeepEqual(ingress.Spec, desired.Spec) ||
+		!equality.Semantic.DeepEqual(ingress.Labels, desired.Labels) ||
+		!equality.Semantic.DeepEqual(ingress.Annotations, annotations) {
+		log.Info("Updating Ingress", "Ingress.Namespace", ingress.Namespace, "Ingress.Name", ingress.Name)
+		ingress.Labels = desired.Labels
+		ingress.Annotations = annotations
+		ingress.Spec = desired.Spec
+		if err := r.Client.Update(ctx, ingress); err != nil {
+			return errors.Wrap(err, "error updating ingress")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+// Copyright Red Hat
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+)
+
+var _ = Describe("Customize the Ingress of a DexServer", func() {
+	DexServerName := "dex-server-ingress"
+	DexServerNamespace := "dex-server-ingress-ns"
+
+	getIngress := func() *networkingv1.Ingress {
+		ingress := &networkingv1.Ingress{}
+		Expect(k8sClient.Get(context.TODO(), client.ObjectKey{Name: DexServerName, Namespace: DexServerNamespace}, ingress)).To(Succeed())
+		return ingress
+	}
+
+	It("should route the path of the issuer on every host", func() {
+		ingressClassName := "public"
+		createDexServer(&authv1alpha1.DexServer{
+			ObjectMeta: metav1.ObjectMeta{Name: DexServerName, Namespace: DexServerNamespace},
+			Spec: authv1alpha1.DexServerSpec{
+				Issuer:                "https://sso.example.com/dex",
+				IngressCertificateRef: corev1.LocalObjectReference{Name: "sso-cert"},
+				Ingress: &authv1alpha1.IngressSpec{
+					IngressClassName: &ingressClassName,
+					Annotations: map[string]string{
+						"nginx.ingress.kubernetes.io/limit-rps":          "10",
+						"nginx.ingress.kubernetes.io/proxy-read-timeout": "30",
+					},
+					ExtraHosts: []string{"login.example.com"},
+				},
+			},
+		})
+		reconcileDexServer(DexServerName, DexServerNamespace)
+
+		ingress := getIngress()
+		Expect(ingress.Spec.IngressClassName).To(Equal(&ingressClassName))
+		Expect(ingress.Annotations).To(HaveKeyWithValue("nginx.ingress.kubernetes.io/limit-rps", "10"))
+		Expect(ingress.Annotations).To(HaveKeyWithValue("route.openshift.io/termination", "reencrypt"))
+		Expect(ingress.Spec.Rules).To(HaveLen(2))
+		for i, host := range []string{"sso.example.com", "login.example.com"} {
+			Expect(ingress.Spec.Rules[i].Host).To(Equal(host))
+			Expect(ingress.Spec.Rules[i].HTTP.Paths).To(HaveLen(1))
+			Expect(ingress.Spec.Rules[i].HTTP.Paths[0].Path).To(Equal("/dex"))
+		}
+		Expect(ingress.Spec.TLS).To(Equal([]networkingv1.IngressTLS{{
+			Hosts:      []string{"sso.example.com", "login.example.com"},
+			SecretName: "sso-cert",
+		}}))
+
+		deployment := &appsv1.Deployment{}
+		Expect(k8sClient.Get(context.TODO(), client.ObjectKey{Name: DexServerName, Namespace: DexServerNamespace}, deployment)).To(Succeed())
+		Expect(deployment.Spec.Template.Spec.Containers[0].ReadinessProbe.HTTPGet.Path).To(Equal("/dex/healthz"))
+	})
+	It("should remove the annotations removed from the DexServer", func() {
+		// an annotation set by the ingress controller
+		ingress := getIngress()
+		ingress.Annotations["ingress.kubernetes.io/backends"] = "{}"
+		Expect(k8sClient.Update(context.TODO(), ingress)).To(Succeed())
+
+		dexServer := &authv1alpha1.DexServer{}
+		Expect(k8sClient.Get(context.TODO(), client.ObjectKey{Name: DexServerName, Namespace: DexServerNamespace}, dexServer)).To(Succeed())
+		delete(dexServer.Spec.Ingress.Annotations, "nginx.ingress.kubernetes.io/limit-rps")
+		dexServer.Spec.Ingress.PathPrefix = "/"
+		dexServer.Spec.Ingress.TLS = []networkingv1.IngressTLS{{Hosts: []string{"sso.example.com"}, SecretName: "sso-only-cert"}}
+		Expect(k8sClient.Update(context.TODO(), dexServer)).To(Succeed())
+		reconcileDexServer(DexServerName, DexServerNamespace)
+
+		ingress = getIngress()
+		Expect(ingress.Annotations).ToNot(HaveKey("nginx.ingress.kubernetes.io/limit-rps"))
+		Expect(ingress.Annotations).To(HaveKeyWithValue("nginx.ingress.kubernetes.io/proxy-read-timeout", "30"))
+		Expect(ingress.Annotations).To(HaveKeyWithValue("ingress.kubernetes.io/backends", "{}"))
+		Expect(ingress.Spec.Rules[0].HTTP.Paths[0].Path).To(Equal("/"))
+		Expect(ingress.Spec.TLS).To(HaveLen(1))
+		Expect(ingress.Spec.TLS[0].SecretName).To(Equal("sso-only-cert"))
+	})
+})
@@ -0,0 +1,279 @@
+// Copyright Red Hat
+
+package controllers
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+)
+
+// The operator issues the serving certificate of the dex web endpoint when neither the OpenShift service CA nor
+// cert-manager does
+func (r *DexServerReconciler) isWebTLSSelfSigned(dexServer *authv1alpha1.DexServer) bool {
+	return !isCertManagerIssued(dexServer) && r.Platform != PlatformOpenShift
+}
+
+// The names of the dex web endpoint: the http service, and the host of the issuer
+func getWebDNSNames(dexServer *authv1alpha1.DexServer) []string {
+	dnsNames := []string{
+		fmt.Sprintf("%s.%s.svc", dexServer.Name, dexServer.Namespace),
+		fmt.Sprintf("%s.%s.svc.cluster.local", dexServer.Name, dexServer.Namespace),
+	}
+	if u, err := url.Parse(dexServer.Spec.Issuer); err == nil && u.Hostname() != "" {
+		dnsNames = append(dnsNames, u.Hostname())
+	}
+	// the additional hosts reach dex through passthrough Routes too
+	for _, host := range getAdditionalHosts(dexServer) {
+		dnsNames = append(dnsNames, host.Host)
+	}
+	return dnsNames
+}
+
+// The common name of the CA signing the serving certificate of the dex web endpoint
+func getWebCACommonName(dexServer *authv1alpha1.DexServer) string {
+	return fmt.Sprintf("%s.%s.svc web CA", dexServer.Name, dexServer.Namespace)
+}
+
+// Check that the serving certificate of the web TLS secret is signed by the CA, covers the names of the dex web
+// endpoint and is not yet to be renewed
+func isWebTLSCertValid(secret *corev1.Secret, ca *mtlsCA, dnsNames []string, config *mtlsConfig) bool {
+	for _, dnsName := range dnsNames {
+		if verifyMTLSChain(secret.Data["tls.crt"], secret.Data["tls.key"], ca.pem.Bytes(), x509.ExtKeyUsageServerAuth, dnsName) != nil {
+			return false
+		}
+	}
+	block, _ := pem.Decode(secret.Data["tls.crt"])
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return false
+	}
+	return !inCertRenewalWindow(cert.NotAfter, config.renewBefore)
+}
+
+// Check that the Gateway in front of dex is handed the trusted web CAs, through the ConfigMap referenced by the
+// BackendTLSPolicy. The other exposures are not handed the CA by the operator.
+func (r *DexServerReconciler) isWebCAPublished(dexServer *authv1alpha1.DexServer, caBundle []byte, ctx context.Context) (bool, error) {
+	if getExposure(dexServer) != authv1alpha1.ExposureTypeGatewayAPI {
+		return true, nil
+	}
+	configMap := &corev1.ConfigMap{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Name: dexServer.Name + CONFIGMAP_WEB_CA_SUFFIX, Namespace: dexServer.Namespace}, configMap); err != nil {
+		if kubeerrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, errors.Wrap(err, "error getting web ca configmap")
+	}
+	return configMap.Data["ca.crt"] == string(caBundle), nil
+}
+
+// Check that every pod of the dex deployment serves the current certificate of the web TLS secret
+func (r *DexServerReconciler) isWebTLSSecretRolledOut(dexServer *authv1alpha1.DexServer, ctx context.Context) (bool, error) {
+	deployment := &appsv1.Deployment{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Name: dexServer.Name, Namespace: dexServer.Namespace}, deployment); err != nil {
+		if kubeerrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, errors.Wrap(err, "error getting dex server deployment")
+	}
+	webTLSHash, err := r.getWebTLSHash(dexServer, ctx)
+	if err != nil {
+		return false, errors.Wrap(err, "error getting web tls secret")
+	}
+	if deployment.Spec.Template.Annotations["auth.identitatem.io/webTlsHash"] != webTLSHash {
+		return false, nil
+	}
+	return isDeploymentRolledOut(deployment), nil
+}
+
+// Check whether the web CA issued by the operator is being replaced
+func (r *DexServerReconciler) isWebCARotating(dexServer *authv1alpha1.DexServer, ctx context.Context) (bool, error) {
+	if !r.isWebTLSSelfSigned(dexServer) {
+		return false, nil
+	}
+	secret := &corev1.Secret{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Name: dexServer.Name + SECRET_WEB_TLS_SUFFIX, Namespace: dexServer.Namespace}, secret); err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+	phase := authv1alpha1.MTLSRotationPhase(secret.Annotations[MTLS_CA_ROTATION_ANNOTATION])
+	return phase != "" && phase != authv1alpha1.MTLSRotationPhaseStable, nil
+}
+
+// On clusters without the OpenShift service CA, issue the serving certificate of the dex web endpoint to the
+// <name>-tls-secret mounted by dex, from a CA kept in the same secret. The certificate takes its lifetime and key
+// algorithm from spec.mtls, and is renewed like the gRPC ones. The Routes and the Gateway verifying dex trust the
+// ca.crt of the secret, so the CA is replaced in the stages of the gRPC CA: the new CA is published along with the
+// previous one, then signs the certificate, and the previous CA is dropped once dex serves the new certificate.
+func (r *DexServerReconciler) manageWebTLSSecret(dexServer *authv1alpha1.DexServer, ctx context.Context) error {
+	log := ctrllog.FromContext(ctx)
+	if !r.isWebTLSSelfSigned(dexServer) {
+		return nil
+	}
+	config, err := getMTLSConfig(dexServer)
+	if err != nil {
+		return err
+	}
+	name := dexServer.Name + SECRET_WEB_TLS_SUFFIX
+	secretExists := true
+	secret := &corev1.Secret{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Name: name, Namespace: dexServer.Namespace}, secret); err != nil {
+		if !kubeerrors.IsNotFound(err) {
+			return errors.Wrap(err, "error getting web tls secret")
+		}
+		secretExists = false
+	}
+
+	phase := authv1alpha1.MTLSRotationPhaseStable
+	var ca, nextCA *mtlsCA
+	var caBundle []byte
+	if secretExists {
+		caBundle = secret.Data["ca.crt"]
+		if ca, err = parseMTLSCA(caBundle, secret.Data["ca.key"]); err != nil {
+			log.Error(err, "web tls ca could not be parsed")
+			ca = nil
+		} else if ca.cert.NotAfter.Before(time.Now()) {
+			log.Info("web tls ca has expired")
+			ca = nil
+		}
+		if p := authv1alpha1.MTLSRotationPhase(secret.Annotations[MTLS_CA_ROTATION_ANNOTATION]); p != "" {
+			phase = p
+		}
+		if phase == authv1alpha1.MTLSRotationPhaseTrustingNewCA {
+			if nextCA, err = parseMTLSCA(caBundle, secret.Data["next-ca.key"]); err != nil {
+				log.Error(err, "next web tls ca could not be parsed")
+				nextCA = nil
+				phase = authv1alpha1.MTLSRotationPhaseStable
+			}
+		}
+	}
+	renew := false
+	switch {
+	case ca == nil:
+		// nothing is trusted yet, or no longer, there is no certificate to keep serving
+		log.Info("generating the web tls ca")
+		if ca, err = generateMTLSCA(getWebCACommonName(dexServer), config); err != nil {
+			return errors.Wrap(err, "error generating web tls ca")
+		}
+		caBundle = ca.pem.Bytes()
+		nextCA = nil
+		phase = authv1alpha1.MTLSRotationPhaseStable
+		renew = true
+	case phase == authv1alpha1.MTLSRotationPhaseStable && !ca.isValidFor(config),
+		phase == authv1alpha1.MTLSRotationPhaseTrustingNewCA && !nextCA.isValidFor(config):
+		log.Info("web tls ca is nearing expiration or has another key algorithm, publishing a new ca")
+		if nextCA, err = generateMTLSCA(getWebCACommonName(dexServer), config); err != nil {
+			return errors.Wrap(err, "error generating web tls ca")
+		}
+		caBundle = append(append([]byte{}, ca.pem.Bytes()...), nextCA.pem.Bytes()...)
+		phase = authv1alpha1.MTLSRotationPhaseTrustingNewCA
+	case phase == authv1alpha1.MTLSRotationPhaseTrustingNewCA:
+		published, err := r.isWebCAPublished(dexServer, caBundle, ctx)
+		if err != nil {
+			return err
+		}
+		if !published {
+			log.V(1).Info("waiting for the new web tls ca to be published", "phase", phase)
+		} else {
+			log.Info("new web tls ca is published, signing the certificate with it")
+			ca, nextCA = nextCA, nil
+			phase = authv1alpha1.MTLSRotationPhaseReissuingCerts
+			renew = true
+		}
+	case phase == authv1alpha1.MTLSRotationPhaseReissuingCerts:
+		rolledOut, err := r.isWebTLSSecretRolledOut(dexServer, ctx)
+		if err != nil {
+			return err
+		}
+		if !rolledOut {
+			log.V(1).Info("waiting for the dex deployment to roll out the web tls certificate", "phase", phase)
+		} else {
+			log.Info("certificate signed by the new web tls ca is served by dex, dropping the previous ca")
+			caBundle = ca.pem.Bytes()
+			phase = authv1alpha1.MTLSRotationPhaseStable
+		}
+	}
+	dnsNames := getWebDNSNames(dexServer)
+
+	spec := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: dexServer.Namespace,
+			Labels: map[string]string{
+				"app": dexServer.Name,
+			},
+			Annotations: map[string]string{
+				MTLS_CA_ROTATION_ANNOTATION: string(phase),
+			},
+		},
+		Type: corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			"ca.crt":  caBundle,
+			"ca.key":  ca.privKeyPEM.Bytes(),
+			"tls.crt": secret.Data["tls.crt"],
+			"tls.key": secret.Data["tls.key"],
+		},
+	}
+	if nextCA != nil {
+		spec.Data["next-ca.key"] = nextCA.privKeyPEM.Bytes()
+	}
+	if renew || !secretExists || !isWebTLSCertValid(secret, ca, dnsNames, config) {
+		log.Info("issuing the web tls certificate", "dnsNames", dnsNames)
+		certPEM, privKeyPEM, err := generateWebTLSCert(dnsNames, ca, config)
+		if err != nil {
+			return errors.Wrap(err, "error generating web tls certificate")
+		}
+		spec.Data["tls.crt"] = append(certPEM.Bytes(), ca.pem.Bytes()...)
+		spec.Data["tls.key"] = privKeyPEM.Bytes()
+		for _, dnsName := range dnsNames {
+			if err := verifyMTLSChain(spec.Data["tls.crt"], spec.Data["tls.key"], ca.pem.Bytes(), x509.ExtKeyUsageServerAuth, dnsName); err != nil {
+				return errors.Wrap(err, "error verifying web tls certificate")
+			}
+		}
+	}
+	if err := ctrl.SetControllerReference(dexServer, spec, r.Scheme); err != nil {
+		return err
+	}
+
+	switch {
+	case !secretExists:
+		log.Info("Creating a new web TLS Secret", "Secret.Namespace", spec.Namespace, "Secret.Name", spec.Name)
+		if err := r.Client.Create(ctx, spec); err != nil {
+			return errors.Wrap(err, "error creating web tls secret")
+		}
+	case secret.Type != corev1.SecretTypeTLS:
+		// the type of a secret can not be updated, a secret left by another issuer is replaced
+		log.Info("Replacing the web TLS Secret", "Secret.Namespace", spec.Namespace, "Secret.Name", spec.Name)
+		if err := r.Client.Delete(ctx, secret); err != nil && !kubeerrors.IsNotFound(err) {
+			return errors.Wrap(err, "error deleting web tls secret")
+		}
+		if err := r.Client.Create(ctx, spec); err != nil {
+			return errors.Wrap(err, "error creating web tls secret")
+		}
+	case !equality.Semantic.DeepEqual(secret.Data, spec.Data) || secret.Annotations[MTLS_CA_ROTATION_ANNOTATION] != string(phase):
+		log.Info("Updating web TLS Secret", "Secret.Namespace", spec.Namespace, "Secret.Name", spec.Name, "phase", phase)
+		secret.Data = spec.Data
+		if secret.Annotations == nil {
+			secret.Annotations = map[string]string{}
+		}
+		secret.Annotations[MTLS_CA_ROTATION_ANNOTATION] = string(phase)
+		if err := r.Client.Update(ctx, secret); err != nil {
+			return errors.Wrap(err, "error updating web tls secret")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+// Copyright Red Hat
+
+package controllers
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+)
+
+var _ = Describe("Issue the web TLS certificate of a DexServer on Kubernetes", func() {
+	DexServerName := "dex-server-web-tls"
+	DexServerNamespace := "dex-server-web-tls-ns"
+
+	// The manager reconciles the DexServers as on OpenShift. The web TLS secret is managed by a reconciler of its own
+	// on Kubernetes, rather than by switching the platform of the one the manager runs.
+	var r *DexServerReconciler
+
+	BeforeEach(func() {
+		r = &DexServerReconciler{
+			Client:   k8sClient,
+			Scheme:   scheme.Scheme,
+			Platform: PlatformKubernetes,
+		}
+	})
+
+	getDexServer := func() *authv1alpha1.DexServer {
+		dexServer := &authv1alpha1.DexServer{}
+		Expect(k8sClient.Get(context.TODO(), client.ObjectKey{Name: DexServerName, Namespace: DexServerNamespace}, dexServer)).To(Succeed())
+		return dexServer
+	}
+
+	getWebTLSSecret := func() *corev1.Secret {
+		secret := &corev1.Secret{}
+		Expect(k8sClient.Get(context.TODO(), client.ObjectKey{Name: DexServerName + SECRET_WEB_TLS_SUFFIX, Namespace: DexServerNamespace}, secret)).To(Succeed())
+		return secret
+	}
+
+	It("should issue the serving certificate instead of the OpenShift service CA", func() {
+		createDexServer(&authv1alpha1.DexServer{
+			ObjectMeta: metav1.ObjectMeta{Name: DexServerName, Namespace: DexServerNamespace},
+			Spec: authv1alpha1.DexServerSpec{
+				Issuer: "https://dex-server-web-tls.example.com",
+			},
+		})
+		dexServer := getDexServer()
+		Expect(r.isWebTLSSelfSigned(dexServer)).To(BeTrue())
+		Expect(r.manageWebTLSSecret(dexServer, context.TODO())).To(Succeed())
+
+		secret := getWebTLSSecret()
+		Expect(secret.Type).To(Equal(corev1.SecretTypeTLS))
+		for _, dnsName := range []string{"dex-server-web-tls.example.com", "dex-server-web-tls.dex-server-web-tls-ns.svc"} {
+			Expect(verifyMTLSChain(secret.Data["tls.crt"], secret.Data["tls.key"], secret.Data["ca.crt"], x509.ExtKeyUsageServerAuth, dnsName)).To(Succeed())
+		}
+
+		By("naming the web CA after the dex web endpoint rather than the gRPC one")
+		block, _ := pem.Decode(secret.Data["ca.crt"])
+		Expect(block).ToNot(BeNil())
+		ca, err := x509.ParseCertificate(block.Bytes)
+		Expect(err).To(BeNil())
+		Expect(ca.Subject.CommonName).To(Equal("dex-server-web-tls.dex-server-web-tls-ns.svc web CA"))
+
+		By("hashing the web TLS secret into the dex deployment")
+		webTLSHash, err := r.getWebTLSHash(dexServer, context.TODO())
+		Expect(err).To(BeNil())
+		Expect(webTLSHash).ToNot(BeEmpty())
+	})
+	It("should reissue the serving certificate when the issuer host changes", func() {
+		previous := getWebTLSSecret()
+
+		dexServer := getDexServer()
+		dexServer.Spec.Issuer = "https://dex.example.com"
+		Expect(k8sClient.Update(context.TODO(), dexServer)).To(Succeed())
+		Expect(r.manageWebTLSSecret(dexServer, context.TODO())).To(Succeed())
+
+		secret := getWebTLSSecret()
+		Expect(secret.Data["ca.crt"]).To(Equal(previous.Data["ca.crt"]))
+		Expect(secret.Data["tls.crt"]).ToNot(Equal(previous.Data["tls.crt"]))
+		Expect(verifyMTLSChain(secret.Data["tls.crt"], secret.Data["tls.key"], secret.Data["ca.crt"], x509.ExtKeyUsageServerAuth, "dex.example.com")).To(Succeed())
+	})
+	It("should publish the previous web CA until dex serves the certificate of the new one", func() {
+		previous := getWebTLSSecret()
+		previousCA := parsePEMCertificates(previous.Data["ca.crt"])
+		Expect(previousCA).To(HaveLen(1))
+
+		By("publishing the new CA along with the previous one")
+		dexServer := getDexServer()
+		dexServer.Spec.MTLS = &authv1alpha1.MTLSSpec{KeyAlgorithm: authv1alpha1.KeyAlgorithmECDSAP256}
+		Expect(k8sClient.Update(context.TODO(), dexServer)).To(Succeed())
+		Expect(r.manageWebTLSSecret(dexServer, context.TODO())).To(Succeed())
+		secret := getWebTLSSecret()
+		Expect(secret.Annotations).To(HaveKeyWithValue(MTLS_CA_ROTATION_ANNOTATION, string(authv1alpha1.MTLSRotationPhaseTrustingNewCA)))
+		Expect(parsePEMCertificates(secret.Data["ca.crt"])).To(HaveLen(2))
+		Expect(secret.Data["tls.crt"]).To(Equal(previous.Data["tls.crt"]))
+		destinationCA, err := r.getRouteDestinationCA(dexServer, context.TODO())
+		Expect(err).To(BeNil())
+		Expect(destinationCA).To(Equal(string(secret.Data["ca.crt"])))
+		rotating, err := r.isWebCARotating(dexServer, context.TODO())
+		Expect(err).To(BeNil())
+		Expect(rotating).To(BeTrue())
+
+		By("signing the certificate with the new CA, still publishing the previous one")
+		Expect(r.manageWebTLSSecret(dexServer, context.TODO())).To(Succeed())
+		secret = getWebTLSSecret()
+		Expect(secret.Annotations).To(HaveKeyWithValue(MTLS_CA_ROTATION_ANNOTATION, string(authv1alpha1.MTLSRotationPhaseReissuingCerts)))
+		Expect(secret.Data["tls.crt"]).ToNot(Equal(previous.Data["tls.crt"]))
+		cas := parsePEMCertificates(secret.Data["ca.crt"])
+		Expect(cas).To(HaveLen(2))
+		Expect(cas[0].Equal(previousCA[0])).To(BeTrue())
+		Expect(parsePEMCertificates(secret.Data["tls.crt"])[0].CheckSignatureFrom(cas[1])).To(Succeed())
+
+		By("keeping the previous CA while dex does not serve the new certificate")
+		Expect(r.manageWebTLSSecret(dexServer, context.TODO())).To(Succeed())
+		Expect(getWebTLSSecret().Data["ca.crt"]).To(Equal(secret.Data["ca.crt"]))
+	})
+	It("should leave the serving certificate to the OpenShift service CA", func() {
+		Expect(rDexServer.isWebTLSSelfSigned(getDexServer())).To(BeFalse())
+	})
+})
@@ -0,0 +1,270 @@
+// Copyright Red Hat
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+	dexapi "github.com/identitatem/dex-operator/controllers/dex"
+)
+
+// DexSessionRevocationReconciler reconciles a DexSessionRevocation object
+type DexSessionRevocationReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	// DexConnections are the connections to the dex servers, shared by all reconciles
+	DexConnections *dexapi.ConnectionManager
+}
+
+//+kubebuilder:rbac:groups=auth.identitatem.io,resources=dexsessionrevocations,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=auth.identitatem.io,resources=dexsessionrevocations/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=auth.identitatem.io,resources=dexsessionrevocations/finalizers,verbs=update
+//+kubebuilder:rbac:groups=dex.coreos.com,resources=refreshtokens,verbs=get;list
+
+// Reconcile revokes the refresh tokens dex holds for the user of a DexSessionRevocation, once. A completed
+// DexSessionRevocation is left untouched, create a new one to revoke the sessions opened since.
+func (r *DexSessionRevocationReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := ctrllog.FromContext(ctx)
+	log.V(1).Info("Reconciling...")
+
+	revocation := &authv1alpha1.DexSessionRevocation{}
+	if err := r.Get(ctx, req.NamespacedName, revocation); err != nil {
+		log.Error(err, "failed to fetch DexSessionRevocation instance")
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	if meta.IsStatusConditionTrue(revocation.Status.Conditions, authv1alpha1.DexSessionRevocationConditionTypeComplete) {
+		return ctrl.Result{}, nil
+	}
+
+	if err := validateDexSessionRevocation(revocation); err != nil {
+		cond := metav1.Condition{
+			Type:    authv1alpha1.DexSessionRevocationConditionTypeComplete,
+			Status:  metav1.ConditionFalse,
+			Reason:  "InvalidSpec",
+			Message: err.Error(),
+		}
+		// Wait for the DexSessionRevocation to be fixed
+		return ctrl.Result{}, r.updateDexSessionRevocationStatusConditions(revocation, ctx, cond)
+	}
+
+	dexServerRef := getDexServerRef(revocation)
+	dexServer := &authv1alpha1.DexServer{}
+	if err := r.Get(ctx, dexServerRef, dexServer); err != nil {
+		if !kubeerrors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+		cond := metav1.Condition{
+			Type:    authv1alpha1.DexSessionRevocationConditionTypeComplete,
+			Status:  metav1.ConditionFalse,
+			Reason:  "DexServerNotFound",
+			Message: fmt.Sprintf("waiting for DexServer %s", dexServerRef.String()),
+		}
+		if err := r.updateDexSessionRevocationStatusConditions(revocation, ctx, cond); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+	}
+
+	mTLSSecret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: SECRET_MTLS_NAME, Namespace: dexServer.Namespace}, mTLSSecret); err != nil {
+		if !kubeerrors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+		cond := metav1.Condition{
+			Type:    authv1alpha1.DexSessionRevocationConditionTypeComplete,
+			Status:  metav1.ConditionFalse,
+			Reason:  "MTLSSecretNotFound",
+			Message: "waiting for dex server mtls certificates",
+		}
+		if err := r.updateDexSessionRevocationStatusConditions(revocation, ctx, cond); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{RequeueAfter: 5 * time.Second}, nil
+	}
+
+	dexApiClient, release, err := r.DexConnections.Get(ctx, newDexAPIOptions(dexServer.Namespace, mTLSSecret))
+	if err != nil {
+		log.Error(err, "Failed to create api client connection to gRPC server", "revocation", revocation.Name)
+		cond := metav1.Condition{
+			Type:    authv1alpha1.DexSessionRevocationConditionTypeComplete,
+			Status:  metav1.ConditionFalse,
+			Reason:  "GRPCConnectionFailed",
+			Message: fmt.Sprintf("failed creating api client connection to gRPC server. error: %s", err.Error()),
+		}
+		if err := r.updateDexSessionRevocationStatusConditions(revocation, ctx, cond); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, err
+	}
+	defer release()
+
+	userIDs, err := r.getRevocationUserIDs(revocation, dexServer.Namespace, ctx)
+	if err != nil {
+		log.Error(err, "Failed to look up the user in the dex storage", "revocation", revocation.Name)
+		cond := metav1.Condition{
+			Type:    authv1alpha1.DexSessionRevocationConditionTypeComplete,
+			Status:  metav1.ConditionFalse,
+			Reason:  "UserLookupFailed",
+			Message: fmt.Sprintf("failed looking up the user in the dex storage. error: %s", err.Error()),
+		}
+		if err := r.updateDexSessionRevocationStatusConditions(revocation, ctx, cond); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, err
+	}
+	revocation.Status.UserIDs = userIDs
+
+	// Record the refresh tokens revoked before a failure too, dex no longer lists them on the next attempt
+	revoked, err := revokeRefreshTokens(dexApiClient, userIDs, ctx)
+	revocation.Status.RevokedRefreshTokens = append(revocation.Status.RevokedRefreshTokens, revoked...)
+	if err != nil {
+		log.Error(err, "Failed to revoke the refresh tokens", "revocation", revocation.Name)
+		cond := metav1.Condition{
+			Type:    authv1alpha1.DexSessionRevocationConditionTypeComplete,
+			Status:  metav1.ConditionFalse,
+			Reason:  "RevocationFailed",
+			Message: fmt.Sprintf("failed revoking the refresh tokens. error: %s", err.Error()),
+		}
+		if err := r.updateDexSessionRevocationStatusConditions(revocation, ctx, cond); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, err
+	}
+
+	cond := metav1.Condition{
+		Type:    authv1alpha1.DexSessionRevocationConditionTypeComplete,
+		Status:  metav1.ConditionTrue,
+		Reason:  "Revoked",
+		Message: fmt.Sprintf("revoked %d refresh tokens", len(revocation.Status.RevokedRefreshTokens)),
+	}
+	if len(revocation.Status.RevokedRefreshTokens) == 0 {
+		cond.Reason = "NoSessions"
+		cond.Message = "dex holds no refresh tokens for the user"
+	}
+	now := metav1.Now()
+	revocation.Status.CompletionTime = &now
+	log.Info("revoked dex sessions", "revocation", revocation.Name, "refreshTokens", len(revocation.Status.RevokedRefreshTokens))
+	return ctrl.Result{}, r.updateDexSessionRevocationStatusConditions(revocation, ctx, cond)
+}
+
+// A DexSessionRevocation names the user either by dex user ID, or by email and connector
+func validateDexSessionRevocation(revocation *authv1alpha1.DexSessionRevocation) error {
+	spec := revocation.Spec
+	if spec.UserID != "" {
+		if spec.Email != "" {
+			return fmt.Errorf("only one of userID and email can be set")
+		}
+		if _, _, err := dexapi.DecodeSubject(spec.UserID); err != nil {
+			return fmt.Errorf("userID is not a dex user ID: %s", err.Error())
+		}
+		return nil
+	}
+	if spec.Email == "" || spec.ConnectorID == "" {
+		return fmt.Errorf("either userID, or email and connectorID must be set")
+	}
+	return nil
+}
+
+// The DexServer of a DexSessionRevocation. It is only looked up in the namespace of the DexSessionRevocation, so that
+// the users of a namespace cannot revoke the sessions of the DexServers of other namespaces.
+func getDexServerRef(revocation *authv1alpha1.DexSessionRevocation) types.NamespacedName {
+	return types.NamespacedName{Name: revocation.Spec.DexServerRef.Name, Namespace: revocation.Namespace}
+}
+
+// The dex user IDs to revoke the sessions of. A user named by email is looked up in the refresh tokens held by the
+// dex storage, as dex has no other record of the users of connectors.
+func (r *DexSessionRevocationReconciler) getRevocationUserIDs(revocation *authv1alpha1.DexSessionRevocation, dexServerNamespace string, ctx context.Context) ([]string, error) {
+	if revocation.Spec.UserID != "" {
+		return []string{revocation.Spec.UserID}, nil
+	}
+	refreshTokens, err := dexapi.ListStoredRefreshTokens(ctx, r.Client, dexServerNamespace)
+	if err != nil {
+		return nil, err
+	}
+	return userIDsForEmail(refreshTokens, revocation.Spec.Email, revocation.Spec.ConnectorID), nil
+}
+
+// The dex user IDs the refresh tokens issued to email through the connector belong to
+func userIDsForEmail(refreshTokens []*dexapi.RefreshToken, email string, connectorID string) []string {
+	userIDs := sets.NewString()
+	for _, refreshToken := range refreshTokens {
+		if refreshToken.ConnectorID != connectorID || !strings.EqualFold(refreshToken.Claims.Email, email) {
+			continue
+		}
+		userIDs.Insert(dexapi.EncodeSubject(refreshToken.Claims.UserID, connectorID))
+	}
+	return userIDs.List()
+}
+
+// Revoke every refresh token dex holds for the users. Refresh tokens dex no longer finds were revoked concurrently,
+// by dex or by another revocation, and are skipped.
+func revokeRefreshTokens(dexApiClient dexapi.DexAPI, userIDs []string, ctx context.Context) ([]authv1alpha1.RevokedRefreshToken, error) {
+	revoked := []authv1alpha1.RevokedRefreshToken{}
+	for _, userID := range userIDs {
+		refreshTokens, err := dexApiClient.ListRefresh(ctx, userID)
+		if err != nil {
+			return revoked, err
+		}
+		sort.Slice(refreshTokens, func(i, j int) bool {
+			return refreshTokens[i].GetClientId() < refreshTokens[j].GetClientId()
+		})
+		for _, refreshToken := range refreshTokens {
+			if err := dexApiClient.RevokeRefresh(ctx, userID, refreshToken.GetClientId()); err != nil {
+				if dexapi.IsNotFound(err) {
+					continue
+				}
+				return revoked, err
+			}
+			revokedRefreshToken := authv1alpha1.RevokedRefreshToken{
+				UserID:   userID,
+				ClientID: refreshToken.GetClientId(),
+				ID:       refreshToken.GetId(),
+			}
+			if refreshToken.GetCreatedAt() != 0 {
+				createdAt := metav1.NewTime(time.Unix(refreshToken.GetCreatedAt(), 0))
+				revokedRefreshToken.CreatedAt = &createdAt
+			}
+			if refreshToken.GetLastUsed() != 0 {
+				lastUsed := metav1.NewTime(time.Unix(refreshToken.GetLastUsed(), 0))
+				revokedRefreshToken.LastUsed = &lastUsed
+			}
+			revoked = append(revoked, revokedRefreshToken)
+		}
+	}
+	return revoked, nil
+}
+
+func (r *DexSessionRevocationReconciler) updateDexSessionRevocationStatusConditions(revocation *authv1alpha1.DexSessionRevocation, ctx context.Context, newConditions ...metav1.Condition) error {
+	revocation.Status.Conditions = mergeStatusConditions(revocation.Status.Conditions, newConditions...)
+	return r.Client.Status().Update(ctx, revocation)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *DexSessionRevocationReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if r.DexConnections == nil {
+		r.DexConnections = dexapi.NewConnectionManager(dexapi.NewDexAPI)
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&authv1alpha1.DexSessionRevocation{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Complete(r)
+}
@@ -0,0 +1,139 @@
+// Copyright Red Hat
+
+package controllers
+
+import (
+	"context"
+
+	api "github.com/dexidp/dex/api/v2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+	dexapi "github.com/identitatem/dex-operator/controllers/dex"
+)
+
+var _ = Describe("Revoke dex sessions through a fake dex server", func() {
+	DexServerName := "dex-server-revocation"
+	DexServerNamespace := "dex-server-revocation-ns"
+	UserID := dexapi.EncodeSubject("jane", "local")
+	OtherUserID := dexapi.EncodeSubject("john", "local")
+	var fake *fakeDexAPIServer
+	var stop func()
+	var r *DexSessionRevocationReconciler
+
+	BeforeEach(func() {
+		var newClient func(opts *dexapi.Options) (*dexapi.APIClient, error)
+		fake, newClient, stop = startFakeDexAPIServer()
+		r = &DexSessionRevocationReconciler{
+			Client: k8sClient,
+			Scheme: scheme.Scheme,
+			DexConnections: dexapi.NewConnectionManager(func(ctx context.Context, opts *dexapi.Options) (dexapi.DexAPI, error) {
+				dexApiClient, err := newClient(opts)
+				if err != nil {
+					return nil, err
+				}
+				return dexApiClient, nil
+			}),
+		}
+	})
+
+	AfterEach(func() {
+		stop()
+	})
+
+	// The manager reconciles the DexSessionRevocation too, so a reconcile may hit a conflict and is retried until
+	// the Complete condition has the expected reason
+	reconcileUntil := func(name string, reason string) *authv1alpha1.DexSessionRevocation {
+		revocation := &authv1alpha1.DexSessionRevocation{}
+		Eventually(func() string {
+			req := ctrl.Request{}
+			req.Name = name
+			req.Namespace = DexServerNamespace
+			if _, err := r.Reconcile(context.TODO(), req); err != nil {
+				return err.Error()
+			}
+			Expect(k8sClient.Get(context.TODO(), client.ObjectKey{Name: name, Namespace: DexServerNamespace}, revocation)).To(Succeed())
+			cond := meta.FindStatusCondition(revocation.Status.Conditions, authv1alpha1.DexSessionRevocationConditionTypeComplete)
+			if cond == nil {
+				return ""
+			}
+			return cond.Reason
+		}, 30, 1).Should(Equal(reason))
+		return revocation
+	}
+
+	It("should create the DexServer and its mTLS secret", func() {
+		Expect(k8sClient.Create(context.TODO(), &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{Name: DexServerNamespace},
+		})).To(Succeed())
+		Expect(k8sClient.Create(context.TODO(), &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: SECRET_MTLS_NAME, Namespace: DexServerNamespace},
+			Data: map[string][]byte{
+				"ca.crt":     []byte("ca.crt"),
+				"client.crt": []byte("client.crt"),
+				"client.key": []byte("client.key"),
+			},
+		})).To(Succeed())
+		Expect(k8sClient.Create(context.TODO(), &authv1alpha1.DexServer{
+			ObjectMeta: metav1.ObjectMeta{Name: DexServerName, Namespace: DexServerNamespace},
+			Spec: authv1alpha1.DexServerSpec{
+				Issuer: "https://dex-server-revocation.example.com",
+			},
+		})).To(Succeed())
+	})
+	It("should revoke the refresh tokens of the user", func() {
+		fake.addRefreshToken(UserID, &api.RefreshTokenRef{Id: "token-1", ClientId: "client-b", CreatedAt: 1600000000, LastUsed: 1600000100})
+		fake.addRefreshToken(UserID, &api.RefreshTokenRef{Id: "token-2", ClientId: "client-a", CreatedAt: 1600000000})
+		fake.addRefreshToken(OtherUserID, &api.RefreshTokenRef{Id: "token-3", ClientId: "client-a"})
+
+		Expect(k8sClient.Create(context.TODO(), &authv1alpha1.DexSessionRevocation{
+			ObjectMeta: metav1.ObjectMeta{Name: "revoke-jane", Namespace: DexServerNamespace},
+			Spec: authv1alpha1.DexSessionRevocationSpec{
+				DexServerRef: authv1alpha1.DexServerReference{Name: DexServerName},
+				UserID:       UserID,
+			},
+		})).To(Succeed())
+
+		revocation := reconcileUntil("revoke-jane", "Revoked")
+		Expect(revocation.Status.UserIDs).To(Equal([]string{UserID}))
+		Expect(revocation.Status.CompletionTime).ToNot(BeNil())
+		Expect(revocation.Status.RevokedRefreshTokens).To(HaveLen(2))
+		Expect(revocation.Status.RevokedRefreshTokens[0].ClientID).To(Equal("client-a"))
+		Expect(revocation.Status.RevokedRefreshTokens[1].ClientID).To(Equal("client-b"))
+		Expect(revocation.Status.RevokedRefreshTokens[1].LastUsed).ToNot(BeNil())
+
+		dexApiClient, err := r.DexConnections.NewClient(context.TODO(), &dexapi.Options{})
+		Expect(err).To(BeNil())
+		defer dexApiClient.CloseConnection()
+		Expect(dexApiClient.ListRefresh(context.TODO(), UserID)).To(BeEmpty())
+		Expect(dexApiClient.ListRefresh(context.TODO(), OtherUserID)).To(HaveLen(1))
+	})
+	It("should look up the DexServer in the namespace of the revocation only", func() {
+		revocation := &authv1alpha1.DexSessionRevocation{
+			ObjectMeta: metav1.ObjectMeta{Name: "revoke-jane", Namespace: "team-a"},
+			Spec: authv1alpha1.DexSessionRevocationSpec{
+				DexServerRef: authv1alpha1.DexServerReference{Name: DexServerName},
+			},
+		}
+		Expect(getDexServerRef(revocation)).To(Equal(types.NamespacedName{Name: DexServerName, Namespace: "team-a"}))
+	})
+	It("should reject a revocation naming no user", func() {
+		Expect(k8sClient.Create(context.TODO(), &authv1alpha1.DexSessionRevocation{
+			ObjectMeta: metav1.ObjectMeta{Name: "revoke-nobody", Namespace: DexServerNamespace},
+			Spec: authv1alpha1.DexSessionRevocationSpec{
+				DexServerRef: authv1alpha1.DexServerReference{Name: DexServerName},
+				Email:        "jane@example.com",
+			},
+		})).To(Succeed())
+
+		reconcileUntil("revoke-nobody", "InvalidSpec")
+	})
+})
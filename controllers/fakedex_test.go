@@ -0,0 +1,208 @@
+// Copyright Red Hat
+
+package controllers
+
+import (
+	"context"
+	"strings"
+
+	api "github.com/dexidp/dex/api/v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	dexapi "github.com/identitatem/dex-operator/controllers/dex"
+)
+
+// fakeDexAPIServer adds the static passwords, refresh tokens and connectors to the clients of the fake dex server, for
+// the tests calling the rest of the dex API
+type fakeDexAPIServer struct {
+	*fakeDexServer
+	passwords  map[string]*api.Password
+	refresh    map[string][]*api.RefreshTokenRef
+	connectors map[string]*dexapi.Connector
+}
+
+// Start a fake dex server serving the whole DexAPI, returns a function connecting to it
+func startFakeDexAPIServer() (*fakeDexAPIServer, func(opts *dexapi.Options) (*dexapi.APIClient, error), func()) {
+	fake := &fakeDexAPIServer{
+		fakeDexServer: newFakeDexServer(),
+		passwords:     map[string]*api.Password{},
+		refresh:       map[string][]*api.RefreshTokenRef{},
+		connectors:    map[string]*dexapi.Connector{},
+	}
+	newClient, stop := serveFakeDex(func(server *grpc.Server) {
+		api.RegisterDexServer(server, fake)
+	}, grpc.UnknownServiceHandler(fake.handleUndeclared))
+	return fake, newClient, stop
+}
+
+// Serve the calls the dex API module does not declare, see controllers/dex/rpc.go
+func (s *fakeDexAPIServer) handleUndeclared(srv interface{}, stream grpc.ServerStream) error {
+	method, _ := grpc.MethodFromServerStream(stream)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	name := strings.TrimPrefix(method, "/api.Dex/")
+	if err := s.failure(name); err != nil {
+		return err
+	}
+	switch name {
+	case "GetClient":
+		req := &dexapi.GetClientReq{}
+		if err := stream.RecvMsg(req); err != nil {
+			return err
+		}
+		client, ok := s.clients[req.Id]
+		if !ok {
+			return status.Errorf(codes.NotFound, "client %q not found", req.Id)
+		}
+		return stream.SendMsg(&dexapi.GetClientResp{Client: client})
+	case "ListClients":
+		if err := stream.RecvMsg(&dexapi.ListClientReq{}); err != nil {
+			return err
+		}
+		res := &dexapi.ListClientResp{}
+		for _, client := range s.clients {
+			res.Clients = append(res.Clients, &dexapi.ClientInfo{
+				Id:           client.Id,
+				RedirectUris: client.RedirectUris,
+				TrustedPeers: client.TrustedPeers,
+				Public:       client.Public,
+				Name:         client.Name,
+				LogoUrl:      client.LogoUrl,
+			})
+		}
+		return stream.SendMsg(res)
+	case "GetDiscovery":
+		if err := stream.RecvMsg(&dexapi.DiscoveryReq{}); err != nil {
+			return err
+		}
+		return stream.SendMsg(&dexapi.DiscoveryResp{
+			Issuer:                "https://dex.example.com",
+			AuthorizationEndpoint: "https://dex.example.com/auth",
+			TokenEndpoint:         "https://dex.example.com/token",
+			JwksUri:               "https://dex.example.com/keys",
+			ScopesSupported:       []string{"openid", "email", "groups", "profile", "offline_access"},
+		})
+	case "CreateConnector":
+		req := &dexapi.CreateConnectorReq{}
+		if err := stream.RecvMsg(req); err != nil {
+			return err
+		}
+		if _, ok := s.connectors[req.Connector.Id]; ok {
+			return stream.SendMsg(&dexapi.CreateConnectorResp{AlreadyExists: true})
+		}
+		s.connectors[req.Connector.Id] = req.Connector
+		return stream.SendMsg(&dexapi.CreateConnectorResp{})
+	case "UpdateConnector":
+		req := &dexapi.UpdateConnectorReq{}
+		if err := stream.RecvMsg(req); err != nil {
+			return err
+		}
+		if _, ok := s.connectors[req.Id]; !ok {
+			return stream.SendMsg(&dexapi.UpdateConnectorResp{NotFound: true})
+		}
+		s.connectors[req.Id] = &dexapi.Connector{Id: req.Id, Type: req.NewType, Name: req.NewName, Config: req.NewConfig}
+		return stream.SendMsg(&dexapi.UpdateConnectorResp{})
+	case "DeleteConnector":
+		req := &dexapi.DeleteConnectorReq{}
+		if err := stream.RecvMsg(req); err != nil {
+			return err
+		}
+		if _, ok := s.connectors[req.Id]; !ok {
+			return stream.SendMsg(&dexapi.DeleteConnectorResp{NotFound: true})
+		}
+		delete(s.connectors, req.Id)
+		return stream.SendMsg(&dexapi.DeleteConnectorResp{})
+	case "ListConnectors":
+		if err := stream.RecvMsg(&dexapi.ListConnectorReq{}); err != nil {
+			return err
+		}
+		res := &dexapi.ListConnectorResp{}
+		for _, connector := range s.connectors {
+			res.Connectors = append(res.Connectors, connector)
+		}
+		return stream.SendMsg(res)
+	}
+	return status.Errorf(codes.Unimplemented, "unknown method %s", method)
+}
+
+func (s *fakeDexAPIServer) getConnector(id string) *dexapi.Connector {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.connectors[id]
+}
+
+func (s *fakeDexAPIServer) CreatePassword(ctx context.Context, req *api.CreatePasswordReq) (*api.CreatePasswordResp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("CreatePassword"); err != nil {
+		return nil, err
+	}
+	if _, ok := s.passwords[req.Password.Email]; ok {
+		return &api.CreatePasswordResp{AlreadyExists: true}, nil
+	}
+	s.passwords[req.Password.Email] = req.Password
+	return &api.CreatePasswordResp{}, nil
+}
+
+func (s *fakeDexAPIServer) ListPasswords(ctx context.Context, req *api.ListPasswordReq) (*api.ListPasswordResp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("ListPasswords"); err != nil {
+		return nil, err
+	}
+	res := &api.ListPasswordResp{}
+	for _, password := range s.passwords {
+		res.Passwords = append(res.Passwords, password)
+	}
+	return res, nil
+}
+
+func (s *fakeDexAPIServer) VerifyPassword(ctx context.Context, req *api.VerifyPasswordReq) (*api.VerifyPasswordResp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("VerifyPassword"); err != nil {
+		return nil, err
+	}
+	password, ok := s.passwords[req.Email]
+	if !ok {
+		return &api.VerifyPasswordResp{NotFound: true}, nil
+	}
+	// The fake keeps passwords in clear text instead of bcrypt hashes
+	return &api.VerifyPasswordResp{Verified: string(password.Hash) == req.Password}, nil
+}
+
+func (s *fakeDexAPIServer) addRefreshToken(userID string, refreshToken *api.RefreshTokenRef) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refresh[userID] = append(s.refresh[userID], refreshToken)
+}
+
+func (s *fakeDexAPIServer) ListRefresh(ctx context.Context, req *api.ListRefreshReq) (*api.ListRefreshResp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("ListRefresh"); err != nil {
+		return nil, err
+	}
+	return &api.ListRefreshResp{RefreshTokens: s.refresh[req.UserId]}, nil
+}
+
+func (s *fakeDexAPIServer) RevokeRefresh(ctx context.Context, req *api.RevokeRefreshReq) (*api.RevokeRefreshResp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("RevokeRefresh"); err != nil {
+		return nil, err
+	}
+	refreshTokens := []*api.RefreshTokenRef{}
+	for _, refreshToken := range s.refresh[req.UserId] {
+		if refreshToken.ClientId != req.ClientId {
+			refreshTokens = append(refreshTokens, refreshToken)
+		}
+	}
+	if len(refreshTokens) == len(s.refresh[req.UserId]) {
+		return &api.RevokeRefreshResp{NotFound: true}, nil
+	}
+	s.refresh[req.UserId] = refreshTokens
+	return &api.RevokeRefreshResp{}, nil
+}
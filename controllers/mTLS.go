@@ -4,28 +4,44 @@ package controllers
 
 import (
 	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/pem"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"math/big"
 	"net"
-	"os/exec"
 	"time"
+
+	"github.com/pkg/errors"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
 )
 
 const (
 	PRIVATE_KEY_SIZE = 2048
+	// the common name of the gRPC client certificate of the operator, distinct from the ones of the external consumers
+	GRPC_OPERATOR_CLIENT_NAME = "dex-operator"
 )
 
 var (
 	serialNumberLimit = new(big.Int).Lsh(big.NewInt(1), 128)
-	certDuration      = time.Hour * 24
-	certRenewalWindow = time.Hour * 2 // roll the cert when we get within this window of expiring
+	caDuration        = time.Hour * 24 * 365 * 10
+	certDuration      = time.Hour * 24 * 30 // each renewal restarts dex, so the certs last well over a day
+	certRenewalWindow = time.Hour * 2       // roll the cert when we get within this window of expiring
+	// how often the dex rollouts are checked during a CA rotation
+	mtlsRotationRequeuePeriod = time.Second * 10
+	// how long before a provided CA expires the MTLSCAExpiring condition is raised
+	providedCAExpiryWarning = time.Hour * 24 * 30
 )
 
 func GetCertDuration() time.Duration {
@@ -42,130 +58,386 @@ type MTLSCerts struct {
 	expiry           time.Time
 }
 
-func inCertRenewalWindow(expiry time.Time) bool {
-	return time.Now().Add(certRenewalWindow).After(expiry)
+// mtlsCA is the CA signing the gRPC server and client certificates
+type mtlsCA struct {
+	cert       *x509.Certificate
+	privKey    crypto.Signer
+	pem        *bytes.Buffer
+	privKeyPEM *bytes.Buffer
+}
+
+// mtlsConfig holds the lifetimes and key algorithm of the gRPC mTLS certificates of a DexServer
+type mtlsConfig struct {
+	caDuration   time.Duration
+	certDuration time.Duration
+	renewBefore  time.Duration
+	keyAlgorithm authv1alpha1.KeyAlgorithm
+}
+
+// Get the mTLS configuration of a DexServer, the fields it leaves unset take the package defaults
+func getMTLSConfig(dexServer *authv1alpha1.DexServer) (*mtlsConfig, error) {
+	config := &mtlsConfig{
+		caDuration:   caDuration,
+		certDuration: GetCertDuration(),
+		renewBefore:  certRenewalWindow,
+		keyAlgorithm: authv1alpha1.KeyAlgorithmRSA2048,
+	}
+	if spec := dexServer.Spec.MTLS; spec != nil {
+		if spec.CADuration != nil {
+			config.caDuration = spec.CADuration.Duration
+		}
+		if spec.CertDuration != nil {
+			config.certDuration = spec.CertDuration.Duration
+		}
+		if spec.RenewBefore != nil {
+			config.renewBefore = spec.RenewBefore.Duration
+		}
+		if spec.KeyAlgorithm != "" {
+			config.keyAlgorithm = spec.KeyAlgorithm
+		}
+	}
+	if config.renewBefore <= 0 || config.certDuration <= config.renewBefore {
+		return nil, fmt.Errorf("mtls certDuration %s must be longer than renewBefore %s", config.certDuration, config.renewBefore)
+	}
+	if spec := dexServer.Spec.MTLS; spec != nil && spec.CASecretRef != nil && isCertManagerIssued(dexServer) {
+		return nil, fmt.Errorf("mtls caSecretRef can not be used with the CertManager certificate issuer")
+	}
+	// the CA is renewed once it would expire before a certificate issued now
+	if config.caDuration <= config.certDuration+config.renewBefore {
+		return nil, fmt.Errorf("mtls caDuration %s must be longer than certDuration %s plus renewBefore %s", config.caDuration, config.certDuration, config.renewBefore)
+	}
+	switch config.keyAlgorithm {
+	case authv1alpha1.KeyAlgorithmRSA2048, authv1alpha1.KeyAlgorithmRSA4096, authv1alpha1.KeyAlgorithmECDSAP256,
+		authv1alpha1.KeyAlgorithmECDSAP384, authv1alpha1.KeyAlgorithmEd25519:
+	default:
+		return nil, fmt.Errorf("unsupported mtls key algorithm %q", config.keyAlgorithm)
+	}
+	return config, nil
+}
+
+func generatePrivateKey(keyAlgorithm authv1alpha1.KeyAlgorithm) (crypto.Signer, error) {
+	switch keyAlgorithm {
+	case authv1alpha1.KeyAlgorithmRSA2048:
+		return rsa.GenerateKey(rand.Reader, PRIVATE_KEY_SIZE)
+	case authv1alpha1.KeyAlgorithmRSA4096:
+		return rsa.GenerateKey(rand.Reader, 4096)
+	case authv1alpha1.KeyAlgorithmECDSAP256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case authv1alpha1.KeyAlgorithmECDSAP384:
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case authv1alpha1.KeyAlgorithmEd25519:
+		_, privKey, err := ed25519.GenerateKey(rand.Reader)
+		return privKey, err
+	default:
+		return nil, fmt.Errorf("unsupported mtls key algorithm %q", keyAlgorithm)
+	}
+}
+
+// Get the algorithm of a public key, to compare it with the configured one
+func getKeyAlgorithm(pub crypto.PublicKey) authv1alpha1.KeyAlgorithm {
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		switch key.N.BitLen() {
+		case PRIVATE_KEY_SIZE:
+			return authv1alpha1.KeyAlgorithmRSA2048
+		case 4096:
+			return authv1alpha1.KeyAlgorithmRSA4096
+		}
+	case *ecdsa.PublicKey:
+		switch key.Curve {
+		case elliptic.P256():
+			return authv1alpha1.KeyAlgorithmECDSAP256
+		case elliptic.P384():
+			return authv1alpha1.KeyAlgorithmECDSAP384
+		}
+	case ed25519.PublicKey:
+		return authv1alpha1.KeyAlgorithmEd25519
+	}
+	return ""
+}
+
+// The key usages of a certificate depend on its key, only RSA keys encipher the TLS session keys
+func getKeyUsage(pub crypto.PublicKey) x509.KeyUsage {
+	if _, ok := pub.(*rsa.PublicKey); ok {
+		return x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
+	}
+	return x509.KeyUsageDigitalSignature
+}
+
+// Compute the subject key identifier of a public key, from the SHA-256 hash of its subjectPublicKey bits truncated to
+// 160 bits (RFC 7093, section 2, method 1)
+func getSubjectKeyID(pub crypto.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	var spki struct {
+		Algorithm        pkix.AlgorithmIdentifier
+		SubjectPublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(der, &spki); err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(spki.SubjectPublicKey.Bytes)
+	return sum[:20], nil
 }
 
-func generateMTLSCerts(ns string) (*MTLSCerts, error) {
-	// TODO(cdoan): handle the error, and put this into a function to reuse
+func inCertRenewalWindow(expiry time.Time, renewBefore time.Duration) bool {
+	return time.Now().Add(renewBefore).After(expiry)
+}
+
+// The CA can keep signing certificates as long as it outlives them and its key has the configured algorithm
+func (ca *mtlsCA) isValidFor(config *mtlsConfig) bool {
+	if ca.privKey == nil || getKeyAlgorithm(ca.privKey.Public()) != config.keyAlgorithm {
+		return false
+	}
+	return !inCertRenewalWindow(ca.cert.NotAfter, config.certDuration+config.renewBefore)
+}
+
+// The common name of the CA signing the gRPC certificates of the dex server in namespace ns
+func getGRPCCACommonName(ns string) string {
+	return getServiceName(ns) + " CA"
+}
+
+// Generate a self-signed CA with the given common name
+func generateMTLSCA(commonName string, config *mtlsConfig) (*mtlsCA, error) {
 	now := time.Now()
-	expiry := now.Add(GetCertDuration())
-	serialNumber, _ := rand.Int(rand.Reader, serialNumberLimit)
+	serialNumber, err := rand.Int(rand.Reader, serialNumberLimit)
+	if err != nil {
+		return nil, err
+	}
+	// generate a private key
+	caPrivKey, err := generatePrivateKey(config.keyAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	subjectKeyID, err := getSubjectKeyID(caPrivKey.Public())
+	if err != nil {
+		return nil, err
+	}
 	ca := &x509.Certificate{
-		// SerialNumber: big.NewInt(2019),
 		SerialNumber: serialNumber,
+		// the subject of the CA differs from the one of the certificates it issues, which are not self-issued and name
+		// the CA key in their authority key identifier
 		Subject: pkix.Name{
 			Organization: []string{"Red Hat, Inc."},
 			Country:      []string{"US"},
-			CommonName:   getServiceName(ns),
+			CommonName:   commonName,
 		},
 		NotBefore:             now,
-		NotAfter:              expiry,
+		NotAfter:              now.Add(config.caDuration),
 		IsCA:                  true,
+		SubjectKeyId:          subjectKeyID,
 		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
-		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment | x509.KeyUsageCertSign,
+		KeyUsage:              getKeyUsage(caPrivKey.Public()) | x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
 		BasicConstraintsValid: true,
 	}
-	// generate a private key
-	caPrivKey, err := rsa.GenerateKey(rand.Reader, PRIVATE_KEY_SIZE)
+
+	caBytes, err := x509.CreateCertificate(rand.Reader, ca, ca, caPrivKey.Public(), caPrivKey)
 	if err != nil {
 		return nil, err
 	}
-
-	caBytes, err := x509.CreateCertificate(rand.Reader, ca, ca, &caPrivKey.PublicKey, caPrivKey)
+	// read the signed certificate back, the server and client certificates are issued by it
+	caCert, err := x509.ParseCertificate(caBytes)
 	if err != nil {
 		return nil, err
 	}
 	// convert to PEM
-	caPEM, caPrivKeyPEM := PEMEncode(caBytes, caPrivKey)
-	serialNumber, _ = rand.Int(rand.Reader, serialNumberLimit)
-	cert := &x509.Certificate{
-		SerialNumber: serialNumber,
-		Subject: pkix.Name{
-			Organization: []string{"Red Hat, Inc."},
-			Country:      []string{"US"},
-			CommonName:   getServiceName(ns),
-		},
-		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
-		NotBefore:    now,
-		NotAfter:     expiry,
-		SubjectKeyId: []byte{1, 2, 3, 4, 6},
-		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
-		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+	caPEM, caPrivKeyPEM, err := PEMEncode(caBytes, caPrivKey)
+	if err != nil {
+		return nil, err
 	}
+	return &mtlsCA{
+		cert:       caCert,
+		privKey:    caPrivKey,
+		pem:        caPEM,
+		privKeyPEM: caPrivKeyPEM,
+	}, nil
+}
 
-	cert.DNSNames = []string{getServiceName(ns)}
-
-	certPrivKey, err := rsa.GenerateKey(rand.Reader, PRIVATE_KEY_SIZE)
+// Parse a PEM encoded private key, in PKCS#8 or in the PKCS#1 encoding of the secrets written by earlier versions
+func parsePrivateKeyPEM(privKeyPEM []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(privKeyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("key is not PEM encoded")
+	}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+	privKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
 	if err != nil {
 		return nil, err
 	}
+	signer, ok := privKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported key type %T", privKey)
+	}
+	return signer, nil
+}
+
+// Read a CA back from the mTLS secret, its certificate is the one of the ca.crt bundle matching the key
+func parseMTLSCA(caBundlePEM []byte, caPrivKeyPEM []byte) (*mtlsCA, error) {
+	caPrivKey, err := parsePrivateKeyPEM(caPrivKeyPEM)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing the ca key")
+	}
+	caPublicKey, ok := caPrivKey.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok {
+		return nil, fmt.Errorf("unsupported ca key type %T", caPrivKey)
+	}
+	for rest := caBundlePEM; ; {
+		var certBlock *pem.Block
+		certBlock, rest = pem.Decode(rest)
+		if certBlock == nil {
+			return nil, fmt.Errorf("ca.crt holds no certificate matching the ca key")
+		}
+		if certBlock.Type != "CERTIFICATE" {
+			continue
+		}
+		caCert, err := x509.ParseCertificate(certBlock.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		if caPublicKey.Equal(caCert.PublicKey) {
+			return &mtlsCA{
+				cert:       caCert,
+				privKey:    caPrivKey,
+				pem:        bytes.NewBuffer(pem.EncodeToMemory(certBlock)),
+				privKeyPEM: bytes.NewBuffer(caPrivKeyPEM),
+			}, nil
+		}
+	}
+}
+
+// Check that a provided CA may sign the gRPC server and client certificates, and that it is valid now
+func validateProvidedMTLSCA(caCert *x509.Certificate) error {
+	if !caCert.BasicConstraintsValid || !caCert.IsCA {
+		return fmt.Errorf("certificate %q is not a CA", caCert.Subject.CommonName)
+	}
+	if caCert.KeyUsage&x509.KeyUsageCertSign == 0 {
+		return fmt.Errorf("CA %q key usage does not allow signing certificates", caCert.Subject.CommonName)
+	}
+	if len(caCert.ExtKeyUsage) > 0 {
+		usages := map[x509.ExtKeyUsage]bool{}
+		for _, usage := range caCert.ExtKeyUsage {
+			usages[usage] = true
+		}
+		if !usages[x509.ExtKeyUsageAny] && (!usages[x509.ExtKeyUsageServerAuth] || !usages[x509.ExtKeyUsageClientAuth]) {
+			return fmt.Errorf("CA %q extended key usage does not allow server and client authentication", caCert.Subject.CommonName)
+		}
+	}
+	now := time.Now()
+	if now.Before(caCert.NotBefore) {
+		return fmt.Errorf("CA %q is not valid before %s", caCert.Subject.CommonName, caCert.NotBefore.UTC().Format(time.RFC3339))
+	}
+	if now.After(caCert.NotAfter) {
+		return fmt.Errorf("CA %q expired on %s", caCert.Subject.CommonName, caCert.NotAfter.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
 
-	// SIGN the cert/key with the previous CA
-	certBytes, err := x509.CreateCertificate(rand.Reader, cert, ca, &certPrivKey.PublicKey, caPrivKey)
+// Find the CA of a trust bundle which signed a certificate. Its key is not known, it can not sign other certificates.
+func getIssuerMTLSCA(caBundlePEM []byte, certPEM []byte) (*mtlsCA, error) {
+	certBlock, _ := pem.Decode(certPEM)
+	if certBlock == nil {
+		return nil, fmt.Errorf("tls.crt holds no certificate")
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
 	if err != nil {
 		return nil, err
 	}
+	for block, rest := pem.Decode(caBundlePEM); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		caCert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		if cert.CheckSignatureFrom(caCert) == nil {
+			return &mtlsCA{
+				cert: caCert,
+				pem:  bytes.NewBuffer(pem.EncodeToMemory(block)),
+			}, nil
+		}
+	}
+	return nil, fmt.Errorf("ca.crt holds no CA which signed tls.crt")
+}
 
-	// convert the server cert/key to PEM Encoiding
-	certPEM, certPrivKeyPEM := PEMEncode(certBytes, certPrivKey)
+// Issue a certificate with the CA, for a new key with the configured algorithm. The serial number, subject key
+// identifier and key usages of the template are filled in.
+func (ca *mtlsCA) issue(template *x509.Certificate, keyAlgorithm authv1alpha1.KeyAlgorithm) (*bytes.Buffer, *bytes.Buffer, error) {
+	privKey, err := generatePrivateKey(keyAlgorithm)
+	if err != nil {
+		return nil, nil, err
+	}
+	if template.SerialNumber, err = rand.Int(rand.Reader, serialNumberLimit); err != nil {
+		return nil, nil, err
+	}
+	if template.SubjectKeyId, err = getSubjectKeyID(privKey.Public()); err != nil {
+		return nil, nil, err
+	}
+	template.KeyUsage = getKeyUsage(privKey.Public())
+	// a provided CA may expire before the configured lifetime of the certificates
+	if template.NotAfter.After(ca.cert.NotAfter) {
+		template.NotAfter = ca.cert.NotAfter
+	}
 
-	// Client
-	client := &x509.Certificate{
-		SerialNumber: big.NewInt(1658),
+	// SIGN the cert/key with the CA
+	certBytes, err := x509.CreateCertificate(rand.Reader, template, ca.cert, privKey.Public(), ca.privKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return PEMEncode(certBytes, privKey)
+}
+
+// Issue the gRPC server and client certificates with the CA
+func generateMTLSCerts(ns string, ca *mtlsCA, config *mtlsConfig) (*MTLSCerts, error) {
+	now := time.Now()
+	expiry := now.Add(config.certDuration)
+	if expiry.After(ca.cert.NotAfter) {
+		expiry = ca.cert.NotAfter
+	}
+	cert := &x509.Certificate{
 		Subject: pkix.Name{
 			Organization: []string{"Red Hat, Inc."},
 			Country:      []string{"US"},
 			CommonName:   getServiceName(ns),
 		},
-		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
-		NotBefore:    now,
-		NotAfter:     expiry,
-		SubjectKeyId: []byte{1, 2, 3, 4, 6},
-		// ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
-		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
-		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		DNSNames:    []string{getServiceName(ns)},
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		NotBefore:   now,
+		NotAfter:    expiry,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
 	}
-	clientPrivKey, err := rsa.GenerateKey(rand.Reader, PRIVATE_KEY_SIZE)
+	certPEM, certPrivKeyPEM, err := ca.issue(cert, config.keyAlgorithm)
 	if err != nil {
 		return nil, err
 	}
 
-	// SIGN the cert/key with the previous CA
-	clientBytes, err := x509.CreateCertificate(rand.Reader, client, ca, &clientPrivKey.PublicKey, caPrivKey)
+	// Client
+	client := &x509.Certificate{
+		Subject: pkix.Name{
+			Organization: []string{"Red Hat, Inc."},
+			Country:      []string{"US"},
+			CommonName:   GRPC_OPERATOR_CLIENT_NAME,
+		},
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		NotBefore:   now,
+		NotAfter:    expiry,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	clientPEM, clientPrivKeyPEM, err := ca.issue(client, config.keyAlgorithm)
 	if err != nil {
 		return nil, err
 	}
 
-	// convert the server cert/key to PEM Encoiding
-	clientPEM, clientPrivKeyPEM := PEMEncode(clientBytes, clientPrivKey)
-
-	// fmt.Println("create ca:\n", ca)
-	// fmt.Println("create ca privatekey:\n", caPrivKey)
-	// fmt.Println("create ca cert:\n", caBytes)
-	// fmt.Println("create ca cert in PEM format:\n", caPEM.String())
-	// fmt.Println("create ca key in PEM format:\n", caPrivKeyPEM.String())
-
-	// bufferToFile("ca.crt", caPEM.Bytes())
-
-	// fmt.Println("create server certificate:\n", cert)
-	// fmt.Println("create server key:\n", certPrivKey)
-
-	// fmt.Println("sign cert:\n", certBytes)
-	// fmt.Println("signed server cert in PEM:\n", certPEM)
-	// fmt.Println("signed server key in PEM:\n", certPrivKeyPEM)
-
-	// fmt.Println("signed client cert in PEM:\n", clientPEM)
-	// fmt.Println("signed client key in PEM:\n", clientPrivKeyPEM)
-
-	// bufferToFile("server.crt", certPEM.Bytes())
-	// bufferToFile("server.key", certPrivKeyPEM.Bytes())
-	// bufferToFile("client.crt", clientPEM.Bytes())
-	// bufferToFile("client.key", clientPrivKeyPEM.Bytes())
-
 	return &MTLSCerts{
-		caPEM:            caPEM,
-		caPrivKeyPEM:     caPrivKeyPEM,
+		caPEM:            ca.pem,
+		caPrivKeyPEM:     ca.privKeyPEM,
 		certPEM:          certPEM,
 		certPrivKeyPEM:   certPrivKeyPEM,
 		clientPEM:        clientPEM,
@@ -174,20 +446,130 @@ func generateMTLSCerts(ns string) (*MTLSCerts, error) {
 	}, nil
 }
 
-func PEMEncode(caBytes []byte, caPrivKey *rsa.PrivateKey) (*bytes.Buffer, *bytes.Buffer) {
-	caPEM := new(bytes.Buffer)
-	pem.Encode(caPEM, &pem.Block{
+// Issue the gRPC client certificate of an external consumer, its subject names the consumer
+func generateGRPCClientCert(name string, ca *mtlsCA, config *mtlsConfig) (*bytes.Buffer, *bytes.Buffer, error) {
+	now := time.Now()
+	client := &x509.Certificate{
+		Subject: pkix.Name{
+			Organization: []string{"Red Hat, Inc."},
+			Country:      []string{"US"},
+			CommonName:   name,
+		},
+		NotBefore:   now,
+		NotAfter:    now.Add(config.certDuration),
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	return ca.issue(client, config.keyAlgorithm)
+}
+
+// Issue the serving certificate of the dex web endpoint
+func generateWebTLSCert(dnsNames []string, ca *mtlsCA, config *mtlsConfig) (*bytes.Buffer, *bytes.Buffer, error) {
+	now := time.Now()
+	cert := &x509.Certificate{
+		Subject: pkix.Name{
+			Organization: []string{"Red Hat, Inc."},
+			Country:      []string{"US"},
+			CommonName:   dnsNames[0],
+		},
+		DNSNames:    dnsNames,
+		NotBefore:   now,
+		NotAfter:    now.Add(config.certDuration),
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	return ca.issue(cert, config.keyAlgorithm)
+}
+
+// Keep the CERTIFICATE blocks of a trust bundle, dropping the revocation lists appended to it
+func getCertificatesPEM(bundlePEM []byte) []byte {
+	certsPEM := []byte{}
+	for block, rest := pem.Decode(bundlePEM); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type == "CERTIFICATE" {
+			certsPEM = append(certsPEM, pem.EncodeToMemory(block)...)
+		}
+	}
+	return certsPEM
+}
+
+// Read the certificates revoked by the CA back from the CRLs of a trust bundle. The CRLs signed by other CAs, such as
+// the previous one of a rotation, are skipped.
+func (ca *mtlsCA) parseCRL(crlPEM []byte) []pkix.RevokedCertificate {
+	for block, rest := pem.Decode(crlPEM); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "X509 CRL" {
+			continue
+		}
+		crl, err := x509.ParseCRL(block.Bytes)
+		if err == nil && ca.cert.CheckCRLSignature(crl) == nil {
+			return crl.TBSCertList.RevokedCertificates
+		}
+	}
+	return nil
+}
+
+// Keep the CRLs signed by the CAs of a trust bundle, other than the given one. The CRL of a CA is dropped with it.
+func getBundleCRLsPEM(crlPEM []byte, caBundle []byte, except *x509.Certificate) []byte {
+	cas := []*x509.Certificate{}
+	for block, rest := pem.Decode(caBundle); block != nil; block, rest = pem.Decode(rest) {
+		if cert, err := x509.ParseCertificate(block.Bytes); err == nil && (except == nil || !cert.Equal(except)) {
+			cas = append(cas, cert)
+		}
+	}
+	crlsPEM := []byte{}
+	for block, rest := pem.Decode(crlPEM); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "X509 CRL" {
+			continue
+		}
+		crl, err := x509.ParseCRL(block.Bytes)
+		if err != nil {
+			continue
+		}
+		for _, ca := range cas {
+			if ca.CheckCRLSignature(crl) == nil {
+				crlsPEM = append(crlsPEM, pem.EncodeToMemory(block)...)
+				break
+			}
+		}
+	}
+	return crlsPEM
+}
+
+// Sign the CRL of the certificates revoked by the CA, it is valid as long as the CA
+func (ca *mtlsCA) createCRL(revoked []pkix.RevokedCertificate) ([]byte, error) {
+	now := time.Now()
+	crlBytes, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:              big.NewInt(now.UnixNano()),
+		ThisUpdate:          now,
+		NextUpdate:          ca.cert.NotAfter,
+		RevokedCertificates: revoked,
+	}, ca.cert, ca.privKey)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: crlBytes}), nil
+}
+
+// Encode a certificate and its private key to PEM, the key in PKCS#8
+func PEMEncode(certBytes []byte, privKey crypto.Signer) (*bytes.Buffer, *bytes.Buffer, error) {
+	certPEM := new(bytes.Buffer)
+	if err := pem.Encode(certPEM, &pem.Block{
 		Type:  "CERTIFICATE",
-		Bytes: caBytes,
-	})
+		Bytes: certBytes,
+	}); err != nil {
+		return nil, nil, err
+	}
 
-	caPrivKeyPEM := new(bytes.Buffer)
-	pem.Encode(caPrivKeyPEM, &pem.Block{
-		Type:  "RSA PRIVATE KEY",
-		Bytes: x509.MarshalPKCS1PrivateKey(caPrivKey),
-	})
+	privKeyBytes, err := x509.MarshalPKCS8PrivateKey(privKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	privKeyPEM := new(bytes.Buffer)
+	if err := pem.Encode(privKeyPEM, &pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: privKeyBytes,
+	}); err != nil {
+		return nil, nil, err
+	}
 
-	return caPEM, caPrivKeyPEM
+	return certPEM, privKeyPEM, nil
 }
 
 func bufferToFile(name string, thing []byte) {
@@ -201,19 +583,52 @@ func getServiceName(ns string) string {
 	return fmt.Sprintf("%s.%s.svc.cluster.local", GRPC_SERVICE_NAME, ns)
 }
 
-func verifyCACert() error {
-	out, err := exec.Command("openssl", "verify", "-CAfile", "ca.crt", "server.crt").Output()
+// Verify a certificate chain before it is written to a secret: the leaf comes first and matches the key, each
+// certificate is signed by the next one, and the leaf chains up to one of the trusted CAs for the given usage, and
+// the DNS name when set.
+func verifyMTLSChain(chainPEM []byte, keyPEM []byte, caBundlePEM []byte, usage x509.ExtKeyUsage, dnsName string) error {
+	keyPair, err := tls.X509KeyPair(chainPEM, keyPEM)
 	if err != nil {
-		log.Fatal(err)
 		return err
 	}
-	fmt.Printf("Output:\n%s\n", out)
+	if len(keyPair.Certificate) < 2 {
+		return fmt.Errorf("the chain holds no CA after the leaf certificate")
+	}
+	chain := []*x509.Certificate{}
+	for _, der := range keyPair.Certificate {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return err
+		}
+		chain = append(chain, cert)
+	}
+	intermediates := x509.NewCertPool()
+	for i, cert := range chain[1:] {
+		if err := chain[i].CheckSignatureFrom(cert); err != nil {
+			return fmt.Errorf("certificate %q of the chain is not signed by the next one %q: %v", chain[i].Subject.CommonName, cert.Subject.CommonName, err)
+		}
+		intermediates.AddCert(cert)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caBundlePEM) {
+		return fmt.Errorf("ca.crt holds no certificate")
+	}
+	_, err = chain[0].Verify(x509.VerifyOptions{
+		DNSName:       dnsName,
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{usage},
+	})
+	return err
+}
 
-	out, err = exec.Command("openssl", "verify", "-CAfile", "ca.crt", "client.crt").Output()
-	if err != nil {
-		log.Fatal(err)
-		return err
+// Verify the server and client certificate chains of the mTLS secret against its trusted CAs
+func verifyMTLSCerts(ns string, data map[string][]byte, caBundlePEM []byte) error {
+	if err := verifyMTLSChain(data["tls.crt"], data["tls.key"], caBundlePEM, x509.ExtKeyUsageServerAuth, getServiceName(ns)); err != nil {
+		return errors.Wrap(err, "invalid tls.crt")
+	}
+	if err := verifyMTLSChain(data["client.crt"], data["client.key"], caBundlePEM, x509.ExtKeyUsageClientAuth, ""); err != nil {
+		return errors.Wrap(err, "invalid client.crt")
 	}
-	fmt.Printf("Output:\n%s\n", out)
 	return nil
 }
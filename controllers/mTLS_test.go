@@ -0,0 +1,366 @@
+// Copyright Red Hat
+
+package controllers
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+)
+
+func parsePEMCertificate(data []byte) *x509.Certificate {
+	block, _ := pem.Decode(data)
+	Expect(block).ToNot(BeNil())
+	cert, err := x509.ParseCertificate(block.Bytes)
+	Expect(err).To(BeNil())
+	return cert
+}
+
+func parsePEMCertificates(data []byte) []*x509.Certificate {
+	certs := []*x509.Certificate{}
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		cert, err := x509.ParseCertificate(block.Bytes)
+		Expect(err).To(BeNil())
+		certs = append(certs, cert)
+	}
+	return certs
+}
+
+var _ = Describe("Manage the gRPC mTLS certificates of a DexServer", func() {
+	DexServerName := "dex-server-mtls"
+	DexServerNamespace := "dex-server-mtls-ns"
+
+	reconcileUntilPhase := func(phase authv1alpha1.MTLSRotationPhase) *authv1alpha1.DexServer {
+		dexServer := &authv1alpha1.DexServer{}
+		Eventually(func() authv1alpha1.MTLSRotationPhase {
+			reconcileDexServer(DexServerName, DexServerNamespace)
+			Expect(k8sClient.Get(context.TODO(), client.ObjectKey{Name: DexServerName, Namespace: DexServerNamespace}, dexServer)).To(Succeed())
+			if dexServer.Status.MTLS == nil {
+				return ""
+			}
+			return dexServer.Status.MTLS.RotationPhase
+		}, 30, 1).Should(Equal(phase))
+		return dexServer
+	}
+
+	// There is no deployment controller in the test environment, report the dex deployment as rolled out
+	rollOutDeployment := func() {
+		Eventually(func() error {
+			deployment := &appsv1.Deployment{}
+			if err := k8sClient.Get(context.TODO(), client.ObjectKey{Name: DexServerName, Namespace: DexServerNamespace}, deployment); err != nil {
+				return err
+			}
+			deployment.Status.ObservedGeneration = deployment.Generation
+			deployment.Status.Replicas = 1
+			deployment.Status.UpdatedReplicas = 1
+			deployment.Status.ReadyReplicas = 1
+			deployment.Status.AvailableReplicas = 1
+			return k8sClient.Status().Update(context.TODO(), deployment)
+		}, 30, 1).Should(Succeed())
+	}
+
+	getMTLSSecret := func() *corev1.Secret {
+		secret := &corev1.Secret{}
+		Expect(k8sClient.Get(context.TODO(), client.ObjectKey{Name: SECRET_MTLS_NAME, Namespace: DexServerNamespace}, secret)).To(Succeed())
+		return secret
+	}
+
+	It("should issue the certificates with the configured lifetimes", func() {
+		createDexServer(&authv1alpha1.DexServer{
+			ObjectMeta: metav1.ObjectMeta{Name: DexServerName, Namespace: DexServerNamespace},
+			Spec: authv1alpha1.DexServerSpec{
+				Issuer: "https://dex-server-mtls.example.com",
+				MTLS: &authv1alpha1.MTLSSpec{
+					CADuration:   &metav1.Duration{Duration: 24 * 365 * time.Hour},
+					CertDuration: &metav1.Duration{Duration: 72 * time.Hour},
+					RenewBefore:  &metav1.Duration{Duration: 12 * time.Hour},
+				},
+			},
+		})
+		reconcileDexServer(DexServerName, DexServerNamespace)
+
+		secret := getMTLSSecret()
+		ca := parsePEMCertificate(secret.Data["ca.crt"])
+		Expect(ca.NotAfter).To(BeTemporally("~", time.Now().Add(24*365*time.Hour), time.Minute))
+		server := parsePEMCertificate(secret.Data["tls.crt"])
+		Expect(server.NotAfter).To(BeTemporally("~", time.Now().Add(72*time.Hour), time.Minute))
+		Expect(server.CheckSignatureFrom(ca)).To(Succeed())
+		client := parsePEMCertificate(secret.Data["client.crt"])
+		Expect(client.CheckSignatureFrom(ca)).To(Succeed())
+	})
+	It("should keep the CA when renewing the certificates", func() {
+		secret := getMTLSSecret()
+		caPEM := secret.Data["ca.crt"]
+		serverPEM := secret.Data["tls.crt"]
+
+		// bring the certificates within the renewal window
+		secret.Annotations[MTLS_CERT_EXPIRY_ANNOTATION] = time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+		Expect(k8sClient.Update(context.TODO(), secret)).To(Succeed())
+		reconcileDexServer(DexServerName, DexServerNamespace)
+
+		secret = getMTLSSecret()
+		Expect(secret.Data["ca.crt"]).To(Equal(caPEM))
+		Expect(secret.Data["tls.crt"]).ToNot(Equal(serverPEM))
+		Expect(parsePEMCertificate(secret.Data["tls.crt"]).CheckSignatureFrom(parsePEMCertificate(caPEM))).To(Succeed())
+	})
+	It("should rotate the CA in stages when the key algorithm changes", func() {
+		secret := getMTLSSecret()
+		previousCA := parsePEMCertificate(secret.Data["ca.crt"])
+		serverPEM := secret.Data["tls.crt"]
+
+		By("trusting a new CA next to the previous one", func() {
+			dexServer := &authv1alpha1.DexServer{}
+			Expect(k8sClient.Get(context.TODO(), client.ObjectKey{Name: DexServerName, Namespace: DexServerNamespace}, dexServer)).To(Succeed())
+			dexServer.Spec.MTLS.KeyAlgorithm = authv1alpha1.KeyAlgorithmRSA4096
+			Expect(k8sClient.Update(context.TODO(), dexServer)).To(Succeed())
+			reconcileUntilPhase(authv1alpha1.MTLSRotationPhaseTrustingNewCA)
+
+			secret := getMTLSSecret()
+			Expect(parsePEMCertificates(secret.Data["ca.crt"])).To(HaveLen(2))
+			Expect(secret.Data["tls.crt"]).To(Equal(serverPEM))
+			Expect(secret.Data).To(HaveKey("next-ca.key"))
+		})
+		By("signing the certificates with the new CA once dex trusts it", func() {
+			rollOutDeployment()
+			reconcileUntilPhase(authv1alpha1.MTLSRotationPhaseReissuingCerts)
+
+			secret := getMTLSSecret()
+			cas := parsePEMCertificates(secret.Data["ca.crt"])
+			Expect(cas).To(HaveLen(2))
+			Expect(secret.Data).ToNot(HaveKey("next-ca.key"))
+			server := parsePEMCertificate(secret.Data["tls.crt"])
+			Expect(server.CheckSignatureFrom(previousCA)).ToNot(Succeed())
+			Expect(server.CheckSignatureFrom(cas[1])).To(Succeed())
+		})
+		By("dropping the previous CA once dex loaded the new certificates", func() {
+			rollOutDeployment()
+			dexServer := reconcileUntilPhase(authv1alpha1.MTLSRotationPhaseStable)
+
+			secret := getMTLSSecret()
+			cas := parsePEMCertificates(secret.Data["ca.crt"])
+			Expect(cas).To(HaveLen(1))
+			Expect(cas[0].Equal(previousCA)).To(BeFalse())
+			Expect(parsePEMCertificate(secret.Data["tls.crt"]).CheckSignatureFrom(cas[0])).To(Succeed())
+			Expect(dexServer.Status.MTLS.CAExpiry.Time).To(BeTemporally("~", cas[0].NotAfter, time.Second))
+		})
+	})
+	It("should reject a CA living shorter than the certificates", func() {
+		_, err := getMTLSConfig(&authv1alpha1.DexServer{
+			Spec: authv1alpha1.DexServerSpec{
+				MTLS: &authv1alpha1.MTLSSpec{
+					CADuration: &metav1.Duration{Duration: 12 * time.Hour},
+				},
+			},
+		})
+		Expect(err).ToNot(BeNil())
+	})
+	It("should issue certificates with every key algorithm", func() {
+		for _, keyAlgorithm := range []authv1alpha1.KeyAlgorithm{
+			authv1alpha1.KeyAlgorithmRSA2048,
+			authv1alpha1.KeyAlgorithmECDSAP256,
+			authv1alpha1.KeyAlgorithmECDSAP384,
+			authv1alpha1.KeyAlgorithmEd25519,
+		} {
+			config, err := getMTLSConfig(&authv1alpha1.DexServer{
+				Spec: authv1alpha1.DexServerSpec{
+					MTLS: &authv1alpha1.MTLSSpec{KeyAlgorithm: keyAlgorithm},
+				},
+			})
+			Expect(err).To(BeNil())
+			ca, err := generateMTLSCA(getGRPCCACommonName(DexServerNamespace), config)
+			Expect(err).To(BeNil())
+			parsedCA, err := parseMTLSCA(ca.pem.Bytes(), ca.privKeyPEM.Bytes())
+			Expect(err).To(BeNil())
+			Expect(parsedCA.isValidFor(config)).To(BeTrue())
+
+			certs, err := generateMTLSCerts(DexServerNamespace, parsedCA, config)
+			Expect(err).To(BeNil())
+			keyBlock, _ := pem.Decode(certs.clientPrivKeyPEM.Bytes())
+			Expect(keyBlock.Type).To(Equal("PRIVATE KEY"))
+			_, err = tls.X509KeyPair(certs.clientPEM.Bytes(), certs.clientPrivKeyPEM.Bytes())
+			Expect(err).To(BeNil())
+
+			server := parsePEMCertificate(certs.certPEM.Bytes())
+			client := parsePEMCertificate(certs.clientPEM.Bytes())
+			Expect(getKeyAlgorithm(client.PublicKey)).To(Equal(keyAlgorithm))
+			Expect(client.SerialNumber).ToNot(Equal(server.SerialNumber))
+			Expect(client.SubjectKeyId).ToNot(Equal(server.SubjectKeyId))
+			Expect(client.AuthorityKeyId).To(Equal(ca.cert.SubjectKeyId))
+			Expect(client.CheckSignatureFrom(ca.cert)).To(Succeed())
+		}
+	})
+})
+
+var _ = Describe("Sign the gRPC mTLS certificates of a DexServer with a provided CA", func() {
+	DexServerName := "dex-server-provided-ca"
+	DexServerNamespace := "dex-server-provided-ca-ns"
+	CASecretName := "dex-server-provided-ca"
+
+	getMTLSSecret := func() *corev1.Secret {
+		secret := &corev1.Secret{}
+		Expect(k8sClient.Get(context.TODO(), client.ObjectKey{Name: SECRET_MTLS_NAME, Namespace: DexServerNamespace}, secret)).To(Succeed())
+		return secret
+	}
+
+	// the CA stands for an approved intermediate, with the given lifetime
+	writeCASecret := func(lifetime time.Duration) *mtlsCA {
+		config, err := getMTLSConfig(&authv1alpha1.DexServer{})
+		Expect(err).To(BeNil())
+		config.caDuration = lifetime
+		ca, err := generateMTLSCA(getGRPCCACommonName(DexServerNamespace), config)
+		Expect(err).To(BeNil())
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: CASecretName, Namespace: DexServerNamespace},
+		}
+		err = k8sClient.Get(context.TODO(), client.ObjectKey{Name: CASecretName, Namespace: DexServerNamespace}, secret)
+		secret.Data = map[string][]byte{
+			"tls.crt": ca.pem.Bytes(),
+			"tls.key": ca.privKeyPEM.Bytes(),
+		}
+		if err == nil {
+			Expect(k8sClient.Update(context.TODO(), secret)).To(Succeed())
+		} else {
+			Expect(k8sClient.Create(context.TODO(), secret)).To(Succeed())
+		}
+		return ca
+	}
+
+	var providedCA *mtlsCA
+
+	It("should sign the certificates with the provided CA", func() {
+		createDexServer(&authv1alpha1.DexServer{
+			ObjectMeta: metav1.ObjectMeta{Name: DexServerName, Namespace: DexServerNamespace},
+			Spec: authv1alpha1.DexServerSpec{
+				Issuer: "https://dex-server-provided-ca.example.com",
+				MTLS: &authv1alpha1.MTLSSpec{
+					CASecretRef: &corev1.LocalObjectReference{Name: CASecretName},
+				},
+			},
+		})
+		providedCA = writeCASecret(24 * 365 * time.Hour)
+		dexServer := reconcileDexServer(DexServerName, DexServerNamespace)
+
+		secret := getMTLSSecret()
+		Expect(secret.Data["ca.crt"]).To(Equal(providedCA.pem.Bytes()))
+		Expect(secret.Data).ToNot(HaveKey("ca.key"))
+		Expect(parsePEMCertificate(secret.Data["tls.crt"]).CheckSignatureFrom(providedCA.cert)).To(Succeed())
+		Expect(parsePEMCertificate(secret.Data["client.crt"]).CheckSignatureFrom(providedCA.cert)).To(Succeed())
+		condition := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeMTLSCAExpiring)
+		Expect(condition).ToNot(BeNil())
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+
+		caSecret := &corev1.Secret{}
+		Expect(k8sClient.Get(context.TODO(), client.ObjectKey{Name: CASecretName, Namespace: DexServerNamespace}, caSecret)).To(Succeed())
+		Expect(caSecret.Labels).To(BeEmpty())
+	})
+	It("should report the removed consumers whose certificate dex still accepts", func() {
+		dexServer := &authv1alpha1.DexServer{}
+		Expect(k8sClient.Get(context.TODO(), client.ObjectKey{Name: DexServerName, Namespace: DexServerNamespace}, dexServer)).To(Succeed())
+		dexServer.Spec.MTLS.GRPCClients = []authv1alpha1.GRPCClientSpec{{Name: "audit"}}
+		Expect(k8sClient.Update(context.TODO(), dexServer)).To(Succeed())
+		dexServer = reconcileDexServer(DexServerName, DexServerNamespace)
+		Expect(meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeGRPCClientsRevoked)).To(BeNil())
+
+		dexServer.Spec.MTLS.GRPCClients = nil
+		Expect(k8sClient.Update(context.TODO(), dexServer)).To(Succeed())
+		dexServer = reconcileDexServer(DexServerName, DexServerNamespace)
+		condition := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeGRPCClientsRevoked)
+		Expect(condition).ToNot(BeNil())
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		Expect(condition.Message).To(ContainSubstring("audit"))
+		Expect(dexServer.Status.MTLS.RotationPhase).To(Equal(authv1alpha1.MTLSRotationPhaseStable))
+		Expect(k8sClient.Get(context.TODO(), client.ObjectKey{Name: getGRPCClientSecretName("audit"), Namespace: DexServerNamespace}, &corev1.Secret{})).To(Succeed())
+	})
+	It("should warn ahead of the expiry of the provided CA and rotate to its replacement", func() {
+		previousCA := providedCA
+		providedCA = writeCASecret(10 * 24 * time.Hour)
+		dexServer := reconcileDexServer(DexServerName, DexServerNamespace)
+
+		condition := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeMTLSCAExpiring)
+		Expect(condition).ToNot(BeNil())
+		Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+		Expect(dexServer.Status.MTLS.RotationPhase).To(Equal(authv1alpha1.MTLSRotationPhaseTrustingNewCA))
+		// the certificate of the removed consumer is no longer signed by the provided CA, and goes with the previous one
+		Expect(meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeGRPCClientsRevoked)).To(BeNil())
+		Expect(k8sClient.Get(context.TODO(), client.ObjectKey{Name: getGRPCClientSecretName("audit"), Namespace: DexServerNamespace}, &corev1.Secret{})).ToNot(Succeed())
+		secret := getMTLSSecret()
+		cas := parsePEMCertificates(secret.Data["ca.crt"])
+		Expect(cas).To(HaveLen(2))
+		Expect(cas[0].Equal(previousCA.cert)).To(BeTrue())
+		Expect(cas[1].Equal(providedCA.cert)).To(BeTrue())
+		Expect(secret.Data).ToNot(HaveKey("next-ca.key"))
+		Expect(parsePEMCertificate(secret.Data["tls.crt"]).CheckSignatureFrom(previousCA.cert)).To(Succeed())
+	})
+	It("should reject a provided certificate which is not a CA", func() {
+		config, err := getMTLSConfig(&authv1alpha1.DexServer{})
+		Expect(err).To(BeNil())
+		certs, err := generateMTLSCerts(DexServerNamespace, providedCA, config)
+		Expect(err).To(BeNil())
+		Expect(validateProvidedMTLSCA(parsePEMCertificate(certs.certPEM.Bytes()))).ToNot(Succeed())
+	})
+})
+
+var _ = Describe("Verify the gRPC mTLS certificate chains", func() {
+	Namespace := "dex-server-chains-ns"
+
+	generate := func() (*mtlsCA, *MTLSCerts, map[string][]byte) {
+		config, err := getMTLSConfig(&authv1alpha1.DexServer{})
+		Expect(err).To(BeNil())
+		ca, err := generateMTLSCA(getGRPCCACommonName(Namespace), config)
+		Expect(err).To(BeNil())
+		certs, err := generateMTLSCerts(Namespace, ca, config)
+		Expect(err).To(BeNil())
+		secret := rDexServer.defineMTLSSecret(&authv1alpha1.DexServer{
+			ObjectMeta: metav1.ObjectMeta{Name: "dex-server-chains", Namespace: Namespace},
+		}, certs)
+		return ca, certs, secret.Data
+	}
+
+	It("should write the leaf then the CA", func() {
+		ca, certs, data := generate()
+		for _, name := range []string{"tls.crt", "client.crt"} {
+			chain := parsePEMCertificates(data[name])
+			Expect(chain).To(HaveLen(2))
+			Expect(chain[0].IsCA).To(BeFalse())
+			Expect(chain[1].Equal(ca.cert)).To(BeTrue())
+		}
+		Expect(parsePEMCertificate(data["tls.crt"]).Equal(parsePEMCertificate(certs.certPEM.Bytes()))).To(BeTrue())
+		Expect(data["ca.crt"]).To(Equal(ca.pem.Bytes()))
+		Expect(verifyMTLSCerts(Namespace, data, data["ca.crt"])).To(Succeed())
+	})
+	It("should reject a certificate duplicated instead of chained", func() {
+		_, certs, _ := generate()
+		duplicated := append(append([]byte{}, certs.certPEM.Bytes()...), certs.certPEM.Bytes()...)
+		Expect(verifyMTLSChain(duplicated, certs.certPrivKeyPEM.Bytes(), certs.caPEM.Bytes(), x509.ExtKeyUsageServerAuth, "")).ToNot(Succeed())
+		Expect(verifyMTLSChain(certs.certPEM.Bytes(), certs.certPrivKeyPEM.Bytes(), certs.caPEM.Bytes(), x509.ExtKeyUsageServerAuth, "")).ToNot(Succeed())
+	})
+	It("should reject a certificate which does not match its key", func() {
+		_, _, data := generate()
+		Expect(verifyMTLSChain(data["tls.crt"], data["client.key"], data["ca.crt"], x509.ExtKeyUsageServerAuth, "")).ToNot(Succeed())
+	})
+	It("should reject a chain which is not trusted", func() {
+		_, _, data := generate()
+		other, _, _ := generate()
+		Expect(verifyMTLSCerts(Namespace, data, other.pem.Bytes())).ToNot(Succeed())
+	})
+	It("should reject a client certificate used as the server certificate", func() {
+		_, _, data := generate()
+		Expect(verifyMTLSChain(data["client.crt"], data["client.key"], data["ca.crt"], x509.ExtKeyUsageServerAuth, "")).ToNot(Succeed())
+	})
+	It("should reject a server certificate for another service", func() {
+		_, _, data := generate()
+		Expect(verifyMTLSCerts("another-ns", data, data["ca.crt"])).ToNot(Succeed())
+	})
+})
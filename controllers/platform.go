@@ -0,0 +1,52 @@
+// Copyright Red Hat
+
+package controllers
+
+import (
+	"github.com/pkg/errors"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/discovery"
+)
+
+// Platform is the kind of cluster the operator runs on
+type Platform string
+
+const (
+	// PlatformOpenShift: the OpenShift service CA issues the serving certificate of the dex web endpoint
+	PlatformOpenShift Platform = "OpenShift"
+
+	// PlatformKubernetes: the operator issues the serving certificate of the dex web endpoint itself
+	PlatformKubernetes Platform = "Kubernetes"
+)
+
+const OPENSHIFT_API_GROUP = "route.openshift.io"
+
+// Detect the platform from the API groups served by the cluster, OpenShift serves the route.openshift.io group
+func detectPlatform(discoveryClient discovery.DiscoveryInterface) (Platform, error) {
+	groups, err := discoveryClient.ServerGroups()
+	if err != nil {
+		return "", errors.Wrap(err, "error discovering the api groups")
+	}
+	for _, group := range groups.Groups {
+		if group.Name == OPENSHIFT_API_GROUP {
+			return PlatformOpenShift, nil
+		}
+	}
+	return PlatformKubernetes, nil
+}
+
+// Detect whether the cluster serves the HTTPRoute and BackendTLSPolicy kinds of the Gateway API
+func detectGatewayAPI(discoveryClient discovery.DiscoveryInterface) (bool, error) {
+	resources, err := discoveryClient.ServerResourcesForGroupVersion(httpRouteGVK.GroupVersion().String())
+	if err != nil {
+		if kubeerrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, errors.Wrap(err, "error discovering the gateway api")
+	}
+	kinds := map[string]bool{}
+	for _, resource := range resources.APIResources {
+		kinds[resource.Kind] = true
+	}
+	return kinds[httpRouteGVK.Kind] && kinds[backendTLSPolicyGVK.Kind], nil
+}
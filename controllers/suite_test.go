@@ -6,21 +6,28 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	routev1 "github.com/openshift/api/route/v1"
 	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/envtest"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+	dexapi "github.com/identitatem/dex-operator/controllers/dex"
 	ctrl "sigs.k8s.io/controller-runtime"
 	//+kubebuilder:scaffold:imports
 )
@@ -35,6 +42,8 @@ var (
 	cancel     context.CancelFunc
 	rDexServer DexServerReconciler
 	rDexClient DexClientReconciler
+
+	rDexSessionRevocation DexSessionRevocationReconciler
 )
 
 func TestAPIs(t *testing.T) {
@@ -68,6 +77,9 @@ var _ = BeforeSuite(func() {
 	err = appsv1.AddToScheme(scheme.Scheme)
 	Expect(err).Should(BeNil())
 
+	err = routev1.AddToScheme(scheme.Scheme)
+	Expect(err).Should(BeNil())
+
 	//+kubebuilder:scaffold:scheme
 
 	// Configure a new test environment which ingests our CRDs to allow an API server to know about our custom resources
@@ -75,6 +87,13 @@ var _ = BeforeSuite(func() {
 		Scheme:                scheme.Scheme,
 		CRDDirectoryPaths:     []string{filepath.Join("..", "config", "crd", "bases")},
 		ErrorIfCRDPathMissing: true,
+		// OpenShift, the Gateway API and dex are not part of the test environment, serve the kinds the dex server
+		// controller writes
+		CRDs: []client.Object{
+			testCRD(routev1.GroupName, "Route", "routes"),
+			testCRD(GATEWAY_API_GROUP, "HTTPRoute", "httproutes"),
+			testCRD(GATEWAY_API_GROUP, "BackendTLSPolicy", "backendtlspolicies"),
+		},
 	}
 
 	// Start the environment (API server)
@@ -99,17 +118,28 @@ var _ = BeforeSuite(func() {
 		DynamicClient:      dynamic.NewForConfigOrDie(cfg),
 		APIExtensionClient: apiextensionsclient.NewForConfigOrDie(cfg),
 		Scheme:             scheme.Scheme,
+		// the test environment stands for an OpenShift cluster, the web TLS test switches to Kubernetes
+		Platform: PlatformOpenShift,
 	}
 
 	err = (rDexServer).SetupWithManager(k8sManager)
 	Expect(err).ToNot(HaveOccurred())
 
 	rDexClient = DexClientReconciler{
+		Client:   k8sClient,
+		Scheme:   scheme.Scheme,
+		Recorder: k8sManager.GetEventRecorderFor("dexclient-controller"),
+	}
+
+	err = (rDexClient).SetupWithManager(k8sManager)
+	Expect(err).ToNot(HaveOccurred())
+
+	rDexSessionRevocation = DexSessionRevocationReconciler{
 		Client: k8sClient,
 		Scheme: scheme.Scheme,
 	}
 
-	err = (rDexClient).SetupWithManager(k8sManager)
+	err = (rDexSessionRevocation).SetupWithManager(k8sManager)
 	Expect(err).ToNot(HaveOccurred())
 
 	go func() {
@@ -119,6 +149,84 @@ var _ = BeforeSuite(func() {
 	}()
 })
 
+// A DexClient reconciler connecting to dex with newDexAPI, for the tests which replace the dex API. The reconciler
+// run by the manager is left untouched.
+func newTestDexClientReconciler(newDexAPI func(ctx context.Context, opts *dexapi.Options) (dexapi.DexAPI, error)) *DexClientReconciler {
+	return &DexClientReconciler{
+		Client:         k8sClient,
+		Scheme:         scheme.Scheme,
+		Recorder:       &record.FakeRecorder{},
+		DexConnections: dexapi.NewConnectionManager(newDexAPI),
+	}
+}
+
+// Create a namespace with the given objects and the DexServer in it. The objects are created first, so that the
+// DexServer finds them.
+func createDexServer(dexServer *authv1alpha1.DexServer, objects ...client.Object) {
+	Expect(k8sClient.Create(context.TODO(), &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: dexServer.Namespace},
+	})).To(Succeed())
+	for _, obj := range objects {
+		obj.SetNamespace(dexServer.Namespace)
+		Expect(k8sClient.Create(context.TODO(), obj)).To(Succeed())
+	}
+	Expect(k8sClient.Create(context.TODO(), dexServer)).To(Succeed())
+}
+
+// Reconcile a DexServer once
+func reconcileDexServerOnce(name string, namespace string) error {
+	req := ctrl.Request{}
+	req.Name = name
+	req.Namespace = namespace
+	_, err := rDexServer.Reconcile(context.TODO(), req)
+	return err
+}
+
+// Reconcile a DexServer until a reconcile succeeds and return it. The manager reconciles the DexServer too, so a
+// reconcile may fail on a conflict.
+func reconcileDexServer(name string, namespace string) *authv1alpha1.DexServer {
+	Eventually(func() error {
+		return reconcileDexServerOnce(name, namespace)
+	}, 30, 1).Should(Succeed())
+	dexServer := &authv1alpha1.DexServer{}
+	Expect(k8sClient.Get(context.TODO(), client.ObjectKey{Name: name, Namespace: namespace}, dexServer)).To(Succeed())
+	return dexServer
+}
+
+// A v1 CRD keeping the fields it is given, with a status subresource, standing for an API of another project
+func testCRD(group string, kind string, plural string) *apiextensionsv1.CustomResourceDefinition {
+	preserveUnknownFields := true
+	return &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: plural + "." + group},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Group: group,
+			Names: apiextensionsv1.CustomResourceDefinitionNames{
+				Plural:   plural,
+				Singular: strings.ToLower(kind),
+				Kind:     kind,
+				ListKind: kind + "List",
+			},
+			Scope: apiextensionsv1.NamespaceScoped,
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+				{
+					Name:    "v1",
+					Served:  true,
+					Storage: true,
+					Schema: &apiextensionsv1.CustomResourceValidation{
+						OpenAPIV3Schema: &apiextensionsv1.JSONSchemaProps{
+							Type:                   "object",
+							XPreserveUnknownFields: &preserveUnknownFields,
+						},
+					},
+					Subresources: &apiextensionsv1.CustomResourceSubresources{
+						Status: &apiextensionsv1.CustomResourceSubresourceStatus{},
+					},
+				},
+			},
+		},
+	}
+}
+
 var _ = AfterSuite(func() {
 	cancel()
 	By("tearing down the test environment")
@@ -5,6 +5,7 @@ package main
 import (
 	"flag"
 	"os"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
@@ -25,6 +26,7 @@ import (
 
 	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
 	"github.com/identitatem/dex-operator/controllers"
+	dexapi "github.com/identitatem/dex-operator/controllers/dex"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -45,11 +47,23 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	dexRetryPolicy := dexapi.DefaultRetryPolicy
+	var dexDialTimeout time.Duration
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.DurationVar(&dexDialTimeout, "dex-dial-timeout", dexapi.DialTimeout,
+		"How long opening a gRPC connection to a dex server may take.")
+	flag.IntVar(&dexRetryPolicy.MaxAttempts, "dex-api-max-attempts", dexapi.DefaultRetryPolicy.MaxAttempts,
+		"The number of attempts of the idempotent dex API calls, including the first one.")
+	flag.DurationVar(&dexRetryPolicy.InitialBackoff, "dex-api-initial-backoff", dexapi.DefaultRetryPolicy.InitialBackoff,
+		"The delay before the first retry of a dex API call, doubling with each retry.")
+	flag.DurationVar(&dexRetryPolicy.MaxBackoff, "dex-api-max-backoff", dexapi.DefaultRetryPolicy.MaxBackoff,
+		"The longest delay between two attempts of a dex API call.")
+	flag.DurationVar(&dexRetryPolicy.AttemptTimeout, "dex-api-attempt-timeout", dexapi.DefaultRetryPolicy.AttemptTimeout,
+		"How long each attempt of a dex API call may take.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -82,7 +96,8 @@ func main() {
 	readerConfig := dexconfig.GetScenarioResourcesReader()
 
 	files := []string{"crd/bases/auth.identitatem.io_dexclients.yaml",
-		"crd/bases/auth.identitatem.io_dexservers.yaml"}
+		"crd/bases/auth.identitatem.io_dexservers.yaml",
+		"crd/bases/auth.identitatem.io_dexsessionrevocations.yaml"}
 
 	_, err = applier.ApplyDirectly(readerConfig, nil, false, "", files...)
 	if err != nil {
@@ -90,23 +105,38 @@ func main() {
 		os.Exit(1)
 	}
 
+	// The connections to the dex servers are shared by the controllers calling the dex API
+	dexConnections := dexapi.NewConnectionManager(dexapi.NewDexAPI)
+	dexConnections.DialTimeout = dexDialTimeout
+	dexConnections.RetryPolicy = &dexRetryPolicy
 	if err = (&controllers.DexServerReconciler{
 		Client:             mgr.GetClient(),
 		KubeClient:         kubernetes.NewForConfigOrDie(ctrl.GetConfigOrDie()),
 		DynamicClient:      dynamic.NewForConfigOrDie(ctrl.GetConfigOrDie()),
 		APIExtensionClient: apiextensionsclient.NewForConfigOrDie(ctrl.GetConfigOrDie()),
 		Scheme:             mgr.GetScheme(),
+		DexConnections:     dexConnections,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "DexServer")
 		os.Exit(1)
 	}
 	if err = (&controllers.DexClientReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:         mgr.GetClient(),
+		Scheme:         mgr.GetScheme(),
+		Recorder:       mgr.GetEventRecorderFor("dexclient-controller"),
+		DexConnections: dexConnections,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "DexClient")
 		os.Exit(1)
 	}
+	if err = (&controllers.DexSessionRevocationReconciler{
+		Client:         mgr.GetClient(),
+		Scheme:         mgr.GetScheme(),
+		DexConnections: dexConnections,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "DexSessionRevocation")
+		os.Exit(1)
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {